@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"sda-filesystem/internal/airlock"
+	"sda-filesystem/internal/logs"
+)
+
+var upload = airlock.Upload
+var checkEncryption = airlock.CheckEncryption
+
+// exportFile is a file that is exported to 'container', which may continue with a path inside the bucket
+type exportFile struct {
+	path, container string
+}
+
+// patterns splits a comma-separated list of glob patterns and checks that they are valid
+func patterns(list string) ([]string, error) {
+	var globs []string
+	for _, glob := range strings.Split(list, ",") {
+		if glob = strings.TrimSpace(glob); glob == "" {
+			continue
+		}
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("Invalid pattern %q: %w", glob, err)
+		}
+		globs = append(globs, glob)
+	}
+
+	return globs, nil
+}
+
+// matches tells whether the name or the relative path of a file matches one of 'globs'
+func matches(globs []string, name, relPath string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(glob, relPath); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// collectFiles returns the files in 'paths' that are exported to 'container'. Directories are walked recursively
+// and their files are exported under the name of the directory, so that their relative paths are kept as prefixes
+// of the objects. Files in directories are exported if their name or relative path matches one of 'include', or if
+// 'include' is empty, and none of 'exclude'. Directories that match 'exclude' are skipped altogether.
+func collectFiles(paths []string, container string, include, exclude []string) ([]exportFile, error) {
+	container = strings.TrimRight(container, "/")
+	var files []exportFile
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, exportFile{path: p, container: container})
+
+			continue
+		}
+
+		root := filepath.Clean(p)
+		base, err := prefix(root)
+		if err != nil {
+			return nil, err
+		}
+		err = filepath.WalkDir(root, func(filePath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, filePath)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+
+			switch {
+			case d.IsDir():
+				if filePath != root && matches(exclude, d.Name(), rel) {
+					return filepath.SkipDir
+				}
+			case !d.Type().IsRegular():
+				logs.Warningf("Skipping %s since it is not a regular file", filePath)
+			case len(include) > 0 && !matches(include, d.Name(), rel), matches(exclude, d.Name(), rel):
+				logs.Debugf("Skipping %s", filePath)
+			default:
+				fileContainer := container
+				if dir := path.Join(base, path.Dir(rel)); dir != "." {
+					fileContainer += "/" + dir
+				}
+				files = append(files, exportFile{path: filePath, container: fileContainer})
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Could not read directory %s: %w", p, err)
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, errors.New("No files to export")
+	}
+
+	// Objects are named after the container and the name of the file
+	objects := make(map[string]string, len(files))
+	for _, f := range files {
+		object := f.container + "/" + filepath.Base(f.path)
+		if prev, ok := objects[object]; ok {
+			return nil, fmt.Errorf("Files %s and %s would be exported as the same object %s", prev, f.path, object)
+		}
+		objects[object] = f.path
+	}
+
+	return files, nil
+}
+
+// prefix returns the name under which the files of directory 'dir' are exported. Relative paths such as "." are
+// named after the directory they refer to, and the root directory has no name, so its files are exported without a prefix.
+func prefix(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("Could not determine path of %s: %w", dir, err)
+	}
+	if base := filepath.Base(abs); base != string(filepath.Separator) && base != "." {
+		return base, nil
+	}
+
+	return "", nil
+}
+
+// exportFiles uploads 'files' one at a time. Files whose export fails are reported once all files have been
+// attempted, and if there is more than one file, a summary is logged. Returns an error if any of the exports failed.
+func exportFiles(files []exportFile, segmentSizeMb uint64, journalNumber, originalFilename string, resume bool) error {
+	var failed []string
+	var lastErr error
+	for i, f := range files {
+		if len(files) > 1 {
+			logs.Infof("Exporting file %d/%d: %s", i+1, len(files), f.path)
+		}
+		encrypted, err := checkEncryption(f.path)
+		if err != nil {
+			err = fmt.Errorf("Failed to check if file %s is encrypted: %w", f.path, err)
+		} else {
+			err = upload(f.path, f.container, segmentSizeMb, journalNumber, originalFilename, encrypted, resume)
+		}
+		if err != nil {
+			lastErr = err
+			failed = append(failed, f.path)
+			if len(files) > 1 {
+				logs.Error(err)
+			}
+		}
+	}
+
+	switch {
+	case len(files) == 1:
+		return lastErr
+	case len(failed) > 0:
+		logs.Infof("Exported %d/%d files", len(files)-len(failed), len(files))
+
+		return fmt.Errorf("Failed to export %d/%d files: %s", len(failed), len(files), strings.Join(failed, ", "))
+	default:
+		logs.Infof("Exported %d files", len(files))
+
+		return nil
+	}
+}
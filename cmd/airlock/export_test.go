@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sda-filesystem/internal/logs"
+)
+
+var errExpected = errors.New("Expected error for test")
+
+func TestMain(m *testing.M) {
+	logs.SetSignal(func(string, []string) {})
+	os.Exit(m.Run())
+}
+
+// writeFiles creates files 'names' under directory 'dir'
+func writeFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			t.Fatalf("Failed to create directory: %s", err.Error())
+		}
+		if err := os.WriteFile(file, []byte(name), 0600); err != nil {
+			t.Fatalf("Failed to create file: %s", err.Error())
+		}
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	var tests = []struct {
+		testname, list, errStr string
+		globs                  []string
+	}{
+		{"OK", "*.txt, data/*.csv,,", "", []string{"*.txt", "data/*.csv"}},
+		{"EMPTY", "", "", nil},
+		{"INVALID", "*.txt,[a-", `Invalid pattern "[a-": syntax error in pattern`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			globs, err := patterns(tt.list)
+			switch {
+			case tt.errStr != "":
+				if err == nil {
+					t.Error("Function did not return error")
+				} else if err.Error() != tt.errStr {
+					t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errStr, err.Error())
+				}
+			case err != nil:
+				t.Errorf("Function returned unexpected error: %s", err.Error())
+			case !reflect.DeepEqual(globs, tt.globs):
+				t.Errorf("Incorrect patterns. Expected=%v, received=%v", tt.globs, globs)
+			}
+		})
+	}
+}
+
+func TestCollectFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "data/a.txt", "data/b.csv", "data/sub/c.txt", "data/sub/d.tmp", "data/.git/config", "single.txt")
+	data := filepath.Join(dir, "data")
+	single := filepath.Join(dir, "single.txt")
+
+	var tests = []struct {
+		testname         string
+		paths            []string
+		include, exclude []string
+		files            []exportFile
+	}{
+		{"FILE", []string{single}, nil, nil, []exportFile{{single, "bucket/dir"}}},
+		{"DIRECTORY", []string{data + "/", single}, nil, nil, []exportFile{
+			{filepath.Join(data, ".git", "config"), "bucket/dir/data/.git"},
+			{filepath.Join(data, "a.txt"), "bucket/dir/data"},
+			{filepath.Join(data, "b.csv"), "bucket/dir/data"},
+			{filepath.Join(data, "sub", "c.txt"), "bucket/dir/data/sub"},
+			{filepath.Join(data, "sub", "d.tmp"), "bucket/dir/data/sub"},
+			{single, "bucket/dir"},
+		}},
+		{"EXCLUDE", []string{data}, nil, []string{"*.tmp", ".git", "b.csv"}, []exportFile{
+			{filepath.Join(data, "a.txt"), "bucket/dir/data"},
+			{filepath.Join(data, "sub", "c.txt"), "bucket/dir/data/sub"},
+		}},
+		{"INCLUDE", []string{data, single}, []string{"*.txt"}, []string{"sub/*"}, []exportFile{
+			{filepath.Join(data, "a.txt"), "bucket/dir/data"},
+			{single, "bucket/dir"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			files, err := collectFiles(tt.paths, "bucket/dir/", tt.include, tt.exclude)
+			if err != nil {
+				t.Fatalf("Function returned unexpected error: %s", err.Error())
+			}
+			if !reflect.DeepEqual(files, tt.files) {
+				t.Errorf("Incorrect files\nExpected=%v\nReceived=%v", tt.files, files)
+			}
+		})
+	}
+}
+
+func TestCollectFiles_RelativePath(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "data/a.txt", "data/sub/c.txt")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Could not get working directory: %s", err.Error())
+	}
+	defer os.Chdir(wd)
+	if err = os.Chdir(filepath.Join(dir, "data", "sub")); err != nil {
+		t.Fatalf("Could not change directory: %s", err.Error())
+	}
+
+	var tests = []struct {
+		testname string
+		path     string
+		files    []exportFile
+	}{
+		{"CURRENT", ".", []exportFile{{"c.txt", "bucket/sub"}}},
+		{"PARENT", "..", []exportFile{
+			{filepath.Join("..", "a.txt"), "bucket/data"},
+			{filepath.Join("..", "sub", "c.txt"), "bucket/data/sub"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			files, err := collectFiles([]string{tt.path}, "bucket", nil, nil)
+			if err != nil {
+				t.Fatalf("Function returned unexpected error: %s", err.Error())
+			}
+			if !reflect.DeepEqual(files, tt.files) {
+				t.Errorf("Incorrect files\nExpected=%v\nReceived=%v", tt.files, files)
+			}
+		})
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	var tests = []struct {
+		dir, prefix string
+	}{
+		{filepath.Join("path", "to", "data"), "data"},
+		{string(filepath.Separator), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			if p, err := prefix(tt.dir); err != nil {
+				t.Errorf("Function returned unexpected error: %s", err.Error())
+			} else if p != tt.prefix {
+				t.Errorf("Function returned incorrect prefix. Expected=%q, received=%q", tt.prefix, p)
+			}
+		})
+	}
+}
+
+func TestCollectFiles_Error(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "data/file.txt", "other/file.txt")
+
+	var tests = []struct {
+		testname, errStr string
+		paths, exclude   []string
+	}{
+		{"NO_FILES", "No files to export", []string{filepath.Join(dir, "data")}, []string{"*.txt"}},
+		{"SAME_OBJECT", "Files " + filepath.Join(dir, "data", "file.txt") + " and " + filepath.Join(dir, "other", "file.txt") +
+			" would be exported as the same object bucket/file.txt",
+			[]string{filepath.Join(dir, "data", "file.txt"), filepath.Join(dir, "other", "file.txt")}, nil},
+		{"NOT_FOUND", "stat " + filepath.Join(dir, "missing") + ": no such file or directory", []string{filepath.Join(dir, "missing")}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			_, err := collectFiles(tt.paths, "bucket", nil, tt.exclude)
+			if err == nil {
+				t.Error("Function did not return error")
+			} else if err.Error() != tt.errStr {
+				t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errStr, err.Error())
+			}
+		})
+	}
+}
+
+func TestExportFiles(t *testing.T) {
+	var tests = []struct {
+		testname, errStr string
+		files            []exportFile
+		uploaded         []string
+	}{
+		{"OK", "", []exportFile{{"a.txt", "bucket"}, {"b.c4gh", "bucket/dir"}}, []string{"a.txt bucket false", "b.c4gh bucket/dir true"}},
+		{"FAIL", "Failed to export 2/4 files: fail.txt, check.txt",
+			[]exportFile{{"a.txt", "bucket"}, {"fail.txt", "bucket"}, {"check.txt", "bucket"}, {"b.c4gh", "bucket"}},
+			[]string{"a.txt bucket false", "b.c4gh bucket true"}},
+		{"FAIL_SINGLE", errExpected.Error(), []exportFile{{"fail.txt", "bucket"}}, nil},
+		{"FAIL_CHECK_SINGLE", "Failed to check if file check.txt is encrypted: " + errExpected.Error(), []exportFile{{"check.txt", "bucket"}}, nil},
+	}
+
+	origUpload := upload
+	origCheckEncryption := checkEncryption
+	defer func() {
+		upload = origUpload
+		checkEncryption = origCheckEncryption
+	}()
+
+	checkEncryption = func(filename string) (bool, error) {
+		if filename == "check.txt" {
+			return false, errExpected
+		}
+
+		return filepath.Ext(filename) == ".c4gh", nil
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			var uploaded []string
+			upload = func(filename, container string, _ uint64, _, _ string, encrypted, _ bool) error {
+				if filename == "fail.txt" {
+					return errExpected
+				}
+				uploaded = append(uploaded, fmt.Sprintf("%s %s %t", filename, container, encrypted))
+
+				return nil
+			}
+
+			err := exportFiles(tt.files, 100, "", "", false)
+			switch {
+			case tt.errStr != "":
+				if err == nil {
+					t.Error("Function did not return error")
+				} else if err.Error() != tt.errStr {
+					t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errStr, err.Error())
+				}
+			case err != nil:
+				t.Errorf("Function returned unexpected error: %s", err.Error())
+			}
+			if !reflect.DeepEqual(uploaded, tt.uploaded) {
+				t.Errorf("Incorrect files uploaded\nExpected=%v\nReceived=%v", tt.uploaded, uploaded)
+			}
+		})
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"os"
 	"syscall"
+	"time"
 
 	"sda-filesystem/internal/airlock"
 	"sda-filesystem/internal/api"
+	"sda-filesystem/internal/config"
 	"sda-filesystem/internal/logs"
 
 	"golang.org/x/term"
@@ -19,13 +21,16 @@ func usage(selfPath string) {
 	fmt.Println("Usage:")
 	fmt.Println(" ", selfPath, "[-segment-size=sizeInMb] "+
 		"[-journal-number=journalNumber] [-original-file=unecryptedFilename] "+
-		"[-quiet] "+"username container filename")
+		"[-include=patterns] [-exclude=patterns] "+
+		"[-parallel=segments] [-quiet] [-resume] [-stream] "+"username container filename [filename...]")
+	fmt.Println(" ", selfPath, "-discard")
 	fmt.Println("Examples:")
 	fmt.Println(" ", selfPath, "testuser testcontainer path/to/file")
 	fmt.Println(" ", selfPath, "-segment-size=100 testuser testcontainer path/to/file")
 	fmt.Println(" ", selfPath, "-segment-size=100 "+
 		"-original-file=/path/to/original/unecrypted/file -journal-number=example124"+
 		"testuser testcontainer path/to/file")
+	fmt.Println(" ", selfPath, "-exclude='*.tmp,.git' testuser testcontainer path/to/directory path/to/file")
 }
 
 func main() {
@@ -35,32 +40,102 @@ func main() {
 		"Journal Number/Name specific for Findata uploads")
 	originalFilename := flag.String("original-file", "",
 		"Filename of original unecrypted file when uploading pre-encrypted file from Findata vm")
+	include := flag.String("include", "", "Comma-separated glob patterns of the files that are exported from directories")
+	exclude := flag.String("exclude", "", "Comma-separated glob patterns of the files and directories that are not exported from directories")
 	project := flag.String("project", "", "SD Connect project if it differs from that in the VM")
+	parallel := flag.Int("parallel", 1, "Number of segments uploaded at the same time")
 	quiet := flag.Bool("quiet", false, "Print only errors")
+	resume := flag.Bool("resume", false, "Continue a previous segmented upload of the file that failed from the first segment that was not uploaded. "+
+		"Streamed uploads, which are used automatically when there is not enough space for the encrypted file, cannot be resumed")
+	discard := flag.Bool("discard", false, "Remove the journals and encrypted copies of all failed uploads instead of exporting files")
+	stream := flag.Bool("stream", false, "Encrypt the file while it is uploaded instead of into a temporary file first, which needs no disk space. "+
+		"Used automatically when there is not enough space for the encrypted file. "+
+		"Streamed uploads send one segment at a time, and cannot be retried or resumed")
 	debug := flag.Bool("debug", false, "Enable debug prints")
 
+	cfg, _, err := config.Load()
+	if err != nil {
+		logs.Fatal(err)
+	}
+	if err = cfg.SetEnv(); err != nil {
+		logs.Fatal(err)
+	}
+	err = config.SetFlags(flag.CommandLine, map[string]any{
+		"segment-size": cfg.Airlock.SegmentSize,
+		"parallel":     cfg.Airlock.Parallel,
+		"quiet":        cfg.Airlock.Quiet,
+		"stream":       cfg.Airlock.Stream,
+	})
+	if err != nil {
+		logs.Fatal(err)
+	}
+
 	flag.Parse()
 
-	if flag.NArg() != 3 {
+	if *discard {
+		n, err := airlock.DiscardUploads()
+		if err != nil {
+			logs.Fatal(err)
+		}
+		logs.Infof("Discarded %d failed uploads", n)
+
+		return
+	}
+
+	if flag.NArg() < 3 {
 		usage(os.Args[0])
 		os.Exit(2)
 	}
 
 	username := flag.Arg(0)
 	container := flag.Arg(1)
-	filename := flag.Arg(2)
 
 	if *segmentSizeMb < 10 || *segmentSizeMb > 4000 {
 		logs.Fatal("Valid values for segment size are 10-4000")
 	}
+	if *parallel < 1 {
+		logs.Fatal("Number of parallel segments must be positive")
+	}
+	airlock.SetParallelSegments(*parallel)
+	airlock.SetStreamEncryption(*stream)
 
-	if *debug {
+	switch {
+	case *debug:
 		logs.SetLevel("debug")
-	} else if *quiet {
+	case *quiet:
 		logs.SetLevel("error")
+	case cfg.LogLevel != "":
+		logs.SetLevel(cfg.LogLevel)
+	}
+	if !*quiet && term.IsTerminal(int(os.Stdout.Fd())) {
+		bar := &progressBar{out: os.Stdout, logs: os.Stderr}
+		logs.SetOutput(bar)
+		airlock.SetProgressObserver(bar.update)
 	}
 
-	err := api.GetCommonEnvs()
+	includeGlobs, err := patterns(*include)
+	if err != nil {
+		logs.Fatal(err)
+	}
+	excludeGlobs, err := patterns(*exclude)
+	if err != nil {
+		logs.Fatal(err)
+	}
+	files, err := collectFiles(flag.Args()[2:], container, includeGlobs, excludeGlobs)
+	if err != nil {
+		logs.Fatal(err)
+	}
+	if *originalFilename != "" && len(files) > 1 {
+		logs.Fatal("Flag -original-file can only be used when exporting a single file")
+	}
+
+	if cfg.HTTP.Timeout != nil {
+		api.SetRequestTimeout(*cfg.HTTP.Timeout)
+	}
+	api.SetRequestRetries(config.Or(cfg.HTTP.Retries, api.DefaultRequestRetries),
+		time.Duration(config.Or(cfg.HTTP.RetryDelay, int(api.DefaultRetryDelay.Milliseconds())))*time.Millisecond)
+
+	err = api.GetCommonEnvs()
 	if err != nil {
 		logs.Fatal(err)
 	}
@@ -95,12 +170,7 @@ func main() {
 
 	_ = api.BasicToken(username, password)
 
-	encrypted, err := airlock.CheckEncryption(filename)
-	if err != nil {
-		logs.Fatalf("Failed to check if file is encrypted: %s", err.Error())
-	}
-
-	err = airlock.Upload(filename, container, uint64(*segmentSizeMb), *journalNumber, *originalFilename, encrypted)
+	err = exportFiles(files, uint64(*segmentSizeMb), *journalNumber, *originalFilename, *resume)
 	if err != nil {
 		logs.Fatal(err)
 	}
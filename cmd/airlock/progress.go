@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"sda-filesystem/internal/airlock"
+)
+
+// clearLine moves the cursor to the beginning of the line and clears it
+const clearLine = "\r\033[K"
+
+// barWidth is the number of characters in the bar that fills up
+const barWidth = 30
+
+// progressBar draws the progress of uploads on the last line of a terminal. Logs are written through
+// the progress bar so that they appear above the bar instead of being mixed with it.
+type progressBar struct {
+	out, logs io.Writer
+	lock      sync.Mutex
+	line      string // line that is currently drawn, empty if there is none
+}
+
+// update draws the progress of an upload, and moves to the next line once the phase has ended
+func (b *progressBar) update(p airlock.Progress) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.line = formatProgress(p)
+	fmt.Fprint(b.out, clearLine+b.line)
+	if p.Done {
+		fmt.Fprintln(b.out)
+		b.line = ""
+	}
+}
+
+// Write writes a log entry and draws the progress bar again below it
+func (b *progressBar) Write(entry []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.line == "" {
+		return b.logs.Write(entry)
+	}
+	fmt.Fprint(b.out, clearLine)
+	n, err := b.logs.Write(entry)
+	fmt.Fprint(b.out, b.line)
+
+	return n, err
+}
+
+// formatProgress returns 'p' as a line such as
+// "Uploading file.txt [=======>        ]  45% 1.2 GiB/2.7 GiB 35.2 MiB/s 1m20s left"
+func formatProgress(p airlock.Progress) string {
+	fraction := 1.0
+	if p.Total > 0 {
+		fraction = min(max(float64(p.Bytes)/float64(p.Total), 0), 1)
+	}
+	filled := int(fraction * barWidth)
+	bar := strings.Repeat("=", filled)
+	if filled < barWidth {
+		bar += ">" + strings.Repeat(" ", barWidth-filled-1)
+	}
+
+	name := filepath.Base(p.Filename)
+	if len(name) > barWidth {
+		name = "..." + name[len(name)-barWidth+3:]
+	}
+	left := "--"
+	if p.Remaining >= 0 {
+		left = (time.Duration(p.Remaining * float64(time.Second))).Round(time.Second).String()
+	}
+
+	return fmt.Sprintf("%s %s [%s] %3d%% %s/%s %s/s %s left", strings.ToUpper(p.Phase[:1])+p.Phase[1:], name, bar,
+		int(fraction*100), byteSize(p.Bytes), byteSize(p.Total), byteSize(int64(p.Speed)), left)
+}
+
+// byteSize returns 'n' bytes in a human readable form
+func byteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"sda-filesystem/internal/airlock"
+)
+
+func TestFormatProgress(t *testing.T) {
+	var tests = []struct {
+		testname, line string
+		progress       airlock.Progress
+	}{
+		{"BEGIN", "Encrypting file.txt [>                             ]   0% 0 B/2.0 MiB 0 B/s -- left",
+			airlock.Progress{Filename: "/home/user/file.txt", Phase: airlock.PhaseEncrypting, Total: 2 << 20, Remaining: -1}},
+		{"HALF", "Uploading file.txt.c4gh [===============>              ]  50% 1.0 GiB/2.0 GiB 10.0 MiB/s 1m42s left",
+			airlock.Progress{Filename: "file.txt.c4gh", Phase: airlock.PhaseUploading, Bytes: 1 << 30, Total: 2 << 30, Speed: 10 << 20, Remaining: 102.4}},
+		{"DONE", "Uploading ...e_with_a_very_long_name.txt [==============================] 100% 1000 B/1000 B 500 B/s 0s left",
+			airlock.Progress{Filename: "a_file_with_a_very_long_name.txt", Phase: airlock.PhaseUploading, Bytes: 1000, Total: 1000, Speed: 500, Done: true}},
+		{"EMPTY", "Uploading empty [==============================] 100% 0 B/0 B 0 B/s -- left",
+			airlock.Progress{Filename: "empty", Phase: airlock.PhaseUploading, Remaining: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			if line := formatProgress(tt.progress); line != tt.line {
+				t.Errorf("Function returned incorrect line\nExpected=%q\nReceived=%q", tt.line, line)
+			}
+		})
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	out, logOutput := &bytes.Buffer{}, &bytes.Buffer{}
+	bar := &progressBar{out: out, logs: logOutput}
+
+	if _, err := bar.Write([]byte("first log\n")); err != nil {
+		t.Fatalf("Writing log failed: %s", err.Error())
+	}
+	if out.Len() != 0 {
+		t.Errorf("Nothing should be drawn before there is progress, received %q", out.String())
+	}
+
+	progress := airlock.Progress{Filename: "file", Phase: airlock.PhaseUploading, Bytes: 1, Total: 2, Remaining: -1}
+	line := formatProgress(progress)
+	bar.update(progress)
+	if _, err := bar.Write([]byte("second log\n")); err != nil {
+		t.Fatalf("Writing log failed: %s", err.Error())
+	}
+	progress.Bytes, progress.Done = 2, true
+	bar.update(progress)
+
+	expected := clearLine + line + clearLine + line + clearLine + formatProgress(progress) + "\n"
+	if out.String() != expected {
+		t.Errorf("Incorrect output\nExpected=%q\nReceived=%q", expected, out.String())
+	}
+	if logOutput.String() != "first log\nsecond log\n" {
+		t.Errorf("Incorrect logs %q", logOutput.String())
+	}
+	if bar.line != "" {
+		t.Errorf("Line should have been cleared once the phase ended")
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"sda-filesystem/internal/api"
+	"sda-filesystem/internal/filesystem"
+)
+
+// browseCommands are the subcommands that access the repositories directly instead of through a mounted filesystem
+var browseCommands = []string{"ls", "stat", "cat", "get", "download"}
+
+// entry is a file or directory in the repositories
+type entry struct {
+	name       string   // name shown in the filesystem
+	nodes      []string // original names of the nodes along the path, starting from the repository
+	size       int64
+	dir        bool
+	decrypted  bool
+	modified   time.Time
+	attributes map[string]string
+	listed     bool           // true if 'objects' contains the contents of the directory
+	objects    []api.Metadata // objects under the directory, with names relative to it
+}
+
+// runBrowse runs subcommand 'command' with arguments 'args' and writes the result to 'out'
+func runBrowse(ctx context.Context, command string, args []string, out io.Writer) error {
+	switch {
+	case command == "ls" && len(args) <= 1:
+		return list(ctx, strings.Join(args, ""), out)
+	case command == "stat" && len(args) == 1:
+		return stat(ctx, args[0], out)
+	case command == "cat" && len(args) > 0:
+		for _, arg := range args {
+			if err := cat(ctx, arg, out); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case command == "get" && (len(args) == 1 || len(args) == 2):
+		target := "."
+		if len(args) == 2 {
+			target = args[1]
+		}
+
+		return get(ctx, args[0], target, out)
+	case command == "download" && (len(args) == 1 || len(args) == 2):
+		target := "."
+		if len(args) == 2 {
+			target = args[1]
+		}
+
+		return download(ctx, args[0], target, out)
+	}
+
+	return fmt.Errorf("Usage: %s", map[string]string{
+		"ls":       "ls [path]",
+		"stat":     "stat <path>",
+		"cat":      "cat <path>...",
+		"get":      "get <path> [target]",
+		"download": "download <path> [directory]",
+	}[command])
+}
+
+func list(ctx context.Context, fsPath string, out io.Writer) error {
+	e, children, err := resolve(ctx, fsPath)
+	if err != nil {
+		return err
+	}
+	if !e.dir {
+		children = []entry{e}
+	}
+
+	for _, c := range children {
+		name := c.name
+		if c.dir {
+			name += "/"
+		}
+		fmt.Fprintln(out, name)
+	}
+
+	return nil
+}
+
+func stat(ctx context.Context, fsPath string, out io.Writer) error {
+	e, _, err := resolve(ctx, fsPath)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "Path:\t%s\n", cleanPath(fsPath))
+	fmt.Fprintf(w, "Original path:\t%s\n", strings.Join(e.nodes, "/"))
+	if e.dir {
+		fmt.Fprintf(w, "Type:\tdirectory\n")
+	} else {
+		if err = objectAttributes(ctx, &e, fsPath); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Type:\tfile\n")
+	}
+	if e.size >= 0 {
+		fmt.Fprintf(w, "Size:\t%d\n", e.size)
+	}
+	if !e.modified.IsZero() {
+		fmt.Fprintf(w, "Modified:\t%s\n", e.modified.Format(time.RFC3339))
+	}
+	if !e.dir && e.nodes[0] == api.SDConnect {
+		fmt.Fprintf(w, "Decrypted:\t%t\n", e.decrypted)
+	}
+	keys := make([]string, 0, len(e.attributes))
+	for key := range e.attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s:\t%s\n", key, e.attributes[key])
+	}
+
+	return w.Flush()
+}
+
+func cat(ctx context.Context, fsPath string, out io.Writer) error {
+	e, err := resolveFile(ctx, fsPath)
+	if err != nil {
+		return err
+	}
+
+	return copyFile(ctx, e, cleanPath(fsPath), out)
+}
+
+// get downloads the file in 'fsPath' to 'target'. If 'target' is a directory, the file is written inside it.
+func get(ctx context.Context, fsPath, target string, out io.Writer) error {
+	e, err := resolveFile(ctx, fsPath)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		if target, err = localPath(target, e.name); err != nil {
+			return err
+		}
+	}
+
+	// Data is written to a temporary file so that an interrupted download does not leave a partial file behind.
+	// The file gets the same permissions as files created by other programs, which a temporary file would not.
+	partial := filepath.Join(filepath.Dir(target), "."+filepath.Base(target)+partialSuffix)
+	file, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("Could not create file for %s: %w", target, err)
+	}
+	defer os.Remove(file.Name())
+
+	err = copyFile(ctx, e, cleanPath(fsPath), file)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("Could not write file %s: %w", target, closeErr)
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(file.Name(), target); err != nil {
+		return fmt.Errorf("Could not write file %s: %w", target, err)
+	}
+	fmt.Fprintf(out, "Downloaded %s to %s (%d bytes)\n", cleanPath(fsPath), target, e.size)
+
+	return nil
+}
+
+// resolveFile finds the file in 'fsPath' and determines the size of its data
+func resolveFile(ctx context.Context, fsPath string) (entry, error) {
+	e, _, err := resolve(ctx, fsPath)
+	if err != nil {
+		return entry{}, err
+	}
+	if e.dir {
+		return entry{}, fmt.Errorf("%s is a directory", cleanPath(fsPath))
+	}
+	if err = objectAttributes(ctx, &e, fsPath); err != nil {
+		return entry{}, err
+	}
+
+	return e, nil
+}
+
+// copyFile writes the data of file 'e' to 'w' chunk by chunk
+func copyFile(ctx context.Context, e entry, fsPath string, w io.Writer) error {
+	var ahead int64
+	for ofst := int64(0); ofst < e.size; {
+		data, err := api.DownloadData(ctx, e.nodes, fsPath, ofst, e.size, e.size)
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return fmt.Errorf("Retrieving data failed for %s: %w", fsPath, io.ErrUnexpectedEOF)
+		}
+		if _, err = w.Write(data); err != nil {
+			return fmt.Errorf("Could not write data of %s: %w", fsPath, err)
+		}
+		ahead = api.PrefetchData(ctx, e.nodes, fsPath, ofst, ahead, e.size)
+		ofst += int64(len(data))
+	}
+
+	return nil
+}
+
+// objectAttributes updates the size of SD Connect object 'e' to the size of its data when it is downloaded,
+// which differs from the listed size if the object is segmented or automatically decrypted
+var objectAttributes = func(ctx context.Context, e *entry, fsPath string) error {
+	if e.nodes[0] != api.SDConnect {
+		return nil
+	}
+
+	attrs := api.ObjectAttributes{Size: e.size}
+	if err := api.UpdateAttributes(ctx, e.nodes, cleanPath(fsPath), &attrs); err != nil {
+		var re *api.RequestError
+		if errors.As(err, &re) && re.StatusCode == 451 {
+			return fmt.Errorf("You do not have permission to access file %s: %w", cleanPath(fsPath), err)
+		}
+
+		return fmt.Errorf("Encryption status and segmented object size of object %s could not be determined: %w", cleanPath(fsPath), err)
+	}
+	e.size, e.decrypted = attrs.Size, attrs.Decrypted
+
+	return nil
+}
+
+// resolve finds the file or directory in 'fsPath' and, if it is a directory, returns its contents
+func resolve(ctx context.Context, fsPath string) (entry, []entry, error) {
+	current := entry{dir: true, size: -1}
+	parts := []string{}
+	if p := cleanPath(fsPath); p != "" {
+		parts = strings.Split(p, "/")
+	}
+
+	for i := 0; ; i++ {
+		children, err := listEntries(ctx, current, strings.Join(parts[:i], "/"))
+		if err != nil {
+			return entry{}, nil, err
+		}
+		if i == len(parts) {
+			return current, children, nil
+		}
+
+		idx := slices.IndexFunc(children, func(c entry) bool { return c.name == parts[i] })
+		if idx == -1 {
+			idx = slices.IndexFunc(children, func(c entry) bool { return c.nodes[len(c.nodes)-1] == parts[i] })
+		}
+		if idx == -1 {
+			return entry{}, nil, fmt.Errorf("%s does not exist", strings.Join(parts[:i+1], "/"))
+		}
+		current = children[idx]
+		if !current.dir {
+			if i < len(parts)-1 {
+				return entry{}, nil, fmt.Errorf("%s is not a directory", strings.Join(parts[:i+1], "/"))
+			}
+
+			return current, nil, nil
+		}
+	}
+}
+
+// listEntries returns the contents of directory 'e' in 'fsPath', sorted by name
+func listEntries(ctx context.Context, e entry, fsPath string) ([]entry, error) {
+	var children []entry
+	switch {
+	case len(e.nodes) == 0:
+		for _, rep := range api.GetEnabledRepositories() {
+			children = append(children, entry{name: rep, nodes: []string{rep}, size: -1, dir: true})
+		}
+	case e.listed:
+		children = objectEntries(e, fsPath, e.objects)
+	default:
+		meta, err := api.GetNthLevel(ctx, e.nodes[0], fsPath, e.nodes[1:]...)
+		if err != nil {
+			return nil, err
+		}
+		if isContainer(e.nodes) {
+			children = objectEntries(e, fsPath, meta)
+
+			break
+		}
+		safeName := filesystem.SafeName
+		if len(e.nodes) == 1 {
+			safeName = filesystem.ProjectName
+		}
+		names := filesystem.DirectoryNames(fsPath, meta, safeName)
+		for i, m := range meta {
+			children = append(children, entry{
+				name: names[i], nodes: appendNode(e.nodes, m.Name), size: m.Bytes, dir: true, modified: m.LastModified,
+			})
+		}
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].name < children[j].name })
+
+	return children, nil
+}
+
+// objectEntries returns the files and directories formed by 'objects' under directory 'e' in 'fsPath'.
+// They are named the same way as in the mounted filesystem.
+func objectEntries(e entry, fsPath string, objects []api.Metadata) []entry {
+	var children []entry
+	for _, c := range filesystem.ListObjects(fsPath, objects) {
+		children = append(children, entry{
+			name: c.Name, nodes: appendNode(e.nodes, c.OriginalName), size: c.Size, dir: c.Dir,
+			modified: c.Modified, attributes: c.Attributes, listed: c.Dir, objects: c.Objects,
+		})
+	}
+
+	return children
+}
+
+// isContainer tells if 'nodes' is the path of a container whose listing contains the objects under it
+func isContainer(nodes []string) bool {
+	return (nodes[0] == api.SDConnect && len(nodes) == 3) || (nodes[0] == api.SDSubmit && len(nodes) == 2)
+}
+
+func appendNode(nodes []string, name string) []string {
+	return append(slices.Clip(nodes), name)
+}
+
+// cleanPath returns 'fsPath' with slashes as separators and without leading and trailing slashes
+func cleanPath(fsPath string) string {
+	return strings.Trim(path.Clean("/"+filepath.ToSlash(fsPath)), "/")
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"sda-filesystem/internal/api"
+)
+
+var modified = time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+var testListings = map[string][]api.Metadata{
+	"SD-Connect": {{Name: "project", Bytes: 60}},
+	"SD-Connect/project": {
+		{Name: "bucket", Bytes: 60}, {Name: "other:bucket", Bytes: 0}, {Name: "broken", Bytes: 0}, {Name: "clash", Bytes: 4},
+	},
+	"SD-Connect/project/clash": {
+		{Name: "a+b.txt", Bytes: 1}, {Name: "a_b.txt", Bytes: 1}, {Name: "x", Bytes: 1}, {Name: "x/y", Bytes: 1},
+	},
+	"SD-Connect/project/other:bucket": {},
+	"SD-Connect/project/bucket": {
+		{Name: "file.txt.c4gh", Bytes: 40, LastModified: modified},
+		{Name: "dir/a.txt", Bytes: 10},
+		{Name: "dir/sub/b.txt", Bytes: 10, LastModified: modified},
+		{Name: "empty/"},
+	},
+	"SD-Apply": {
+		{Name: "https://example.com/dataset", Bytes: -1}, {Name: "https://example.com/checked", Bytes: -1},
+		{Name: "https://example.com/unsafe", Bytes: -1},
+	},
+	"SD-Apply/https://example.com/checked": {
+		{Name: "ok.txt", Bytes: 10, Attributes: map[string]string{
+			"checksum":      "DDA02B8296611493229A1EEB1D32771274AB8F3E3BC1B6FBFAB087A4F48E4E09",
+			"checksum_type": "SHA-256",
+		}},
+		{Name: "bad.txt", Bytes: 11, Attributes: map[string]string{"checksum": "abc", "checksum_type": "MD5"}},
+	},
+	"SD-Apply/https://example.com/unsafe": {{Name: "safe.txt", Bytes: 4}, {Name: "a/../../evil.txt", Bytes: 4}},
+	"SD-Apply/https://example.com/dataset": {
+		{Name: "data/file.bin", Bytes: 11, Attributes: map[string]string{"checksum": "abc", "file_id": "id1"}},
+	},
+}
+
+var testData = map[string]string{
+	"SD-Connect/project/bucket/file.txt.c4gh":              "decrypted file",
+	"SD-Apply/https://example.com/dataset/data/file.bin":   "hello world",
+	"SD-Apply/https://example.com/checked/ok.txt":          "content ok",
+	"SD-Apply/https://example.com/checked/bad.txt":         "content bad",
+	"SD-Apply/https://example.com/unsafe/safe.txt":         "safe",
+	"SD-Apply/https://example.com/unsafe/a/../../evil.txt": "evil",
+}
+
+func mockBrowse(t *testing.T) {
+	origEnabled := api.GetEnabledRepositories
+	origGetNthLevel := api.GetNthLevel
+	origUpdateAttributes := api.UpdateAttributes
+	origDownloadData := api.DownloadData
+	origPrefetchData := api.PrefetchData
+	t.Cleanup(func() {
+		api.GetEnabledRepositories = origEnabled
+		api.GetNthLevel = origGetNthLevel
+		api.UpdateAttributes = origUpdateAttributes
+		api.DownloadData = origDownloadData
+		api.PrefetchData = origPrefetchData
+	})
+
+	api.GetEnabledRepositories = func() []string {
+		return []string{api.SDConnect, api.SDSubmit}
+	}
+	api.GetNthLevel = func(_ context.Context, rep string, _ string, nodes ...string) ([]api.Metadata, error) {
+		key := strings.Join(append([]string{rep}, nodes...), "/")
+		meta, ok := testListings[key]
+		if !ok {
+			return nil, errors.New("Unexpected listing " + key)
+		}
+
+		return meta, nil
+	}
+	api.UpdateAttributes = func(_ context.Context, nodes []string, _ string, attr any) error {
+		if nodes[len(nodes)-1] == "a.txt" {
+			return &api.RequestError{StatusCode: 451}
+		}
+		attrs := attr.(*api.ObjectAttributes)
+		attrs.Size = int64(len(testData[strings.Join(nodes, "/")]))
+		attrs.Decrypted = true
+
+		return nil
+	}
+	api.DownloadData = func(_ context.Context, nodes []string, _ string, start, end, maxEnd int64) ([]byte, error) {
+		data := testData[strings.Join(nodes, "/")]
+		if int64(len(data)) != maxEnd {
+			return nil, errors.New("Incorrect file size")
+		}
+		// Data is returned in chunks of four bytes
+		end = min(end, (start/4+1)*4)
+
+		return []byte(data[start:end]), nil
+	}
+	api.PrefetchData = func(_ context.Context, _ []string, _ string, _, from, _ int64) int64 {
+		return from
+	}
+}
+
+func TestRunBrowse(t *testing.T) {
+	var tests = []struct {
+		testname, command, output string
+		args                      []string
+	}{
+		{"LS_ROOT", "ls", "SD-Apply/\nSD-Connect/\n", nil},
+		{"LS_PROJECTS", "ls", "project/\n", []string{"SD-Connect"}},
+		{"LS_CONTAINERS", "ls", "broken/\nbucket/\nclash/\nother_bucket/\n", []string{"/SD-Connect/project/"}},
+		{"LS_OBJECTS", "ls", "dir/\nfile.txt\n", []string{"SD-Connect/project/bucket"}},
+		{"LS_CLASHING_NAMES", "ls", "a_b(bd3722).txt\na_b.txt\nx/\nx(2d7116)\n", []string{"SD-Connect/project/clash"}},
+		{"LS_SUBDIRECTORY", "ls", "a.txt\nsub/\n", []string{"SD-Connect/project/bucket/dir"}},
+		{"LS_FILE", "ls", "b.txt\n", []string{"SD-Connect/project/bucket/dir/sub/b.txt"}},
+		{"LS_ORIGINAL_NAME", "ls", "", []string{"SD-Connect/project/other:bucket"}},
+		{"LS_DATASETS", "ls", "example.com_checked/\nexample.com_dataset/\nexample.com_unsafe/\n", []string{"SD-Apply"}},
+		{"LS_DATASET", "ls", "file.bin\n", []string{"SD-Apply/example.com_dataset/data"}},
+		{
+			"STAT_FILE", "stat",
+			"Path:          SD-Connect/project/bucket/file.txt\n" +
+				"Original path: SD-Connect/project/bucket/file.txt.c4gh\n" +
+				"Type:          file\n" +
+				"Size:          14\n" +
+				"Modified:      2024-05-06T07:08:09Z\n" +
+				"Decrypted:     true\n",
+			[]string{"SD-Connect/project/bucket/file.txt"},
+		},
+		{
+			"STAT_DIRECTORY", "stat",
+			"Path:          SD-Connect/project/bucket/dir\n" +
+				"Original path: SD-Connect/project/bucket/dir\n" +
+				"Type:          directory\n" +
+				"Size:          20\n" +
+				"Modified:      2024-05-06T07:08:09Z\n",
+			[]string{"SD-Connect/project/bucket/dir"},
+		},
+		{
+			"STAT_ATTRIBUTES", "stat",
+			"Path:          SD-Apply/example.com_dataset/data/file.bin\n" +
+				"Original path: SD-Apply/https://example.com/dataset/data/file.bin\n" +
+				"Type:          file\n" +
+				"Size:          11\n" +
+				"checksum:      abc\n" +
+				"file_id:       id1\n",
+			[]string{"SD-Apply/example.com_dataset/data/file.bin"},
+		},
+		{"CAT", "cat", "decrypted file", []string{"SD-Connect/project/bucket/file.txt"}},
+		{
+			"CAT_MULTIPLE", "cat", "hello worlddecrypted file",
+			[]string{"SD-Apply/example.com_dataset/data/file.bin", "SD-Connect/project/bucket/file.txt"},
+		},
+	}
+
+	mockBrowse(t)
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := runBrowse(context.Background(), tt.command, tt.args, &out); err != nil {
+				t.Errorf("Function returned unexpected error: %s", err.Error())
+			} else if out.String() != tt.output {
+				t.Errorf("Incorrect output\nExpected=%q\nReceived=%q", tt.output, out.String())
+			}
+		})
+	}
+}
+
+func TestRunBrowse_Get(t *testing.T) {
+	mockBrowse(t)
+	dir := t.TempDir()
+
+	// Downloaded files should get the same permissions as any other new file
+	reference := filepath.Join(t.TempDir(), "reference")
+	if err := os.WriteFile(reference, nil, 0644); err != nil {
+		t.Fatalf("Could not create file: %s", err.Error())
+	}
+	expectedInfo, err := os.Stat(reference)
+	if err != nil {
+		t.Fatalf("Could not stat file: %s", err.Error())
+	}
+
+	var tests = []struct {
+		testname, target, file, content string
+		args                            []string
+	}{
+		{"OK_DIRECTORY", dir, filepath.Join(dir, "file.txt"), "decrypted file", []string{"SD-Connect/project/bucket/file.txt"}},
+		{"OK_FILE", filepath.Join(dir, "out.bin"), filepath.Join(dir, "out.bin"), "hello world", []string{"SD-Apply/example.com_dataset/data/file.bin"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := runBrowse(context.Background(), "get", append(tt.args, tt.target), &out); err != nil {
+				t.Fatalf("Function returned unexpected error: %s", err.Error())
+			}
+
+			data, err := os.ReadFile(tt.file)
+			if err != nil {
+				t.Fatalf("Could not read downloaded file: %s", err.Error())
+			}
+			if string(data) != tt.content {
+				t.Errorf("Incorrect file content\nExpected=%q\nReceived=%q", tt.content, data)
+			}
+			if info, err := os.Stat(tt.file); err != nil {
+				t.Errorf("Could not stat downloaded file: %s", err.Error())
+			} else if info.Mode() != expectedInfo.Mode() {
+				t.Errorf("Downloaded file should have mode %v, received %v", expectedInfo.Mode(), info.Mode())
+			}
+			if !strings.HasPrefix(out.String(), "Downloaded "+tt.args[0]+" to "+tt.file) {
+				t.Errorf("Incorrect output %q", out.String())
+			}
+		})
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Could not read directory: %s", err.Error())
+	}
+	if len(entries) != 2 {
+		t.Errorf("Temporary files were left in directory, found %d files", len(entries))
+	}
+}
+
+func TestRunBrowse_Error(t *testing.T) {
+	var tests = []struct {
+		testname, command, errStr string
+		args                      []string
+	}{
+		{"NOT_FOUND", "ls", "SD-Connect/missing does not exist", []string{"SD-Connect/missing"}},
+		{"NOT_DIRECTORY", "ls", "SD-Connect/project/bucket/file.txt is not a directory", []string{"SD-Connect/project/bucket/file.txt/x"}},
+		{"LISTING_FAILED", "ls", "Unexpected listing SD-Connect/project/broken", []string{"SD-Connect/project/broken"}},
+		{"CAT_DIRECTORY", "cat", "SD-Connect/project is a directory", []string{"SD-Connect/project"}},
+		{
+			"CAT_DENIED", "cat",
+			"You do not have permission to access file SD-Connect/project/bucket/dir/a.txt: API responded with status 451 Unavailable For Legal Reasons",
+			[]string{"SD-Connect/project/bucket/dir/a.txt"},
+		},
+		{"GET_DIRECTORY", "get", "SD-Apply/example.com_dataset is a directory", []string{"SD-Apply/example.com_dataset"}},
+		{"USAGE_LS", "ls", "Usage: ls [path]", []string{"a", "b"}},
+		{"USAGE_STAT", "stat", "Usage: stat <path>", nil},
+		{"USAGE_CAT", "cat", "Usage: cat <path>...", nil},
+		{"USAGE_GET", "get", "Usage: get <path> [target]", []string{"a", "b", "c"}},
+	}
+
+	mockBrowse(t)
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			var out bytes.Buffer
+			err := runBrowse(context.Background(), tt.command, tt.args, &out)
+			if err == nil {
+				t.Errorf("Function should have returned error")
+			} else if err.Error() != tt.errStr {
+				t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errStr, err.Error())
+			}
+		})
+	}
+}
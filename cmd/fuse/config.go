@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"sda-filesystem/internal/config"
+)
+
+// applyConfig uses the settings from the configuration files as defaults for the environment variables and flags
+func applyConfig(cfg *config.Config) error {
+	if err := cfg.SetEnv(); err != nil {
+		return err
+	}
+
+	return config.SetFlags(flag.CommandLine, map[string]any{
+		"mount":            cfg.Mount,
+		"loglevel":         cfg.LogLevel,
+		"http_timeout":     cfg.HTTP.Timeout,
+		"http_retries":     cfg.HTTP.Retries,
+		"http_retry_delay": cfg.HTTP.RetryDelay,
+		"cache_dir":        cfg.Cache.Dir,
+		"cache_disk_size":  cfg.Cache.DiskSize,
+		"cache_memory":     cfg.Cache.Memory,
+		"chunk_size":       cfg.Cache.ChunkSize,
+		"cache_ttl":        cfg.Cache.TTL,
+		"read_ahead":       cfg.Cache.ReadAhead,
+	})
+}
+
+// runConfig runs the config subcommand with arguments 'args' and writes the result to 'out'
+func runConfig(args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "validate" || len(args) > 2 {
+		return errors.New("Usage: config validate [file]")
+	}
+
+	var cfg *config.Config
+	var files []string
+	var err error
+	if len(args) == 2 {
+		files = args[1:]
+		cfg, err = config.LoadFile(args[1])
+	} else {
+		cfg, files, err = config.Load()
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		fmt.Fprintln(out, "No configuration files found")
+	}
+	for _, file := range files {
+		fmt.Fprintf(out, "Read %s\n", file)
+	}
+	if err = cfg.Validate(); err != nil {
+		return fmt.Errorf("Configuration is invalid:\n%w", err)
+	}
+	fmt.Fprintln(out, "Configuration is valid")
+
+	return nil
+}
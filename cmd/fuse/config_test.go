@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sda-filesystem/internal/config"
+)
+
+func TestRunConfig(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.yaml")
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(valid, []byte("mount: "+dir+"\nhttp:\n  retries: 2\n"), 0600); err != nil {
+		t.Fatalf("Could not write file: %s", err.Error())
+	}
+	if err := os.WriteFile(invalid, []byte("cache:\n  ttl: 0\n"), 0600); err != nil {
+		t.Fatalf("Could not write file: %s", err.Error())
+	}
+
+	var tests = []struct {
+		testname, output, errStr string
+		args, files              []string
+	}{
+		{"OK_FILE", "Read " + valid + "\nConfiguration is valid\n", "", []string{"validate", valid}, nil},
+		{"OK_DEFAULT", "Read " + valid + "\nConfiguration is valid\n", "", []string{"validate"}, []string{valid}},
+		{"OK_NO_FILES", "No configuration files found\nConfiguration is valid\n", "", []string{"validate"}, []string{}},
+		{"FAIL_INVALID", "Read " + invalid + "\n", "Configuration is invalid:\ncache.ttl must be positive", []string{"validate", invalid}, nil},
+		{"FAIL_USAGE", "", "Usage: config validate [file]", []string{"check"}, nil},
+		{"FAIL_TOO_MANY", "", "Usage: config validate [file]", []string{"validate", valid, invalid}, nil},
+	}
+
+	origLoad := config.Load
+	defer func() { config.Load = origLoad }()
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			config.Load = func() (*config.Config, []string, error) {
+				if tt.files == nil {
+					return nil, nil, errors.New("Load should not have been called")
+				}
+				cfg := &config.Config{}
+				for _, file := range tt.files {
+					var err error
+					if cfg, err = config.LoadFile(file); err != nil {
+						return nil, nil, err
+					}
+				}
+
+				return cfg, tt.files, nil
+			}
+
+			var out bytes.Buffer
+			err := runConfig(tt.args, &out)
+			switch {
+			case tt.errStr == "" && err != nil:
+				t.Errorf("Function returned unexpected error: %s", err.Error())
+			case tt.errStr != "" && err == nil:
+				t.Errorf("Function should have returned error")
+			case tt.errStr != "" && err.Error() != tt.errStr:
+				t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errStr, err.Error())
+			case out.String() != tt.output:
+				t.Errorf("Incorrect output\nExpected=%q\nReceived=%q", tt.output, out.String())
+			}
+		})
+	}
+}
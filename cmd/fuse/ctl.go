@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"sda-filesystem/internal/api"
+	"sda-filesystem/internal/control"
+	"sda-filesystem/internal/filesystem"
+	"sda-filesystem/internal/logs"
+)
+
+const ctlCommands = "{update,clear <path>,stats,open,loglevel <level>,unmount}"
+
+var unmount = filesystem.UnmountFilesystem
+
+// controlHandlers returns the commands that can be sent to the control socket of filesystem 'fs'
+func controlHandlers(fs *filesystem.Fuse) map[string]control.Handler {
+	return map[string]control.Handler{
+		"update": func(_ []string) (any, error) {
+			return fs.RefreshFilesystem(nil, nil), nil
+		},
+		"clear": func(args []string) (any, error) {
+			if len(args) != 1 {
+				return nil, errors.New("Cannot clear cache without path")
+			}
+
+			return nil, fs.ClearPath(filepath.Clean(args[0]))
+		},
+		"stats": func(_ []string) (any, error) {
+			return api.GetCacheStats(), nil
+		},
+		"open": func(_ []string) (any, error) {
+			return fs.OpenFiles(), nil
+		},
+		"loglevel": func(args []string) (any, error) {
+			if len(args) != 1 || !logs.ValidLevel(args[0]) {
+				return nil, errors.New("Logging level must be one of {debug,info,warning,error}")
+			}
+			logs.SetLevel(args[0])
+
+			return nil, nil
+		},
+		"unmount": func(_ []string) (any, error) {
+			// Unmount after the response has been sent
+			go unmount()
+
+			return nil, nil
+		},
+	}
+}
+
+// runCtl sends the command in 'args' to a running Data Gateway and writes the response to 'out'
+func runCtl(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	socket := flags.String("socket", "", "Path to the control socket of a running Data Gateway")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s ctl -socket <path> %s\n", filepath.Base(flag.CommandLine.Name()), ctlCommands)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *socket == "" {
+		return errors.New("Control socket must be given with -socket")
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("Command missing, possible commands are %s", ctlCommands)
+	}
+
+	data, err := control.Send(*socket, control.Request{Command: flags.Arg(0), Args: flags.Args()[1:]})
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		var buf bytes.Buffer
+		if err = json.Indent(&buf, data, "", "  "); err != nil {
+			return fmt.Errorf("Could not format response: %w", err)
+		}
+		fmt.Fprintln(out, buf.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"sda-filesystem/internal/control"
+	"sda-filesystem/internal/logs"
+)
+
+func TestRunCtl(t *testing.T) {
+	var tests = []struct {
+		testname, output string
+		args             []string
+		request          control.Request
+		data             json.RawMessage
+	}{
+		{
+			"OK_DATA", "{\n  \"added\": 1\n}\n", []string{"-socket", "/tmp/ctl.sock", "update"},
+			control.Request{Command: "update", Args: []string{}}, json.RawMessage(`{"added":1}`),
+		},
+		{
+			"OK_NO_DATA", "", []string{"-socket", "/tmp/ctl.sock", "clear", "SD-Connect/project/bucket"},
+			control.Request{Command: "clear", Args: []string{"SD-Connect/project/bucket"}}, nil,
+		},
+	}
+
+	origSend := control.Send
+	defer func() { control.Send = origSend }()
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			control.Send = func(path string, req control.Request) (json.RawMessage, error) {
+				if path != "/tmp/ctl.sock" {
+					t.Errorf("Incorrect socket. Expected=/tmp/ctl.sock, received=%s", path)
+				}
+				if !reflect.DeepEqual(req, tt.request) {
+					t.Errorf("Incorrect request\nExpected=%+v\nReceived=%+v", tt.request, req)
+				}
+
+				return tt.data, nil
+			}
+
+			var out bytes.Buffer
+			if err := runCtl(tt.args, &out); err != nil {
+				t.Errorf("Function returned unexpected error: %s", err.Error())
+			} else if out.String() != tt.output {
+				t.Errorf("Incorrect output\nExpected=%q\nReceived=%q", tt.output, out.String())
+			}
+		})
+	}
+}
+
+func TestRunCtl_Error(t *testing.T) {
+	var tests = []struct {
+		testname, errStr string
+		args             []string
+	}{
+		{"NO_SOCKET", "Control socket must be given with -socket", []string{"update"}},
+		{"NO_COMMAND", "Command missing, possible commands are " + ctlCommands, []string{"-socket", "/tmp/ctl.sock"}},
+		{"SEND_ERROR", errExpected.Error(), []string{"-socket", "/tmp/ctl.sock", "update"}},
+	}
+
+	origSend := control.Send
+	defer func() { control.Send = origSend }()
+
+	control.Send = func(_ string, _ control.Request) (json.RawMessage, error) {
+		return nil, errExpected
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			err := runCtl(tt.args, &bytes.Buffer{})
+			if err == nil {
+				t.Errorf("Function should have returned error")
+			} else if err.Error() != tt.errStr {
+				t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errStr, err.Error())
+			}
+		})
+	}
+}
+
+func TestControlHandlers(t *testing.T) {
+	var tests = []struct {
+		testname, command, errStr string
+		args                      []string
+	}{
+		{"CLEAR_NO_PATH", "clear", "Cannot clear cache without path", nil},
+		{"LOGLEVEL_INVALID", "loglevel", "Logging level must be one of {debug,info,warning,error}", []string{"warn"}},
+		{"LOGLEVEL_MISSING", "loglevel", "Logging level must be one of {debug,info,warning,error}", nil},
+		{"LOGLEVEL", "loglevel", "", []string{"debug"}},
+		{"UNMOUNT", "unmount", "", nil},
+	}
+
+	origSetLevel := logs.SetLevel
+	origUnmount := unmount
+	defer func() {
+		logs.SetLevel = origSetLevel
+		unmount = origUnmount
+	}()
+
+	level := ""
+	logs.SetLevel = func(l string) { level = l }
+	unmounted := make(chan struct{})
+	unmount = func() { close(unmounted) }
+
+	handlers := controlHandlers(nil)
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			_, err := handlers[tt.command](tt.args)
+			switch {
+			case tt.errStr != "":
+				if err == nil {
+					t.Errorf("Function should have returned error")
+				} else if err.Error() != tt.errStr {
+					t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errStr, err.Error())
+				}
+			case err != nil:
+				t.Errorf("Function returned unexpected error: %s", err.Error())
+			}
+		})
+	}
+
+	if level != "debug" {
+		t.Errorf("Logging level was not set. Expected=debug, received=%s", level)
+	}
+	<-unmounted
+}
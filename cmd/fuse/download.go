@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"sda-filesystem/internal/api"
+	"sda-filesystem/internal/logs"
+)
+
+// partialSuffix is added to the name of a file while it is being downloaded
+const partialSuffix = ".part"
+
+// checksums are the hash functions with which downloaded files can be verified, by checksum type in lower case
+var checksums = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// download downloads the file or directory in 'fsPath' recursively to directory 'target'.
+// Files are downloaded in parallel, and files whose download was interrupted continue from where they were left.
+func download(ctx context.Context, fsPath, target string, out io.Writer) error {
+	fsPath = cleanPath(fsPath)
+	e, children, err := resolve(ctx, fsPath)
+	if err != nil {
+		return err
+	}
+
+	root := target
+	if e.name != "" {
+		if root, err = localPath(target, e.name); err != nil {
+			return err
+		}
+	}
+	var downloaded, skipped, failed, total atomic.Int64
+	files := []downloadJob{{entry: e, fsPath: fsPath, target: root}}
+	if e.dir {
+		var rejected int
+		if files, rejected, err = collectFiles(ctx, children, fsPath, root); err != nil {
+			return err
+		}
+		failed.Add(int64(rejected))
+	}
+
+	jobs := make(chan downloadJob)
+	var wg sync.WaitGroup
+	var outLock sync.Mutex
+	for range max(parallel, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				n, err := downloadFile(ctx, job)
+				switch {
+				case err != nil:
+					logs.Error(err)
+					failed.Add(1)
+				case n < 0:
+					skipped.Add(1)
+				default:
+					downloaded.Add(1)
+					total.Add(n)
+					outLock.Lock()
+					fmt.Fprintf(out, "Downloaded %s\n", job.fsPath)
+					outLock.Unlock()
+				}
+			}
+		}()
+	}
+	for _, job := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		// Checked once more right before the file is created, since the names come from the repositories
+		if err = insideDir(target, job.target); err != nil {
+			logs.Error(err)
+			failed.Add(1)
+
+			continue
+		}
+		jobs <- job
+	}
+	close(jobs)
+	wg.Wait()
+
+	fmt.Fprintf(out, "Downloaded %d files (%d bytes) to %s", downloaded.Load(), total.Load(), target)
+	if skipped.Load() > 0 {
+		fmt.Fprintf(out, ", skipped %d files that had already been downloaded", skipped.Load())
+	}
+	fmt.Fprintln(out)
+
+	if err = ctx.Err(); err != nil {
+		return fmt.Errorf("Download was interrupted: %w", err)
+	}
+	if failed.Load() > 0 {
+		return fmt.Errorf("Failed to download %d files", failed.Load())
+	}
+
+	return nil
+}
+
+// downloadJob is a file that is downloaded to 'target'
+type downloadJob struct {
+	entry
+	fsPath, target string
+}
+
+// collectFiles returns the files under directories 'entries' recursively. Files and directories whose names
+// cannot be used locally are skipped, and their number is returned along with the files.
+func collectFiles(ctx context.Context, entries []entry, prntPath, target string) ([]downloadJob, int, error) {
+	var jobs []downloadJob
+	rejected := 0
+	for _, e := range entries {
+		fsPath := path.Join(prntPath, e.name)
+		filePath, err := localPath(target, e.name)
+		if err != nil {
+			logs.Errorf("Skipping %s: %w", fsPath, err)
+			rejected++
+
+			continue
+		}
+		if !e.dir {
+			jobs = append(jobs, downloadJob{entry: e, fsPath: fsPath, target: filePath})
+
+			continue
+		}
+
+		children, err := listEntries(ctx, e, fsPath)
+		if err != nil {
+			return nil, 0, err
+		}
+		files, n, err := collectFiles(ctx, children, fsPath, filePath)
+		if err != nil {
+			return nil, 0, err
+		}
+		jobs = append(jobs, files...)
+		rejected += n
+	}
+
+	return jobs, rejected, nil
+}
+
+// localPath returns the path of file or directory 'name' inside directory 'dir'. Names come from the
+// repositories, so names that are not plain file names, such as "..", are rejected.
+func localPath(dir, name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/"+string(filepath.Separator)) {
+		return "", fmt.Errorf("Name %q cannot be used as a local file name", name)
+	}
+	p := filepath.Join(dir, name)
+
+	return p, insideDir(dir, p)
+}
+
+// insideDir returns an error if 'p' is not inside directory 'dir'
+func insideDir(dir, p string) error {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("Path %s is not inside directory %s", p, dir)
+	}
+
+	return nil
+}
+
+// downloadFile downloads the file in 'job' and verifies its checksum if the repository provides one.
+// Data is first written to a partial file, which is renamed once the download has been completed.
+// An existing file or partial file is only trusted if it can be verified with a checksum, or if
+// -skip_existing is set. Returns the number of bytes downloaded, or -1 if the file had already been downloaded.
+var downloadFile = func(ctx context.Context, job downloadJob) (int64, error) {
+	if err := objectAttributes(ctx, &job.entry, job.fsPath); err != nil {
+		return 0, err
+	}
+	verifiable := hasChecksum(job.entry)
+	if info, err := os.Stat(job.target); err == nil && !info.IsDir() && info.Size() == job.size {
+		switch {
+		case !verifiable && skipExisting:
+			logs.Debugf("File %s has already been downloaded", job.target)
+
+			return -1, nil
+		case !verifiable:
+			logs.Debugf("File %s cannot be verified, downloading it again", job.target)
+		default:
+			if err = verifyChecksum(job.entry, job.fsPath, job.target); err == nil {
+				logs.Debugf("File %s has already been downloaded", job.target)
+
+				return -1, nil
+			}
+			logs.Warningf("Downloading %s again: %s", job.fsPath, err.Error())
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(job.target), 0755); err != nil {
+		return 0, fmt.Errorf("Could not create directory for %s: %w", job.target, err)
+	}
+	partial := job.target + partialSuffix
+	file, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("Could not open file %s: %w", partial, err)
+	}
+
+	ofst, err := file.Seek(0, io.SeekEnd)
+	// Partial file may not belong to the current version of the file, or it may not be possible to verify it
+	if err == nil && (ofst > job.size || (ofst > 0 && !verifiable && !skipExisting)) {
+		logs.Debugf("Starting download of %s from the beginning", job.fsPath)
+		err = file.Truncate(0)
+		ofst = 0
+	}
+	if err != nil {
+		file.Close()
+
+		return 0, fmt.Errorf("Could not resume download of %s: %w", job.fsPath, err)
+	}
+	if ofst > 0 {
+		logs.Infof("Resuming download of %s from byte %d", job.fsPath, ofst)
+	}
+
+	start := ofst
+	rangeSize := max(int64(chunkSize)<<20, 1)
+	for ofst < job.size && err == nil {
+		end := min(ofst+rangeSize, job.size)
+		w := &countingWriter{w: file}
+		err = api.DownloadRange(ctx, job.nodes, job.fsPath, ofst, end, w)
+		ofst += w.n
+		if err == nil && ofst != end {
+			err = fmt.Errorf("Retrieving data failed for %s: %w", job.fsPath, io.ErrUnexpectedEOF)
+		}
+	}
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("Could not write file %s: %w", partial, closeErr)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err = verifyChecksum(job.entry, job.fsPath, partial); err != nil {
+		os.Remove(partial)
+
+		return 0, err
+	}
+	if err = os.Rename(partial, job.target); err != nil {
+		return 0, fmt.Errorf("Could not write file %s: %w", job.target, err)
+	}
+
+	return ofst - start, nil
+}
+
+// hasChecksum tells whether 'e' has a checksum of a supported type with which its file can be verified
+func hasChecksum(e entry) bool {
+	_, ok := checksums[checksumType(e)]
+
+	return ok && e.attributes["checksum"] != ""
+}
+
+// checksumType returns the checksum type of 'e' in the form used as a key of 'checksums'
+func checksumType(e entry) string {
+	return strings.ReplaceAll(strings.ToLower(e.attributes["checksum_type"]), "-", "")
+}
+
+// verifyChecksum compares the checksum of file 'file' to the checksum of 'e' given by the repository.
+// Does nothing if the repository does not provide a checksum.
+func verifyChecksum(e entry, fsPath, file string) error {
+	expected := e.attributes["checksum"]
+	if expected == "" {
+		return nil
+	}
+	newHash, ok := checksums[checksumType(e)]
+	if !ok {
+		logs.Warningf("Cannot verify %s, checksum type %q is not supported", fsPath, e.attributes["checksum_type"])
+
+		return nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("Could not verify %s: %w", fsPath, err)
+	}
+	defer f.Close()
+
+	h := newHash()
+	if _, err = io.Copy(h, f); err != nil {
+		return fmt.Errorf("Could not verify %s: %w", fsPath, err)
+	}
+	if received := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(received, expected) {
+		return fmt.Errorf("Checksum of %s does not match. Expected=%s, received=%s", fsPath, expected, received)
+	}
+	logs.Debugf("Checksum of %s verified", fsPath)
+
+	return nil
+}
+
+// countingWriter counts the number of bytes written to 'w'
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"sda-filesystem/internal/api"
+)
+
+func mockDownloadRange(t *testing.T, starts *[]int64) {
+	origDownloadRange := api.DownloadRange
+	t.Cleanup(func() { api.DownloadRange = origDownloadRange })
+
+	var lock sync.Mutex
+	api.DownloadRange = func(_ context.Context, nodes []string, _ string, start, end int64, w io.Writer) error {
+		lock.Lock()
+		*starts = append(*starts, start)
+		lock.Unlock()
+		_, err := w.Write([]byte(testData[strings.Join(nodes, "/")][start:end]))
+
+		return err
+	}
+}
+
+func TestDownload(t *testing.T) {
+	mockBrowse(t)
+	var starts []int64
+	mockDownloadRange(t, &starts)
+	dir := t.TempDir()
+
+	var out bytes.Buffer
+	err := runBrowse(context.Background(), "download", []string{"SD-Apply/example.com_checked", dir}, &out)
+
+	expectedErr := "Failed to download 1 files"
+	if err == nil {
+		t.Errorf("Function should have returned error")
+	} else if err.Error() != expectedErr {
+		t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", expectedErr, err.Error())
+	}
+
+	expected := "Downloaded SD-Apply/example.com_checked/ok.txt\nDownloaded 1 files (10 bytes) to " + dir + "\n"
+	if out.String() != expected {
+		t.Errorf("Incorrect output\nExpected=%q\nReceived=%q", expected, out.String())
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "example.com_checked", "ok.txt"))
+	if err != nil {
+		t.Fatalf("Could not read downloaded file: %s", err.Error())
+	}
+	if string(data) != "content ok" {
+		t.Errorf("Incorrect file content. Expected=content ok, received=%s", data)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "example.com_checked"))
+	if err != nil {
+		t.Fatalf("Could not read directory: %s", err.Error())
+	}
+	if len(entries) != 1 {
+		t.Errorf("File with invalid checksum should have been removed, found %d files", len(entries))
+	}
+
+	// Existing file is downloaded again if it does not match its checksum
+	target := filepath.Join(dir, "example.com_checked", "ok.txt")
+	if err = os.WriteFile(target, []byte("content no"), 0644); err != nil {
+		t.Fatalf("Could not write file: %s", err.Error())
+	}
+	out.Reset()
+	if err = runBrowse(context.Background(), "download", []string{"SD-Apply/example.com_checked/ok.txt", filepath.Dir(target)}, &out); err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+	if data, err := os.ReadFile(target); err != nil {
+		t.Errorf("Could not read downloaded file: %s", err.Error())
+	} else if string(data) != "content ok" {
+		t.Errorf("Incorrect file content. Expected=content ok, received=%s", data)
+	}
+
+	// Existing file that matches its checksum is skipped
+	out.Reset()
+	starts = nil
+	if err = runBrowse(context.Background(), "download", []string{"SD-Apply/example.com_checked/ok.txt", filepath.Dir(target)}, &out); err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+	if len(starts) != 0 {
+		t.Errorf("Verified file should not have been downloaded again")
+	}
+}
+
+func TestDownload_UnsafeNames(t *testing.T) {
+	mockBrowse(t)
+	var starts []int64
+	mockDownloadRange(t, &starts)
+	dir := filepath.Join(t.TempDir(), "target")
+
+	var out bytes.Buffer
+	err := runBrowse(context.Background(), "download", []string{"SD-Apply/example.com_unsafe", dir}, &out)
+
+	expectedErr := "Failed to download 1 files"
+	if err == nil {
+		t.Errorf("Function should have returned error")
+	} else if err.Error() != expectedErr {
+		t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", expectedErr, err.Error())
+	}
+	expected := "Downloaded SD-Apply/example.com_unsafe/safe.txt\nDownloaded 1 files (4 bytes) to " + dir + "\n"
+	if out.String() != expected {
+		t.Errorf("Incorrect output\nExpected=%q\nReceived=%q", expected, out.String())
+	}
+	if _, err = os.Stat(filepath.Join(filepath.Dir(dir), "evil.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("File should not have been written outside of the target directory")
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	dir := filepath.Join("target", "dir")
+
+	var tests = []struct {
+		name, path string
+	}{
+		{"file.txt", filepath.Join(dir, "file.txt")},
+		{"..file", filepath.Join(dir, "..file")},
+		{"", ""},
+		{".", ""},
+		{"..", ""},
+		{"a/b", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := localPath(dir, tt.name)
+			switch {
+			case tt.path == "" && err == nil:
+				t.Errorf("Function should have returned error for name %q", tt.name)
+			case tt.path != "" && err != nil:
+				t.Errorf("Function returned unexpected error: %s", err.Error())
+			case p != tt.path:
+				t.Errorf("Function returned incorrect path. Expected=%s, received=%s", tt.path, p)
+			}
+		})
+	}
+}
+
+func TestDownload_Resume(t *testing.T) {
+	origSkipExisting := skipExisting
+	defer func() { skipExisting = origSkipExisting }()
+
+	mockBrowse(t)
+	var starts []int64
+	mockDownloadRange(t, &starts)
+	dir := t.TempDir()
+	target := filepath.Join(dir, "data", "file.bin")
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatalf("Could not create directory: %s", err.Error())
+	}
+	if err := os.WriteFile(target+partialSuffix, []byte("hello"), 0644); err != nil {
+		t.Fatalf("Could not create partial file: %s", err.Error())
+	}
+	// File has no supported checksum, so it can only be resumed with -skip_existing
+	skipExisting = true
+
+	var out bytes.Buffer
+	if err := runBrowse(context.Background(), "download", []string{"SD-Apply/example.com_dataset/data", dir}, &out); err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+	expected := "Downloaded SD-Apply/example.com_dataset/data/file.bin\nDownloaded 1 files (6 bytes) to " + dir + "\n"
+	if out.String() != expected {
+		t.Errorf("Incorrect output\nExpected=%q\nReceived=%q", expected, out.String())
+	}
+	if len(starts) != 1 || starts[0] != 5 {
+		t.Errorf("Download should have continued from byte 5, requested ranges started from %v", starts)
+	}
+	if data, err := os.ReadFile(target); err != nil {
+		t.Errorf("Could not read downloaded file: %s", err.Error())
+	} else if string(data) != "hello world" {
+		t.Errorf("Incorrect file content. Expected=hello world, received=%s", data)
+	}
+
+	// Downloading again skips the file
+	out.Reset()
+	starts = nil
+	if err := runBrowse(context.Background(), "download", []string{"SD-Apply/example.com_dataset/data/file.bin", filepath.Join(dir, "data")}, &out); err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+	expected = "Downloaded 0 files (0 bytes) to " + filepath.Join(dir, "data") + ", skipped 1 files that had already been downloaded\n"
+	if out.String() != expected {
+		t.Errorf("Incorrect output\nExpected=%q\nReceived=%q", expected, out.String())
+	}
+	if len(starts) != 0 {
+		t.Errorf("File should not have been downloaded again")
+	}
+
+	// Without -skip_existing, files that cannot be verified are downloaded again from the beginning
+	skipExisting = false
+	if err := os.WriteFile(target+partialSuffix, []byte("hello"), 0644); err != nil {
+		t.Fatalf("Could not create partial file: %s", err.Error())
+	}
+	out.Reset()
+	starts = nil
+	if err := runBrowse(context.Background(), "download", []string{"SD-Apply/example.com_dataset/data/file.bin", filepath.Join(dir, "data")}, &out); err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+	if len(starts) != 1 || starts[0] != 0 {
+		t.Errorf("File should have been downloaded from the beginning, requested ranges started from %v", starts)
+	}
+	if data, err := os.ReadFile(target); err != nil {
+		t.Errorf("Could not read downloaded file: %s", err.Error())
+	} else if string(data) != "hello world" {
+		t.Errorf("Incorrect file content. Expected=hello world, received=%s", data)
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, []byte("content ok"), 0644); err != nil {
+		t.Fatalf("Could not create file: %s", err.Error())
+	}
+
+	var tests = []struct {
+		testname, errStr string
+		attributes       map[string]string
+	}{
+		{"OK_NO_CHECKSUM", "", nil},
+		{"OK_SHA256", "", map[string]string{"checksum": "dda02b8296611493229a1eeb1d32771274ab8f3e3bc1b6fbfab087a4f48e4e09", "checksum_type": "sha256"}},
+		{"OK_UNSUPPORTED", "", map[string]string{"checksum": "abc", "checksum_type": "crc32"}},
+		{
+			"FAIL_MD5", "Checksum of path/file does not match. Expected=abc, received=3bb6b517f2cb240abde70be0aced5afb",
+			map[string]string{"checksum": "abc", "checksum_type": "MD5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			err := verifyChecksum(entry{attributes: tt.attributes}, "path/file", file)
+			switch {
+			case tt.errStr == "" && err != nil:
+				t.Errorf("Function returned unexpected error: %s", err.Error())
+			case tt.errStr != "" && err == nil:
+				t.Errorf("Function should have returned error")
+			case tt.errStr != "" && err.Error() != tt.errStr:
+				t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errStr, err.Error())
+			}
+		})
+	}
+}
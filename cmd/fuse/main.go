@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -9,10 +10,15 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
 	"syscall"
+	"time"
 
 	"sda-filesystem/internal/api"
+	"sda-filesystem/internal/config"
+	"sda-filesystem/internal/control"
+	"sda-filesystem/internal/daemon"
 	"sda-filesystem/internal/filesystem"
 	"sda-filesystem/internal/logs"
 	"sda-filesystem/internal/mountpoint"
@@ -20,9 +26,13 @@ import (
 	"golang.org/x/term"
 )
 
-var mount, project, logLevel string
-var requestTimeout int
-var sdsubmit bool
+var mount, project, logLevel, cacheDir, controlSocket, pidfile, webdavAddr, httpAddr string
+var requestTimeout, requestRetries, retryDelay, cacheDiskSize, cacheMemory, chunkSize, cacheTTL, readAhead, listingTTL, refreshInterval, parallel int
+var sdsubmit, lazy, background, foreground, skipExisting bool
+
+// daemonSecret contains the credentials asked before this process was started in the background, if any.
+// It is cleared once it has been used.
+var daemonSecret []byte
 
 type loginReader interface {
 	readPassword() (string, error)
@@ -132,6 +142,16 @@ var login = func(lr loginReader) error {
 
 		return authenticate(username, password)
 	}
+	if username, password, ok := strings.Cut(string(daemonSecret), "\n"); ok {
+		clear(daemonSecret)
+		daemonSecret = nil
+		logs.Info("Using username and password given before moving to the background")
+
+		return authenticate(username, password)
+	}
+	if foreground {
+		return errors.New("CSC_USERNAME and CSC_PASSWORD must be set with -foreground since credentials cannot be asked")
+	}
 
 	// Get the state of the terminal before running the password prompt
 	err := lr.getState()
@@ -194,22 +214,105 @@ func determineAccess() error {
 	return nil
 }
 
+// startDaemon starts Data Gateway in the background and returns once it has been mounted.
+// Credentials are asked here since the background process cannot prompt for them.
+func startDaemon() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("Could not find executable: %w", err)
+	}
+
+	// Credentials are passed through a pipe since the environment of a process can be read by other processes
+	var secret []byte
+	if _, _, exists := checkEnvVars(); !exists && !sdsubmit {
+		username, password, err := askForLogin(&stdinReader{})
+		if err != nil {
+			return err
+		}
+		secret = []byte(username + "\n" + password)
+		defer clear(secret)
+	}
+
+	logDir, err := os.UserCacheDir()
+	if err != nil {
+		return fmt.Errorf("Could not determine directory for log file: %w", err)
+	}
+	logPath := filepath.Join(logDir, "sda-filesystem", "go-fuse.log")
+
+	pid, err := startBackground(exe, os.Args[1:], os.Environ(), secret, logPath)
+	if err != nil {
+		return err
+	}
+	logs.Infof("Data Gateway is running in the background with PID %d, logs are written to %s", pid, logPath)
+
+	return nil
+}
+
+var startBackground = daemon.Start
+
 func processFlags() error {
-	if mount == "" {
+	switch {
+	case webdavAddr != "" && httpAddr != "":
+		return errors.New("Flags -webdav and -http cannot be used together")
+	case webdavAddr != "":
+		if err := filesystem.CheckWebDAVAddress(webdavAddr); err != nil {
+			return err
+		}
+	case httpAddr != "":
+		if err := filesystem.CheckHTTPAddress(httpAddr); err != nil {
+			return err
+		}
+	case mount == "":
 		defaultMount, err := mountpoint.DefaultMountPoint()
 		if err != nil {
 			return err
 		}
 		mount = defaultMount
-	} else if err := mountpoint.CheckMountPoint(mount); err != nil {
-		return err
+	default:
+		if err := mountpoint.CheckMountPoint(mount); err != nil {
+			return err
+		}
 	}
 
-	mount = filepath.Clean(mount)
+	if mount != "" {
+		mount = filepath.Clean(mount)
+	}
+	setOptions()
+
+	return nil
+}
+
+// setOptions applies the flags that do not concern the mount point
+func setOptions() {
 	api.SetRequestTimeout(requestTimeout)
+	api.SetRequestRetries(requestRetries, time.Duration(retryDelay)*time.Millisecond)
+	api.SetReadAhead(readAhead)
+	if lazy {
+		filesystem.SetLazyPopulation(time.Duration(listingTTL) * time.Minute)
+	}
 	logs.SetLevel(logLevel)
+}
 
-	return nil
+// connect initializes the cache and logs in to the repositories
+func connect() error {
+	err := api.InitializeCache(api.CacheConfig{
+		Dir:        cacheDir,
+		DiskSize:   int64(cacheDiskSize) << 20,
+		MemorySize: int64(cacheMemory) << 20,
+		ChunkSize:  int64(chunkSize) << 20,
+		TTL:        time.Duration(cacheTTL) * time.Minute,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, rep := range api.GetAllRepositories() {
+		if err := api.GetEnvs(rep); err != nil {
+			return err
+		}
+	}
+
+	return determineAccess()
 }
 
 func init() {
@@ -217,15 +320,58 @@ func init() {
 	flag.StringVar(&project, "project", "", "SD Connect project if it differs from that in the VM")
 	flag.StringVar(&logLevel, "loglevel", "info", "Logging level. Possible values: {debug,info,warning,error}")
 	flag.BoolVar(&sdsubmit, "sdapply", false, "Connect only to SD Apply")
-	flag.IntVar(&requestTimeout, "http_timeout", 20, "Number of seconds to wait before timing out an HTTP request")
+	flag.IntVar(&requestTimeout, "http_timeout", 20, "Number of seconds to wait before timing out an HTTP request attempt")
+	flag.IntVar(&requestRetries, "http_retries", 3, "Number of times an HTTP request is attempted before giving up")
+	flag.IntVar(&retryDelay, "http_retry_delay", 500, "Number of milliseconds to wait before retrying a failed HTTP request. Doubled after each attempt")
+	flag.StringVar(&cacheDir, "cache_dir", "", "Directory for a persistent on-disk cache. If empty, data is cached in memory")
+	flag.IntVar(&cacheDiskSize, "cache_disk_size", 10240, "Maximum size of the on-disk cache in MiB")
+	flag.IntVar(&cacheMemory, "cache_memory", 1024, "Maximum size of the in-memory cache in MiB")
+	flag.IntVar(&chunkSize, "chunk_size", 32, "Size of the chunks in MiB in which files are downloaded and cached")
+	flag.IntVar(&cacheTTL, "cache_ttl", 60, "Number of minutes downloaded data is kept in cache")
+	flag.StringVar(&controlSocket, "control_socket", "", "Path to a Unix socket through which the running Data Gateway can be controlled with the ctl command. Disabled if empty")
+	flag.BoolVar(&background, "daemon", false, "Run Data Gateway in the background once it has been mounted. CSC credentials are asked before moving to the background")
+	flag.BoolVar(&foreground, "foreground", false, "Run Data Gateway in the foreground without asking for credentials or reading commands from standard input, e.g. under a service manager. Overrides -daemon")
+	flag.StringVar(&httpAddr, "http", "", "Serve Data Gateway read-only over HTTP at this address on the loopback interface, or at Unix socket unix:<path>, instead of mounting it")
+	flag.BoolVar(&lazy, "lazy", false, "List the contents of buckets and datasets only when they are first accessed")
+	flag.IntVar(&listingTTL, "lazy_ttl", 10, "Number of minutes after which the contents of a lazily listed bucket or dataset are listed again. Zero means never")
+	flag.IntVar(&refreshInterval, "refresh_interval", 0, "Approximate number of minutes between automatic updates of Data Gateway. Zero disables automatic updates")
+	flag.IntVar(&parallel, "parallel", 4, "Number of files downloaded in parallel by the download command")
+	flag.BoolVar(&skipExisting, "skip_existing", false, "Keep files and partial files that the download command cannot verify with a checksum instead of downloading them again")
+	flag.StringVar(&pidfile, "pidfile", "", "File where the process ID of Data Gateway is written")
+	flag.StringVar(&webdavAddr, "webdav", "", "Serve Data Gateway read-only over WebDAV at this address on the loopback interface, e.g. localhost:8080, instead of mounting it")
+	flag.IntVar(&readAhead, "read_ahead", 2, "Number of chunks prefetched when a file is read sequentially. Zero disables prefetching")
 }
 
 func main() {
-	err := api.GetCommonEnvs()
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		if err := runCtl(os.Args[2:], os.Stdout); err != nil {
+			logs.Fatal(err)
+		}
+
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := runConfig(os.Args[2:], os.Stdout); err != nil {
+			logs.Fatal(err)
+		}
+
+		return
+	}
+
+	command, args := "", os.Args[1:]
+	if len(args) > 0 && slices.Contains(browseCommands, args[0]) {
+		command, args = args[0], args[1:]
+	}
+
+	cfg, _, err := config.Load()
 	if err != nil {
 		logs.Fatal(err)
 	}
-	err = api.InitializeCache()
+	if err = applyConfig(cfg); err != nil {
+		logs.Fatal(err)
+	}
+
+	err = api.GetCommonEnvs()
 	if err != nil {
 		logs.Fatal(err)
 	}
@@ -234,29 +380,89 @@ func main() {
 		logs.Fatal(err)
 	}
 
-	flag.Parse()
+	_ = flag.CommandLine.Parse(args) // Exits on error
+	if command != "" {
+		setOptions()
+		if err = connect(); err != nil {
+			logs.Fatal(err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err = runBrowse(ctx, command, flag.Args(), os.Stdout)
+		stop()
+		if err != nil {
+			logs.Fatal(err)
+		}
+
+		return
+	}
+
 	err = processFlags()
 	if err != nil {
 		logs.Fatal(err)
 	}
-
-	for _, rep := range api.GetAllRepositories() {
-		if err := api.GetEnvs(rep); err != nil {
+	if background && !foreground && !daemon.IsChild() {
+		if err = startDaemon(); err != nil {
 			logs.Fatal(err)
 		}
-	}
 
-	err = determineAccess()
+		return
+	}
+	if daemonSecret, err = daemon.Secret(); err != nil {
+		logs.Fatal(err)
+	}
+	// Output of the background process goes to the log file, so credentials of servers are shown by the parent process
+	if out := daemon.ParentOutput(); out != nil {
+		filesystem.SetCredentialsOutput(out)
+	}
+	err = connect()
 	if err != nil {
 		logs.Fatal(err)
 	}
 
-	fs := filesystem.InitializeFilesystem(nil)
-	fs.PopulateFilesystem(nil)
+	if pidfile != "" {
+		if err = daemon.WritePidfile(pidfile); err != nil {
+			logs.Fatal(err)
+		}
+		defer os.Remove(pidfile)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		logs.Infof("Received signal %v", sig)
+		cancel()
+		filesystem.UnmountFilesystem()
+	}()
+
+	fs := filesystem.InitializeFilesystem(ctx, nil)
+	fs.PopulateFilesystem(ctx, nil)
+	if ctx.Err() != nil {
+		logs.Info("Data Gateway was stopped before it was mounted")
+
+		return
+	}
+	if refreshInterval > 0 {
+		go fs.AutoRefresh(time.Duration(refreshInterval)*time.Minute, nil, nil)
+	}
+
+	var server *control.Server
+	if controlSocket != "" {
+		server, err = control.Listen(controlSocket, controlHandlers(fs))
+		if err != nil {
+			logs.Fatal(err)
+		}
+	}
 
 	var wait = make(chan []string)
 	go mountpoint.WaitForUpdateSignal(wait)
-	go userInput(os.Stdin, wait)
+	if !foreground && term.IsTerminal(int(os.Stdin.Fd())) {
+		go userInput(os.Stdin, wait)
+	}
 	go func() {
 		for {
 			input := <-wait
@@ -265,11 +471,7 @@ func main() {
 			}
 			switch strings.ToLower(input[0]) {
 			case "update":
-				if fs.FilesOpen() {
-					logs.Errorf("You have files in use which prevents updating Data Gateway")
-				} else {
-					fs.RefreshFilesystem(nil, nil)
-				}
+				fs.RefreshFilesystem(nil, nil)
 			case "clear":
 				if len(input) > 1 {
 					path := filepath.Clean(input[1])
@@ -283,7 +485,27 @@ func main() {
 		}
 	}()
 
-	filesystem.MountFilesystem(fs, mount)
+	filesystem.SetReadyNotifier(daemon.NotifyReady)
+	switch {
+	case webdavAddr != "":
+		err = filesystem.ServeWebDAV(fs, webdavAddr)
+	case httpAddr != "":
+		err = filesystem.ServeHTTP(fs, httpAddr)
+	default:
+		filesystem.MountFilesystem(fs, mount)
+	}
+	if err != nil {
+		logs.Error(err)
+	}
 
+	if err := daemon.Notify("STOPPING=1"); err != nil {
+		logs.Warningf("Could not notify service manager: %w", err)
+	}
+	cancel()
+	if server != nil {
+		if err := server.Close(); err != nil {
+			logs.Warningf("Could not close control socket: %w", err)
+		}
+	}
 	logs.Info("Shutting down Data Gateway")
 }
@@ -6,11 +6,13 @@ import (
 	"io"
 	"os"
 	"reflect"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
 	"sda-filesystem/internal/api"
+	"sda-filesystem/internal/filesystem"
 	"sda-filesystem/internal/logs"
 	"sda-filesystem/internal/mountpoint"
 
@@ -361,6 +363,50 @@ func TestLogin(t *testing.T) {
 	}
 }
 
+func TestLogin_Daemon(t *testing.T) {
+	origAskForLogin := askForLogin
+	origAuthenticate := api.Authenticate
+	origForeground := foreground
+	defer func() {
+		askForLogin = origAskForLogin
+		api.Authenticate = origAuthenticate
+		foreground = origForeground
+		daemonSecret = nil
+	}()
+
+	t.Setenv("CSC_USERNAME", "")
+	t.Setenv("CSC_PASSWORD", "")
+	os.Unsetenv("CSC_USERNAME")
+	os.Unsetenv("CSC_PASSWORD")
+	askForLogin = func(lr loginReader) (string, string, error) {
+		return "", "", errors.New("Should not have called askForLogin()")
+	}
+	token := ""
+	api.Authenticate = func(_ string, rest ...string) error {
+		token = rest[0]
+
+		return nil
+	}
+
+	// Credentials given before moving to the background are used once and cleared
+	secret := []byte("sandman\n89bf5cifu6vo")
+	daemonSecret = secret
+	if err := login(&stdinReader{}); err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+	if expected := "c2FuZG1hbjo4OWJmNWNpZnU2dm8="; token != expected { // #nosec G101
+		t.Errorf("Incorrect token. Expected=%s, received=%s", expected, token)
+	}
+	if daemonSecret != nil || strings.Trim(string(secret), "\x00") != "" {
+		t.Errorf("Credentials were not cleared after use")
+	}
+
+	foreground = true
+	expected := "CSC_USERNAME and CSC_PASSWORD must be set with -foreground since credentials cannot be asked"
+	if err := login(&stdinReader{}); err == nil || err.Error() != expected {
+		t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%v", expected, err)
+	}
+}
 func TestDetermineAccess(t *testing.T) {
 	var tests = []struct {
 		testname              string
@@ -417,27 +463,39 @@ func TestProcessFlags(t *testing.T) {
 
 	var tests = []struct {
 		testname, mount, logLevel string
-		timeout                   int
+		timeout, readAhead        int
+		retries, retryDelay       int
+		lazy                      bool
+		listingTTL                int
 	}{
-		{"OK_1", "/hello", "debug", 45},
-		{"OK_2", "/goodbye", "warning", 87},
-		{"OK_3", "/hi/hello", "error", 2},
-		{"OK_4", "", "info", 20},
+		{"OK_1", "/hello", "debug", 45, 2, 3, 500, false, 10},
+		{"OK_2", "/goodbye", "warning", 87, 0, 1, 0, true, 10},
+		{"OK_3", "/hi/hello", "error", 2, 5, 10, 2000, true, 0},
+		{"OK_4", "", "info", 20, 2, 3, 500, false, 10},
 	}
 
 	origDefaultMountPoint := mountpoint.DefaultMountPoint
 	origCheckMountPoint := mountpoint.CheckMountPoint
 	origSetRequestTimeout := api.SetRequestTimeout
+	origSetReadAhead := api.SetReadAhead
+	origSetRequestRetries := api.SetRequestRetries
+	origSetLazyPopulation := filesystem.SetLazyPopulation
 	origSetLevel := logs.SetLevel
 
 	defer func() {
 		mountpoint.DefaultMountPoint = origDefaultMountPoint
 		mountpoint.CheckMountPoint = origCheckMountPoint
 		api.SetRequestTimeout = origSetRequestTimeout
+		api.SetReadAhead = origSetReadAhead
+		api.SetRequestRetries = origSetRequestRetries
+		filesystem.SetLazyPopulation = origSetLazyPopulation
 		logs.SetLevel = origSetLevel
 	}()
 
-	var testTimeout int
+	var testLazy bool
+	var testListingTTL time.Duration
+	var testTimeout, testReadAhead, testRetries int
+	var testRetryDelay time.Duration
 	var testLevel, testMount string
 
 	mountpoint.DefaultMountPoint = func() (string, error) {
@@ -451,6 +509,15 @@ func TestProcessFlags(t *testing.T) {
 	api.SetRequestTimeout = func(timeout int) {
 		testTimeout = timeout
 	}
+	api.SetReadAhead = func(chunks int) {
+		testReadAhead = chunks
+	}
+	api.SetRequestRetries = func(attempts int, delay time.Duration) {
+		testRetries, testRetryDelay = attempts, delay
+	}
+	filesystem.SetLazyPopulation = func(ttl time.Duration) {
+		testLazy, testListingTTL = true, ttl
+	}
 	logs.SetLevel = func(level string) {
 		testLevel = level
 	}
@@ -460,8 +527,13 @@ func TestProcessFlags(t *testing.T) {
 			mount = tt.mount
 			logLevel = tt.logLevel
 			requestTimeout = tt.timeout
+			readAhead = tt.readAhead
+			requestRetries, retryDelay = tt.retries, tt.retryDelay
+			lazy, listingTTL = tt.lazy, tt.listingTTL
 
-			testTimeout = 0
+			testTimeout, testReadAhead = 0, -1
+			testRetries, testRetryDelay = 0, -1
+			testLazy, testListingTTL = false, -1
 			testLevel, testMount = "", ""
 
 			err := processFlags()
@@ -471,6 +543,16 @@ func TestProcessFlags(t *testing.T) {
 				t.Errorf("Returned unexpected error: %s", err.Error())
 			case tt.timeout != testTimeout:
 				t.Errorf("SetRequestTimeout() received incorrect timeout. Expected=%d, received=%d", tt.timeout, testTimeout)
+			case tt.retries != testRetries:
+				t.Errorf("SetRequestRetries() received incorrect number of attempts. Expected=%d, received=%d", tt.retries, testRetries)
+			case time.Duration(tt.retryDelay)*time.Millisecond != testRetryDelay:
+				t.Errorf("SetRequestRetries() received incorrect delay. Expected=%dms, received=%v", tt.retryDelay, testRetryDelay)
+			case tt.readAhead != testReadAhead:
+				t.Errorf("SetReadAhead() received incorrect number of chunks. Expected=%d, received=%d", tt.readAhead, testReadAhead)
+			case tt.lazy != testLazy:
+				t.Errorf("SetLazyPopulation() called incorrectly. Expected lazy=%t, received=%t", tt.lazy, testLazy)
+			case tt.lazy && time.Duration(tt.listingTTL)*time.Minute != testListingTTL:
+				t.Errorf("SetLazyPopulation() received incorrect TTL. Expected=%dmin, received=%v", tt.listingTTL, testListingTTL)
 			case tt.logLevel != testLevel:
 				t.Errorf("SetLevel() received incorrect log level. Expected=%s, received=%s", tt.logLevel, testLevel)
 			case tt.mount == "" && mount != defaultMount:
@@ -482,6 +564,111 @@ func TestProcessFlags(t *testing.T) {
 	}
 }
 
+func TestStartDaemon(t *testing.T) {
+	var tests = []struct {
+		testname, envUsername, envPassword string
+		sdsubmit                           bool
+		secret                             string
+	}{
+		{"OK_ASK", "", "", false, "user\npass"},
+		{"OK_ENV", "envuser", "envpass", false, ""},
+		{"OK_SDAPPLY", "", "", true, ""},
+	}
+
+	origAskForLogin := askForLogin
+	origStartBackground := startBackground
+	origSdsubmit := sdsubmit
+	defer func() {
+		askForLogin = origAskForLogin
+		startBackground = origStartBackground
+		sdsubmit = origSdsubmit
+	}()
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			t.Setenv("CSC_USERNAME", "")
+			t.Setenv("CSC_PASSWORD", "")
+			os.Unsetenv("CSC_USERNAME")
+			os.Unsetenv("CSC_PASSWORD")
+			if tt.envUsername != "" {
+				t.Setenv("CSC_USERNAME", tt.envUsername)
+				t.Setenv("CSC_PASSWORD", tt.envPassword)
+			}
+			sdsubmit = tt.sdsubmit
+
+			asked := false
+			askForLogin = func(lr loginReader) (string, string, error) {
+				asked = true
+
+				return "user", "pass", nil
+			}
+			var env []string
+			var secret string
+			startBackground = func(_ string, args, e []string, s []byte, logPath string) (int, error) {
+				if !reflect.DeepEqual(args, os.Args[1:]) {
+					t.Errorf("Incorrect arguments\nExpected=%v\nReceived=%v", os.Args[1:], args)
+				}
+				if !strings.HasSuffix(logPath, "go-fuse.log") {
+					t.Errorf("Incorrect log file %s", logPath)
+				}
+				env = e
+				secret = string(s)
+
+				return 10, nil
+			}
+
+			if err := startDaemon(); err != nil {
+				t.Fatalf("Function returned unexpected error: %s", err.Error())
+			}
+			if asked != (tt.envUsername == "" && !tt.sdsubmit) {
+				t.Errorf("Credentials should have been asked: %t", !asked)
+			}
+			if secret != tt.secret {
+				t.Errorf("Incorrect secret passed to background process. Expected=%q, received=%q", tt.secret, secret)
+			}
+			if slices.ContainsFunc(env, func(e string) bool {
+				return strings.HasPrefix(e, "CSC_PASSWORD=") && e != "CSC_PASSWORD="+tt.envPassword
+			}) {
+				t.Errorf("Environment of background process should not contain asked password")
+			}
+		})
+	}
+}
+
+func TestStartDaemon_Error(t *testing.T) {
+	origAskForLogin := askForLogin
+	origStartBackground := startBackground
+	origSdsubmit := sdsubmit
+	defer func() {
+		askForLogin = origAskForLogin
+		startBackground = origStartBackground
+		sdsubmit = origSdsubmit
+	}()
+
+	t.Setenv("CSC_USERNAME", "")
+	t.Setenv("CSC_PASSWORD", "")
+	os.Unsetenv("CSC_USERNAME")
+	os.Unsetenv("CSC_PASSWORD")
+	sdsubmit = false
+	startBackground = func(_ string, _, _ []string, _ []byte, _ string) (int, error) {
+		return 0, errExpected
+	}
+
+	askForLogin = func(lr loginReader) (string, string, error) {
+		return "", "", errors.New("Could not read username")
+	}
+	if err := startDaemon(); err == nil || err.Error() != "Could not read username" {
+		t.Errorf("Function should have returned error from login, received %v", err)
+	}
+
+	askForLogin = func(lr loginReader) (string, string, error) {
+		return "user", "pass", nil
+	}
+	if err := startDaemon(); !errors.Is(err, errExpected) {
+		t.Errorf("Function should have returned error %v, received %v", errExpected, err)
+	}
+}
+
 func TestProcessFlags_Error(t *testing.T) {
 	var tests = []struct {
 		testname, repository, mount        string
@@ -494,16 +681,22 @@ func TestProcessFlags_Error(t *testing.T) {
 	origDefaultMountPoint := mountpoint.DefaultMountPoint
 	origCheckMountPoint := mountpoint.CheckMountPoint
 	origSetRequestTimeout := api.SetRequestTimeout
+	origSetReadAhead := api.SetReadAhead
+	origSetRequestRetries := api.SetRequestRetries
 	origSetLevel := logs.SetLevel
 
 	defer func() {
 		mountpoint.DefaultMountPoint = origDefaultMountPoint
 		mountpoint.CheckMountPoint = origCheckMountPoint
 		api.SetRequestTimeout = origSetRequestTimeout
+		api.SetReadAhead = origSetReadAhead
+		api.SetRequestRetries = origSetRequestRetries
 		logs.SetLevel = origSetLevel
 	}()
 
 	api.SetRequestTimeout = func(timeout int) {}
+	api.SetReadAhead = func(chunks int) {}
+	api.SetRequestRetries = func(attempts int, delay time.Duration) {}
 	logs.SetLevel = func(level string) {}
 
 	for _, tt := range tests {
@@ -525,3 +718,65 @@ func TestProcessFlags_Error(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessFlags_Serve(t *testing.T) {
+	var tests = []struct {
+		testname, webdav, http, mount, errStr string
+	}{
+		{"OK_WEBDAV", "localhost:8080", "", "", ""},
+		{"OK_HTTP", "", "unix:/tmp/gateway.sock", "", ""},
+		{"OK_MOUNT_IGNORED", "127.0.0.1:8080", "", "/bad/directory", ""},
+		{"FAIL_NOT_LOOPBACK", "0.0.0.0:8080", "", "", "WebDAV can only be served on the loopback interface, received address 0.0.0.0:8080"},
+		{"FAIL_HTTP_NOT_LOOPBACK", "", "example.com:80", "", "HTTP can only be served on the loopback interface, received address example.com:80"},
+		{"FAIL_BOTH", "localhost:8080", "localhost:8081", "", "Flags -webdav and -http cannot be used together"},
+	}
+
+	origDefaultMountPoint := mountpoint.DefaultMountPoint
+	origCheckMountPoint := mountpoint.CheckMountPoint
+	origSetRequestTimeout := api.SetRequestTimeout
+	origSetReadAhead := api.SetReadAhead
+	origSetRequestRetries := api.SetRequestRetries
+	origSetLevel := logs.SetLevel
+	origWebdavAddr, origHTTPAddr := webdavAddr, httpAddr
+
+	defer func() {
+		mountpoint.DefaultMountPoint = origDefaultMountPoint
+		mountpoint.CheckMountPoint = origCheckMountPoint
+		api.SetRequestTimeout = origSetRequestTimeout
+		api.SetReadAhead = origSetReadAhead
+		api.SetRequestRetries = origSetRequestRetries
+		logs.SetLevel = origSetLevel
+		webdavAddr, httpAddr = origWebdavAddr, origHTTPAddr
+	}()
+
+	mountpoint.DefaultMountPoint = func() (string, error) {
+		t.Error("Default mount point should not have been determined")
+
+		return "", errExpected
+	}
+	mountpoint.CheckMountPoint = func(mount string) error {
+		t.Error("Mount point should not have been checked")
+
+		return errExpected
+	}
+	api.SetRequestTimeout = func(timeout int) {}
+	api.SetReadAhead = func(chunks int) {}
+	api.SetRequestRetries = func(attempts int, delay time.Duration) {}
+	logs.SetLevel = func(level string) {}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			webdavAddr, httpAddr, mount = tt.webdav, tt.http, tt.mount
+
+			err := processFlags()
+			switch {
+			case tt.errStr == "" && err != nil:
+				t.Errorf("Returned unexpected error: %s", err.Error())
+			case tt.errStr != "" && err == nil:
+				t.Error("Function should have returned error")
+			case tt.errStr != "" && err.Error() != tt.errStr:
+				t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errStr, err.Error())
+			}
+		})
+	}
+}
@@ -13,6 +13,8 @@ import (
 
 	"sda-filesystem/internal/airlock"
 	"sda-filesystem/internal/api"
+	"sda-filesystem/internal/cache"
+	"sda-filesystem/internal/config"
 	"sda-filesystem/internal/filesystem"
 	"sda-filesystem/internal/logs"
 	"sda-filesystem/internal/mountpoint"
@@ -22,14 +24,25 @@ import (
 
 // App struct
 type App struct {
-	ctx         context.Context
-	ph          *ProjectHandler
-	lh          *LogHandler
-	fs          *filesystem.Fuse
-	mountpoint  string
-	loginRepo   string
-	paniced     bool
-	preventQuit bool
+	ctx             context.Context
+	fsCtx           context.Context // cancelled on quit so that ongoing requests do not delay quitting
+	cancelFs        context.CancelFunc
+	ph              *ProjectHandler
+	lh              *LogHandler
+	fs              *filesystem.Fuse
+	mountpoint      string
+	loginRepo       string
+	refreshInterval time.Duration
+	config          *config.Config
+	paniced         bool
+	preventQuit     bool
+}
+
+// CacheSettings are the cache options the user can adjust before Data Gateway is loaded
+type CacheSettings struct {
+	MemoryMiB    int `json:"memory"`
+	ChunkSizeMiB int `json:"chunkSize"`
+	TTLMinutes   int `json:"ttl"`
 }
 
 // NewApp creates a new App application struct
@@ -41,10 +54,47 @@ func NewApp(ph *ProjectHandler, lh *LogHandler) *App {
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+	a.fsCtx, a.cancelFs = context.WithCancel(context.Background())
 	filesystem.SetSignalBridge(a.Panic)
+	airlock.SetProgressObserver(func(p airlock.Progress) {
+		wailsruntime.EventsEmit(a.ctx, "exportProgress", p)
+	})
+	a.loadConfig()
+}
+
+// loadConfig applies the settings from the configuration files. Settings that cannot be changed in the GUI are
+// applied here, the rest are used as the initial values shown to the user.
+func (a *App) loadConfig() {
+	cfg, _, err := config.Load()
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		logs.Error(err)
+		cfg = &config.Config{}
+	}
+	a.config = cfg
+
+	if err = cfg.SetEnv(); err != nil {
+		logs.Error(err)
+	}
+	if cfg.LogLevel != "" {
+		logs.SetLevel(cfg.LogLevel)
+	}
+	if cfg.HTTP.Timeout != nil {
+		api.SetRequestTimeout(*cfg.HTTP.Timeout)
+	}
+	api.SetRequestRetries(config.Or(cfg.HTTP.Retries, api.DefaultRequestRetries),
+		time.Duration(config.Or(cfg.HTTP.RetryDelay, int(api.DefaultRetryDelay.Milliseconds())))*time.Millisecond)
+	if cfg.Cache.ReadAhead != nil {
+		api.SetReadAhead(*cfg.Cache.ReadAhead)
+	}
+	airlock.SetParallelSegments(config.Or(cfg.Airlock.Parallel, 1))
+	airlock.SetStreamEncryption(config.Or(cfg.Airlock.Stream, false))
 }
 
 func (a *App) shutdown(_ context.Context) {
+	a.cancelFs()
 	filesystem.UnmountFilesystem()
 }
 
@@ -54,6 +104,7 @@ func (a *App) beforeClose(_ context.Context) (prevent bool) {
 
 func (a *App) Quit() {
 	a.preventQuit = false
+	a.cancelFs()
 	wailsruntime.Quit(a.ctx)
 }
 
@@ -80,6 +131,16 @@ func (a *App) Panic() {
 }
 
 func (a *App) GetDefaultMountPoint() string {
+	if a.config.Mount != "" {
+		if err := mountpoint.CheckMountPoint(a.config.Mount); err != nil {
+			logs.Warning(err)
+		} else {
+			a.mountpoint = filepath.Clean(a.config.Mount)
+
+			return a.mountpoint
+		}
+	}
+
 	var err error
 	a.mountpoint, err = mountpoint.DefaultMountPoint()
 	if err != nil {
@@ -104,13 +165,6 @@ func (a *App) InitializeAPI() error {
 		return errors.New("required environmental variables missing")
 	}
 
-	err = api.InitializeCache()
-	if err != nil {
-		logs.Error(err)
-
-		return errors.New("initializing cache failed")
-	}
-
 	err = api.InitializeClient()
 	if err != nil {
 		logs.Error(err)
@@ -184,10 +238,50 @@ func (a *App) Login(username, password string) (bool, error) {
 func (a *App) InitFuse() {
 	a.preventQuit = true
 	api.SettleRepositories()
-	a.fs = filesystem.InitializeFilesystem(a.ph.AddProject)
+	a.fs = filesystem.InitializeFilesystem(a.fsCtx, a.ph.AddProject)
 	a.ph.sendProjects()
 }
 
+// GetCacheSettings returns the cache settings from the configuration file, or the defaults for those that are not set
+func (a *App) GetCacheSettings() CacheSettings {
+	return CacheSettings{
+		MemoryMiB:    config.Or(a.config.Cache.Memory, api.DefaultMemoryCacheSize>>20),
+		ChunkSizeMiB: config.Or(a.config.Cache.ChunkSize, api.DefaultChunkSize>>20),
+		TTLMinutes:   config.Or(a.config.Cache.TTL, int(cache.RistrettoCacheTTL.Minutes())),
+	}
+}
+
+// InitializeCache creates the cache for downloaded data with the settings the user chose.
+// Calling it again replaces the cache, so any data that was cached earlier is discarded.
+func (a *App) InitializeCache(settings CacheSettings) error {
+	err := api.InitializeCache(api.CacheConfig{
+		Dir:        a.config.Cache.Dir,
+		DiskSize:   int64(config.Or(a.config.Cache.DiskSize, api.DefaultDiskCacheSize>>20)) << 20,
+		MemorySize: int64(settings.MemoryMiB) << 20,
+		ChunkSize:  int64(settings.ChunkSizeMiB) << 20,
+		TTL:        time.Duration(settings.TTLMinutes) * time.Minute,
+	})
+	if err != nil {
+		logs.Error(err)
+		message, _ := logs.Wrapper(err)
+
+		return errors.New(message)
+	}
+
+	return nil
+}
+
+// SetRefreshInterval sets how often the filesystem is refreshed automatically after it has been loaded.
+// Zero disables automatic refresh.
+func (a *App) SetRefreshInterval(minutes int) error {
+	if minutes < 0 {
+		return errors.New("refresh interval cannot be negative")
+	}
+	a.refreshInterval = time.Duration(minutes) * time.Minute
+
+	return nil
+}
+
 func (a *App) ChangeMountPoint() (string, error) {
 	home, _ := os.UserHomeDir()
 	options := wailsruntime.OpenDialogOptions{DefaultDirectory: home, CanCreateDirectories: true}
@@ -219,7 +313,7 @@ func (a *App) ChangeMountPoint() (string, error) {
 func (a *App) LoadFuse() {
 	go func() {
 		defer filesystem.CheckPanic()
-		a.fs.PopulateFilesystem(a.ph.trackContainers)
+		a.fs.PopulateFilesystem(a.fsCtx, a.ph.trackContainers)
 
 		go func() {
 			time.Sleep(time.Second)
@@ -230,6 +324,17 @@ func (a *App) LoadFuse() {
 			wailsruntime.EventsEmit(a.ctx, "fuseReady")
 		}()
 
+		if a.refreshInterval > 0 {
+			var projects []filesystem.Project
+			go a.fs.AutoRefresh(a.refreshInterval, func(pr filesystem.Project) {
+				projects = append(projects, pr)
+			}, func(summary filesystem.RefreshSummary) {
+				current := a.ph.setProjects(projects)
+				projects = nil
+				wailsruntime.EventsEmit(a.ctx, "autoRefreshed", summary, current)
+			})
+		}
+
 		var wait = make(chan []string)
 		go mountpoint.WaitForUpdateSignal(wait)
 		go func() {
@@ -323,7 +428,8 @@ func (a *App) CheckEncryption(file, bucket string) (checks [2]bool, err error) {
 
 func (a *App) ExportFile(file, folder string, encrypted bool) error {
 	time.Sleep(1000 * time.Millisecond)
-	err := airlock.Upload(file, folder, 4000, "", "", encrypted)
+	segmentSize := uint64(config.Or(a.config.Airlock.SegmentSize, 4000))
+	err := airlock.Upload(file, folder, segmentSize, "", "", encrypted, false)
 	if err != nil {
 		logs.Error(err)
 		message, _ := logs.Wrapper(err)
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"sda-filesystem/internal/filesystem"
+	"slices"
+	"sync"
 
 	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
 )
@@ -11,6 +13,7 @@ type ProjectHandler struct {
 	ctx      context.Context
 	projects []filesystem.Project
 	progress map[filesystem.Project][]int
+	lock     sync.Mutex // projects are updated both by manual and automatic refreshes
 }
 
 // NewApp creates a new App application struct
@@ -23,12 +26,33 @@ func (ph *ProjectHandler) SetContext(ctx context.Context) {
 }
 
 func (ph *ProjectHandler) AddProject(pr filesystem.Project) {
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+	ph.addProject(pr)
+}
+
+func (ph *ProjectHandler) addProject(pr filesystem.Project) {
 	ph.projects = append(ph.projects, pr)
 	ph.progress[pr] = []int{0, -1}
 }
 
+// setProjects replaces the projects with those found when the filesystem was refreshed automatically.
+// Returns a copy of the new projects.
+func (ph *ProjectHandler) setProjects(projects []filesystem.Project) []filesystem.Project {
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+	ph.clearProjects()
+	for _, pr := range projects {
+		ph.addProject(pr)
+	}
+
+	return slices.Clone(ph.projects)
+}
+
 func (ph *ProjectHandler) sendProjects() {
-	wailsruntime.EventsEmit(ph.ctx, "sendProjects", ph.projects)
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+	wailsruntime.EventsEmit(ph.ctx, "sendProjects", slices.Clone(ph.projects))
 }
 
 func (ph *ProjectHandler) trackContainers(rep, pr string, count int) {
@@ -38,7 +62,13 @@ func (ph *ProjectHandler) trackContainers(rep, pr string, count int) {
 		return
 	}
 
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
 	project := filesystem.Project{Name: pr, Repository: rep}
+	if _, ok := ph.progress[project]; !ok {
+		// Projects were replaced by another refresh
+		return
+	}
 	if ph.progress[project][1] == -1 {
 		ph.progress[project][1] = count
 
@@ -64,6 +94,12 @@ func (ph *ProjectHandler) trackContainers(rep, pr string, count int) {
 }
 
 func (ph *ProjectHandler) deleteProjects() {
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+	ph.clearProjects()
+}
+
+func (ph *ProjectHandler) clearProjects() {
 	ph.projects = []filesystem.Project{}
 	ph.progress = make(map[filesystem.Project][]int)
 }
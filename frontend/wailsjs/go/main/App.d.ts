@@ -1,5 +1,6 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
+import {main} from '../models';
 
 export function Authenticate(arg1:string):Promise<void>;
 
@@ -11,12 +12,16 @@ export function ExportFile(arg1:string,arg2:string,arg3:boolean):Promise<void>;
 
 export function FilesOpen():Promise<boolean>;
 
+export function GetCacheSettings():Promise<main.CacheSettings>;
+
 export function GetDefaultMountPoint():Promise<string>;
 
 export function InitFuse():Promise<void>;
 
 export function InitializeAPI():Promise<void>;
 
+export function InitializeCache(arg1:main.CacheSettings):Promise<void>;
+
 export function LoadFuse():Promise<void>;
 
 export function Login(arg1:string,arg2:string):Promise<boolean>;
@@ -30,3 +35,5 @@ export function Quit():Promise<void>;
 export function RefreshFuse():Promise<void>;
 
 export function SelectFile():Promise<string>;
+
+export function SetRefreshInterval(arg1:number):Promise<void>;
@@ -22,6 +22,10 @@ export function FilesOpen() {
   return window['go']['main']['App']['FilesOpen']();
 }
 
+export function GetCacheSettings() {
+  return window['go']['main']['App']['GetCacheSettings']();
+}
+
 export function GetDefaultMountPoint() {
   return window['go']['main']['App']['GetDefaultMountPoint']();
 }
@@ -34,6 +38,10 @@ export function InitializeAPI() {
   return window['go']['main']['App']['InitializeAPI']();
 }
 
+export function InitializeCache(arg1) {
+  return window['go']['main']['App']['InitializeCache'](arg1);
+}
+
 export function LoadFuse() {
   return window['go']['main']['App']['LoadFuse']();
 }
@@ -61,3 +69,7 @@ export function RefreshFuse() {
 export function SelectFile() {
   return window['go']['main']['App']['SelectFile']();
 }
+
+export function SetRefreshInterval(arg1) {
+  return window['go']['main']['App']['SetRefreshInterval'](arg1);
+}
@@ -19,6 +19,22 @@ export namespace filesystem {
 
 export namespace main {
 	
+	export class CacheSettings {
+	    memory: number;
+	    chunkSize: number;
+	    ttl: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new CacheSettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.memory = source["memory"];
+	        this.chunkSize = source["chunkSize"];
+	        this.ttl = source["ttl"];
+	    }
+	}
 	export class Log {
 	    loglevel: string;
 	    timestamp: string;
@@ -2,6 +2,7 @@ package airlock
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5" // #nosec (Can't be helped at the moment)
 	"encoding/base64"
 	"encoding/hex"
@@ -14,6 +15,8 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"sda-filesystem/internal/api"
@@ -29,6 +32,10 @@ import (
 var ai = airlockInfo{}
 var infoFile = "/etc/pam_userinfo/config.json"
 var minimumSegmentSize = 1 << 20
+var parallelSegments = 1
+var segmentAttempts = 3
+var segmentRetryDelay = time.Second
+var streamEncryption = false
 
 type airlockInfo struct {
 	publicKey  [chacha20poly1305.KeySize]byte
@@ -37,6 +44,17 @@ type airlockInfo struct {
 	overridden bool
 }
 
+// SetParallelSegments sets the number of segments that are uploaded at the same time
+func SetParallelSegments(n int) {
+	parallelSegments = max(n, 1)
+}
+
+// SetStreamEncryption sets whether files are encrypted while they are uploaded
+// instead of being encrypted into a temporary file first
+func SetStreamEncryption(stream bool) {
+	streamEncryption = stream
+}
+
 var GetProjectName = func() string {
 	return ai.project
 }
@@ -75,7 +93,7 @@ var IsProjectManager = func(project string) (bool, error) {
 		project = fmt.Sprintf("project_%v", pr)
 	}
 
-	if err := api.MakeRequest(fmt.Sprintf("%v", endpoint), nil, nil, nil, &data); err != nil {
+	if err := api.MakeRequest(context.Background(), fmt.Sprintf("%v", endpoint), nil, nil, nil, &data); err != nil {
 		var re *api.RequestError
 		if errors.As(err, &re) && re.StatusCode == 400 {
 			return false, fmt.Errorf("Invalid token")
@@ -112,7 +130,7 @@ func GetPublicKey() error {
 
 	errStr := "Failed to get public key for Airlock"
 	url := ai.proxy + "/public-key/crypt4gh.pub"
-	err = api.MakeRequest(url, nil, nil, nil, &publicKeySlice)
+	err = api.MakeRequest(context.Background(), url, nil, nil, nil, &publicKeySlice)
 	if err != nil {
 		return fmt.Errorf("%s: %w", errStr, err)
 	}
@@ -144,26 +162,69 @@ func GetPublicKey() error {
 	return nil
 }
 
-// Upload uploads a file to SD Connect
-func Upload(filename, container string, segmentSizeMb uint64, journalNumber, originalFilename string, encrypted bool) error {
+// Upload uploads a file to SD Connect. The progress of segmented uploads is recorded in a journal, and if 'resume'
+// is true, a previous upload of the same file that failed is continued from the first segment that was not uploaded.
+func Upload(filename, container string, segmentSizeMb uint64, journalNumber, originalFilename string, encrypted, resume bool) error {
 	var err error
 	var encryptedFile *os.File
 	var encryptedChecksum string
 	var encryptedFileSize int64
+	var keep bool // whether the encrypted file is kept so that the upload can be resumed
 
 	defer func() {
 		if encryptedFile != nil {
 			encryptedFile.Close()
-			if !encrypted {
+			if !encrypted && !keep {
 				os.Remove(encryptedFile.Name())
 			}
 		}
 	}()
 
+	uploadName := filename
 	if !encrypted {
+		uploadName += ".c4gh"
+	}
+	object, container := reorderNames(uploadName, container)
+	jrnl := previousUpload(container, object, filename, resume)
+
+	segmentSize := segmentSizeMb * uint64(minimumSegmentSize)
+	if jrnl != nil && jrnl.SegmentSize != segmentSize {
+		logs.Infof("Using segment size %v of the previous upload", jrnl.SegmentSize)
+		segmentSize = jrnl.SegmentSize
+	}
+	logs.Debugf("Segment size %v", segmentSize)
+
+	query := map[string]string{
+		"filename":  object,
+		"bucket":    container,
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+	if jrnl != nil {
+		query["timestamp"] = jrnl.Timestamp
+	}
+
+	if journalNumber != "" {
+		query["journal"] = journalNumber
+	}
+
+	switch {
+	case jrnl != nil:
+		logs.Infof("Resuming upload of file %s, %d segments have already been uploaded", filename, len(jrnl.Segments))
+		encryptedFile, err = os.Open(jrnl.File)
+		encryptedChecksum, encryptedFileSize = jrnl.Checksum, jrnl.Size
+	case !encrypted && streamed(filename, segmentSize):
+		logs.Info("Encrypting file ", filename, " while it is uploaded")
+		if err = originalDetails(originalFilename, query); err != nil {
+			return err
+		}
+
+		return uploadStream(filename, uploadName, segmentUpload{
+			segmentSize: segmentSize, manifest: container + "/.segments/" + object + "/", query: query,
+		}, originalFilename != "")
+	case !encrypted:
 		logs.Info("Encrypting file ", filename)
 		encryptedFile, encryptedChecksum, encryptedFileSize, err = getFileDetailsEncrypt(filename)
-	} else {
+	default:
 		logs.Info("File ", filename, " is already encrypted. Skipping encryption.")
 		encryptedFile, encryptedChecksum, encryptedFileSize, err = getFileDetails(filename)
 	}
@@ -172,85 +233,248 @@ func Upload(filename, container string, segmentSizeMb uint64, journalNumber, ori
 		return fmt.Errorf("Failed to get details for file %s: %w", filename, err)
 	}
 
-	if !encrypted {
-		filename += ".c4gh"
-	}
-
 	logs.Debugf("File size %v", encryptedFileSize)
-	segmentSize := segmentSizeMb * uint64(minimumSegmentSize)
-	logs.Debugf("Segment size %v", segmentSize)
 
 	// Get total number of segments
 	segmentNro := uint64(math.Ceil(float64(encryptedFileSize) / float64(segmentSize)))
 
-	object, container := reorderNames(filename, container)
 	logs.Info("Beginning to upload object " + object + " to container " + container)
+	progress := newProgress(filename, PhaseUploading, encryptedFileSize, uploadedBytes(jrnl, encryptedFileSize))
+	defer progress.finish()
 
-	query := map[string]string{
-		"filename":  object,
-		"bucket":    container,
-		"timestamp": time.Now().Format(time.RFC3339),
+	if err = originalDetails(originalFilename, query); err != nil {
+		return err
 	}
-
 	if originalFilename != "" {
-		file, originalChecksum, originalFilesize, err := getFileDetails(originalFilename)
-		if file != nil {
-			file.Close()
-		}
-		if err != nil {
-			return fmt.Errorf("Failed to get details for file %s: %w", originalFilename, err)
-		}
-
-		query["filesize"] = strconv.FormatInt(originalFilesize, 10)
-		query["checksum"] = originalChecksum
 		query["encfilesize"] = strconv.FormatInt(encryptedFileSize, 10)
 		query["encchecksum"] = encryptedChecksum
 	}
 
-	if journalNumber != "" {
-		query["journal"] = journalNumber
-	}
-
 	// If number of segments is 1, do regular upload, else upload file in segments
 	if segmentNro < 2 {
-		err = put("", 1, 1, encryptedFile, query)
+		err = put("", 1, 1, &progressReader{r: encryptedFile, p: progress}, query)
 		if err != nil {
-			return fmt.Errorf("Uploading file %s failed: %w", filepath.Base(filename), err)
+			return fmt.Errorf("Uploading file %s failed: %w", filepath.Base(uploadName), err)
 		}
 	} else {
 		uploadDir := ".segments/" + object + "/"
 
-		for i := uint64(0); i < segmentNro; i++ {
-			segmentStart := int64(float64(i * segmentSize))
-			segmentEnd := int64(math.Min(float64(encryptedFileSize),
-				float64((i+1)*segmentSize)))
-
-			thisSegmentSize := segmentEnd - segmentStart
-			logs.Debugf("Segment start %v", segmentStart)
-			logs.Debugf("Segment end %v", segmentEnd)
+		if jrnl == nil {
+			temporary := ""
+			if !encrypted {
+				temporary = encryptedFile.Name()
+			}
+			jrnl, err = newJournal(container, object, filename, temporary, encryptedChecksum, encryptedFileSize, segmentSize, query["timestamp"])
+			if err == nil {
+				err = jrnl.save()
+			}
+			if err != nil {
+				logs.Warningf("Upload cannot be resumed if it fails: %w", err)
+				jrnl = nil
+			}
+		}
 
-			logs.Infof("Uploading segment %v/%v", i+1, segmentNro)
+		var pending []int
+		for i := 1; i <= int(segmentNro); i++ {
+			if jrnl != nil && jrnl.done(i) {
+				logs.Debugf("Segment %v/%v has already been uploaded", i, segmentNro)
 
-			// Send thisSegmentSize number of bytes to airlock
-			err = put(container+"/"+uploadDir, int(i+1), int(segmentNro),
-				io.LimitReader(encryptedFile, thisSegmentSize), query)
-			if err != nil {
-				return fmt.Errorf("Uploading file %s failed: %w", filepath.Base(filename), err)
+				continue
 			}
+			pending = append(pending, i)
+		}
 
+		upload := segmentUpload{
+			file: encryptedFile, size: encryptedFileSize, segmentSize: segmentSize, total: segmentNro,
+			manifest: container + "/" + uploadDir, query: query, jrnl: jrnl, progress: progress,
+		}
+		if err = upload.run(pending); err != nil {
+			keep = resumable(jrnl, segmentNro)
+
+			return fmt.Errorf("Uploading file %s failed: %w", filepath.Base(uploadName), err)
 		}
 		logs.Info("Uploading manifest file")
 
 		var empty *os.File
 		err = put(container+"/"+uploadDir, -1, -1, empty, query)
 		if err != nil {
+			keep = resumable(jrnl, segmentNro)
+
 			return fmt.Errorf("Uploading manifest file failed: %w", err)
 		}
+		if jrnl != nil {
+			jrnl.remove()
+		}
+	}
+
+	return nil
+}
+
+// originalDetails adds the size and checksum of file 'originalFilename' to 'query' if the filename is not empty
+func originalDetails(originalFilename string, query map[string]string) error {
+	if originalFilename == "" {
+		return nil
+	}
+	file, originalChecksum, originalFilesize, err := getFileDetails(originalFilename)
+	if file != nil {
+		file.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to get details for file %s: %w", originalFilename, err)
 	}
 
+	query["filesize"] = strconv.FormatInt(originalFilesize, 10)
+	query["checksum"] = originalChecksum
+
 	return nil
 }
 
+// segmentUpload contains the details needed for uploading the segments of a file
+type segmentUpload struct {
+	file        io.ReaderAt
+	size        int64 // size of the file
+	segmentSize uint64
+	total       uint64 // number of segments in the file
+	manifest    string
+	query       map[string]string
+	jrnl        *journal
+	progress    *progressTracker
+}
+
+// run uploads segments 'segments' in parallel. Segments whose upload fails are retried. Once a segment has failed
+// for good, no more segments are started, and after the ongoing uploads have finished the failures are reported
+// in the order of the segments.
+func (u *segmentUpload) run(segments []int) error {
+	errs := make([]error, len(segments))
+	jobs := make(chan int)
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for range min(parallelSegments, len(segments)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				segmentStart := int64(uint64(segments[idx]-1) * u.segmentSize)
+				segmentEnd := min(u.size, int64(uint64(segments[idx])*u.segmentSize))
+				if errs[idx] = u.upload(segments[idx], u.file, segmentStart, segmentEnd); errs[idx] != nil {
+					failed.Store(true)
+				} else if u.jrnl != nil {
+					if err := u.jrnl.complete(segments[idx]); err != nil {
+						logs.Warning(err)
+					}
+				}
+			}
+		}()
+	}
+	for idx := range segments {
+		if failed.Load() {
+			break
+		}
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+
+	return u.failures(segments, errs)
+}
+
+// failures combines errors 'errs' of segments 'segments' into one error
+func (u *segmentUpload) failures(segments []int, errs []error) error {
+	var failures []error
+	for idx, err := range errs {
+		if err != nil {
+			failures = append(failures, fmt.Errorf("segment %d/%d: %w", segments[idx], u.total, err))
+		}
+	}
+
+	return errors.Join(failures...)
+}
+
+// upload uploads bytes from 'segmentStart' to 'segmentEnd' of 'file' as segment 'segment',
+// retrying it if the upload fails
+func (u *segmentUpload) upload(segment int, file io.ReaderAt, segmentStart, segmentEnd int64) error {
+	logs.Debugf("Segment start %v", segmentStart)
+	logs.Debugf("Segment end %v", segmentEnd)
+
+	logs.Infof("Uploading segment %v/%v", segment, u.total)
+	for attempt := 1; ; attempt++ {
+		// Send segmentEnd-segmentStart number of bytes to airlock. Section is read from the start on every attempt.
+		reader := &progressReader{r: io.NewSectionReader(file, segmentStart, segmentEnd-segmentStart), p: u.progress}
+		err := put(u.manifest, segment, int(u.total), reader, u.query)
+		if err == nil {
+			return nil
+		}
+		reader.discard()
+		if attempt >= segmentAttempts {
+			return err
+		}
+
+		delay := segmentRetryDelay << (attempt - 1)
+		logs.Warningf("Uploading segment %v/%v failed, retrying in %v: %w", segment, u.total, delay, err)
+		time.Sleep(delay)
+	}
+}
+
+// previousUpload returns the journal of a previous upload of file 'filename' as 'object' to 'container'
+// if the upload is resumed and the journal is valid. Other journals of the object are removed.
+func previousUpload(container, object, filename string, resume bool) *journal {
+	jrnl, err := readJournal(container, object)
+	switch {
+	case err != nil:
+		logs.Warning(err)
+
+		return nil
+	case jrnl == nil:
+		if resume {
+			logs.Infof("No previous upload of file %s was found, starting from the beginning", filename)
+		}
+
+		return nil
+	case !resume:
+		logs.Debugf("Discarding previous upload of object %s", object)
+		jrnl.remove()
+
+		return nil
+	}
+
+	if err = jrnl.check(filename); err != nil {
+		logs.Warningf("Cannot resume upload of file %s, starting from the beginning: %w", filename, err)
+		jrnl.remove()
+
+		return nil
+	}
+
+	return jrnl
+}
+
+// uploadedBytes returns the number of bytes in the segments of a file of 'size' bytes
+// that have already been uploaded according to journal 'jrnl'
+func uploadedBytes(jrnl *journal, size int64) int64 {
+	if jrnl == nil {
+		return 0
+	}
+	var uploaded int64
+	for _, segment := range jrnl.Segments {
+		segmentStart := int64(uint64(segment-1) * jrnl.SegmentSize)
+		uploaded += min(size, int64(uint64(segment)*jrnl.SegmentSize)) - segmentStart
+	}
+
+	return uploaded
+}
+
+// resumable tells whether a failed upload can be resumed with journal 'jrnl'
+func resumable(jrnl *journal, segmentNro uint64) bool {
+	if jrnl == nil {
+		return false
+	}
+	logs.Infof("%d/%d segments were uploaded, the upload can be resumed", len(jrnl.Segments), segmentNro)
+	if jrnl.Temporary {
+		logs.Infof("Encrypted copy %s (%d bytes) of the file is kept until the upload is resumed or discarded", jrnl.File, jrnl.Size)
+	}
+
+	return true
+}
+
 func reorderNames(filename, directory string) (string, string) {
 	before, after, _ := strings.Cut(strings.TrimRight(directory, "/"), "/")
 	object := strings.TrimLeft(after+"/"+filepath.Base(filename), "/")
@@ -336,7 +560,9 @@ var getFileDetailsEncrypt = func(filename string) (encFile *os.File, checksum st
 	if err != nil {
 		return
 	}
-	if _, err = io.Copy(c4ghWriter, file); err != nil {
+	progress := newProgress(filename, PhaseEncrypting, fileSize, 0)
+	defer progress.finish()
+	if _, err = io.Copy(c4ghWriter, &progressReader{r: file, p: progress}); err != nil {
 		return
 	}
 	if err = c4ghWriter.Close(); err != nil {
@@ -377,7 +603,7 @@ var put = func(manifest string, segmentNro, segment_total int,
 
 	var bodyBytes []byte
 	url := ai.proxy + "/airlock"
-	if err := api.MakeRequest(url, query, headers, upload_data, &bodyBytes); err != nil {
+	if err := api.MakeRequest(context.Background(), url, query, headers, upload_data, &bodyBytes); err != nil {
 		var re *api.RequestError
 		if errors.As(err, &re) && string(bodyBytes) != "" {
 			return errors.New(string(bodyBytes))
@@ -2,13 +2,17 @@ package airlock
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -23,7 +27,19 @@ var errExpected = errors.New("Expected error for test")
 
 func TestMain(m *testing.M) {
 	logs.SetSignal(func(string, []string) {})
-	os.Exit(m.Run())
+
+	dir, err := os.MkdirTemp("", "journals")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not create directory for journals: %s\n", err.Error())
+		os.Exit(1)
+	}
+	journalDir = func() (string, error) {
+		return dir, nil
+	}
+	segmentRetryDelay = 0
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
 }
 
 func TestIsProjectManager_NoFile(t *testing.T) {
@@ -105,7 +121,7 @@ func TestIsProjectManager_Error(t *testing.T) {
 			}
 
 			infoFile = file.Name()
-			api.MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+			api.MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 				return tt.err
 			}
 
@@ -166,7 +182,7 @@ func TestIsProjectManager(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.testname, func(t *testing.T) {
-			api.MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+			api.MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 				switch v := ret.(type) {
 				case *map[string]any:
 					(*v)["projectPI"] = tt.data
@@ -215,7 +231,7 @@ func TestPublicKey_Error(t *testing.T) {
 			api.GetEnv = func(name string, verifyURL bool) (string, error) {
 				return "test_url", tt.envErr
 			}
-			api.MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+			api.MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 				return tt.reqErr
 			}
 
@@ -270,7 +286,7 @@ func TestPublicKey_Invalid_Key(t *testing.T) {
 	api.GetEnv = func(name string, verifyURL bool) (string, error) {
 		return "proxy_url", nil
 	}
-	api.MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+	api.MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 		switch v := ret.(type) {
 		case *[]byte:
 			(*v) = []byte(keyStr)
@@ -320,7 +336,7 @@ func TestPublicKey(t *testing.T) {
 	api.GetEnv = func(name string, verifyURL bool) (string, error) {
 		return "proxy_url", nil
 	}
-	api.MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+	api.MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 		switch v := ret.(type) {
 		case *[]byte:
 			(*v) = []byte(keyStr)
@@ -378,7 +394,7 @@ func TestUpload_FileDetails_Error(t *testing.T) {
 			}
 
 			errStr := fmt.Sprintf("Failed to get details for file %s: %s", tt.failOnFile, errExpected.Error())
-			if err := Upload("enc", "container", 400, "", "orig", tt.encrypted); err == nil {
+			if err := Upload("enc", "container", 400, "", "orig", tt.encrypted, false); err == nil {
 				t.Error("Function did not return error")
 			} else if err.Error() != errStr {
 				t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", errStr, err.Error())
@@ -457,7 +473,7 @@ func TestUpload(t *testing.T) {
 		return nil
 	}
 
-	if err := Upload(testFile, testContainer, 100, "", "", false); err != nil {
+	if err := Upload(testFile, testContainer, 100, "", "", false, false); err != nil {
 		t.Errorf("Function returned unexpected error: %s", err.Error())
 	} else if _, err := os.Stat(tempFile.Name()); !errors.Is(err, os.ErrNotExist) {
 		t.Errorf("File should not exist")
@@ -537,7 +553,7 @@ func TestUpload_Encrypted(t *testing.T) {
 				return nil
 			}
 
-			if err := Upload(tt.file, tt.container, 100, tt.journalNumber, tt.origFile, true); err != nil {
+			if err := Upload(tt.file, tt.container, 100, tt.journalNumber, tt.origFile, true, false); err != nil {
 				t.Errorf("Function returned unexpected error: %s", err.Error())
 			}
 		})
@@ -550,7 +566,7 @@ func TestUpload_Error(t *testing.T) {
 		count, size      int
 	}{
 		{"FAIL_1", "Uploading file sample.txt.enc failed: ", 1, 8469},
-		{"FAIL_2", "Uploading file sample.txt.enc failed: ", 2, 114857600},
+		{"FAIL_2", "Uploading file sample.txt.enc failed: segment 2/2: ", 2, 114857600},
 		{"FAIL_3", "Uploading manifest file failed: ", 3, 164789600},
 	}
 
@@ -590,7 +606,7 @@ func TestUpload_Error(t *testing.T) {
 			}
 
 			errStr := tt.errStr + errExpected.Error()
-			err := Upload("../../test/sample.txt.enc", "bucket684", 100, "", "", true)
+			err := Upload("../../test/sample.txt.enc", "bucket684", 100, "", "", true, false)
 			switch {
 			case err == nil:
 				t.Error("Function did not return error")
@@ -670,7 +686,7 @@ func TestUpload_FileContent(t *testing.T) {
 			}
 
 			filename := file.Name()
-			if err := Upload(filename, "bucket684", 1, "", "", tt.encrypted); err != nil {
+			if err := Upload(filename, "bucket684", 1, "", "", tt.encrypted, false); err != nil {
 				t.Errorf("Function returned unexpected error: %s", err.Error())
 			} else if tt.content != buf.String() {
 				t.Errorf("put() read incorrect content\nExpected=%v\nReceived=%v", []byte(tt.content), buf.Bytes())
@@ -685,6 +701,133 @@ func TestUpload_FileContent(t *testing.T) {
 	}
 }
 
+func TestUpload_Parallel(t *testing.T) {
+	origGetFileDetails := getFileDetails
+	origPut := put
+	origMinimumSegmentSize := minimumSegmentSize
+	defer func() {
+		getFileDetails = origGetFileDetails
+		put = origPut
+		minimumSegmentSize = origMinimumSegmentSize
+		SetParallelSegments(1)
+	}()
+
+	minimumSegmentSize = 2
+	SetParallelSegments(3)
+	content := "All work and no play makes Jack a dull boy"
+
+	file := filepath.Join(t.TempDir(), "file.c4gh")
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to create file: %s", err.Error())
+	}
+	getFileDetails = func(filename string) (*os.File, string, int64, error) {
+		f, err := os.Open(filename)
+
+		return f, "", int64(len(content)), err
+	}
+
+	var lock sync.Mutex
+	data := make(map[int]string)
+	attempts := make(map[int]int)
+	var manifest []int
+	put = func(_ string, segmentNro, segment_total int, upload_data io.Reader, _ map[string]string) error {
+		if segmentNro == -1 {
+			lock.Lock()
+			defer lock.Unlock()
+			manifest = append(manifest, len(data))
+
+			return nil
+		}
+		if segment_total != 6 {
+			t.Errorf("Function received incorrect segment total. Expected=6, received=%d", segment_total)
+		}
+		b, err := io.ReadAll(upload_data)
+		if err != nil {
+			return err
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		attempts[segmentNro]++
+		// Second segment fails once and is retried
+		if segmentNro == 2 && attempts[segmentNro] == 1 {
+			return errExpected
+		}
+		if _, ok := data[segmentNro]; ok {
+			t.Errorf("Segment %d was uploaded twice", segmentNro)
+		}
+		data[segmentNro] = string(b)
+
+		return nil
+	}
+
+	if err := Upload(file, "bucket", 4, "", "", true, false); err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+
+	var received string
+	for i := 1; i <= 6; i++ {
+		received += data[i]
+	}
+	switch {
+	case received != content:
+		t.Errorf("Segments contained incorrect data\nExpected=%q\nReceived=%q", content, received)
+	case attempts[2] != 2:
+		t.Errorf("Segment 2 should have been attempted twice, was attempted %d times", attempts[2])
+	case !reflect.DeepEqual(manifest, []int{6}):
+		t.Errorf("Manifest should have been uploaded once after all segments, received %v", manifest)
+	}
+}
+
+func TestSegmentUpload_Run_Error(t *testing.T) {
+	origPut := put
+	defer func() {
+		put = origPut
+		SetParallelSegments(1)
+	}()
+
+	SetParallelSegments(5)
+
+	// Failing segments wait until every segment has been started so that all of them are attempted
+	var started sync.WaitGroup
+	started.Add(5)
+	var lock sync.Mutex
+	attempts := make(map[int]int)
+	put = func(_ string, segmentNro, _ int, _ io.Reader, _ map[string]string) error {
+		lock.Lock()
+		attempts[segmentNro]++
+		first := attempts[segmentNro] == 1
+		lock.Unlock()
+		if first {
+			started.Done()
+		}
+		if segmentNro != 2 && segmentNro != 5 {
+			return nil
+		}
+		started.Wait()
+
+		return fmt.Errorf("Segment %d is broken", segmentNro)
+	}
+
+	jrnl := &journal{path: filepath.Join(t.TempDir(), "journal.json")}
+	upload := segmentUpload{file: strings.NewReader("0123456789"), size: 10, segmentSize: 2, total: 5, jrnl: jrnl}
+	err := upload.run([]int{1, 2, 3, 4, 5})
+
+	errStr := "segment 2/5: Segment 2 is broken\nsegment 5/5: Segment 5 is broken"
+	if err == nil {
+		t.Fatal("Function did not return error")
+	} else if err.Error() != errStr {
+		t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", errStr, err.Error())
+	}
+	if attempts[2] != segmentAttempts || attempts[5] != segmentAttempts {
+		t.Errorf("Failed segments should have been attempted %d times, received %v", segmentAttempts, attempts)
+	}
+	sort.Ints(jrnl.Segments)
+	if !reflect.DeepEqual(jrnl.Segments, []int{1, 3, 4}) {
+		t.Errorf("Journal contains incorrect segments %v", jrnl.Segments)
+	}
+}
+
 func TestFileDetails_NoFile(t *testing.T) {
 	file, err := os.CreateTemp("", "file")
 	if err != nil {
@@ -999,7 +1142,7 @@ func TestPut(t *testing.T) {
 			api.GetSDSToken = func() string {
 				return tt.token
 			}
-			api.MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+			api.MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 				if url != testURL+"/airlock" {
 					t.Errorf("Function received incorrect url\nExpected=%s\nReceived=%s", testURL+"/airlock", url)
 				}
@@ -1047,7 +1190,7 @@ func TestPut_Error(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.testname, func(t *testing.T) {
-			api.MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+			api.MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 				switch v := ret.(type) {
 				case *[]byte:
 					(*v) = []byte("request body error")
@@ -0,0 +1,206 @@
+package airlock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"sda-filesystem/internal/logs"
+)
+
+// journalDir returns the directory where the journals of segmented uploads are stored
+var journalDir = func() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "sda-filesystem", "airlock"), nil
+}
+
+// journal records which segments of an upload have been completed, so that a failed upload
+// can be continued without uploading the whole file again
+type journal struct {
+	Container      string    `json:"container"`
+	Object         string    `json:"object"`
+	Source         string    `json:"source"`          // absolute path of the file that is exported
+	SourceSize     int64     `json:"source_size"`     // size of the source when the upload began
+	SourceModified time.Time `json:"source_modified"` // modification time of the source when the upload began
+	File           string    `json:"file"`            // file that is uploaded
+	Temporary      bool      `json:"temporary"`       // whether the uploaded file was created by encrypting the source
+	Checksum       string    `json:"checksum"`        // md5 checksum of the uploaded file
+	Size           int64     `json:"size"`            // size of the uploaded file
+	SegmentSize    uint64    `json:"segment_size"`
+	Timestamp      string    `json:"timestamp"`
+	Segments       []int     `json:"segments"` // numbers of the uploaded segments
+	path           string
+	lock           sync.Mutex // segments can be completed concurrently
+}
+
+// journalPath returns the path of the journal of 'object' in 'container'
+func journalPath(container, object string) (string, error) {
+	dir, err := journalDir()
+	if err != nil {
+		return "", fmt.Errorf("Could not determine directory for upload journal: %w", err)
+	}
+	sum := sha256.Sum256([]byte(container + "\x00" + object))
+
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// newJournal creates a journal for exporting file 'source' as 'object' to 'container'. 'file' is the temporary file
+// that is uploaded if the source was encrypted for the upload, or empty if the source itself is uploaded.
+func newJournal(container, object, source, file, checksum string, size int64, segmentSize uint64, timestamp string) (*journal, error) {
+	path, err := journalPath(container, object)
+	if err != nil {
+		return nil, err
+	}
+	if source, err = filepath.Abs(source); err != nil {
+		return nil, fmt.Errorf("Could not determine path of %s: %w", source, err)
+	}
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read file %s: %w", source, err)
+	}
+	temporary := file != ""
+	if !temporary {
+		file = source
+	}
+
+	return &journal{
+		Container: container, Object: object, Source: source, SourceSize: info.Size(), SourceModified: info.ModTime(),
+		File: file, Temporary: temporary, Checksum: checksum, Size: size, SegmentSize: segmentSize, Timestamp: timestamp, Segments: []int{},
+		path: path,
+	}, nil
+}
+
+// readJournal returns the journal of 'object' in 'container', or nil if there is none
+func readJournal(container, object string) (*journal, error) {
+	path, err := journalPath(container, object)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not read upload journal %s: %w", path, err)
+	}
+
+	j := &journal{path: path}
+	if err = json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("Could not read upload journal %s: %w", path, err)
+	}
+
+	return j, nil
+}
+
+// check returns an error if the upload in the journal cannot be continued for exporting file 'source'
+func (j *journal) check(source string) error {
+	source, err := filepath.Abs(source)
+	if err != nil {
+		return err
+	}
+	if j.Source != source {
+		return fmt.Errorf("previous upload exported file %s", j.Source)
+	}
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if info.Size() != j.SourceSize || !info.ModTime().Equal(j.SourceModified) {
+		return fmt.Errorf("file %s has been modified", source)
+	}
+	if info, err = os.Stat(j.File); err != nil {
+		return err
+	}
+	if info.Size() != j.Size {
+		return fmt.Errorf("file %s has been modified", j.File)
+	}
+
+	return nil
+}
+
+// done tells whether segment 'segment' has already been uploaded
+func (j *journal) done(segment int) bool {
+	return slices.Contains(j.Segments, segment)
+}
+
+// complete records that segment 'segment' has been uploaded
+func (j *journal) complete(segment int) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.Segments = append(j.Segments, segment)
+
+	return j.save()
+}
+
+// save writes the journal to disk. The journal is first written to a temporary file
+// so that an interruption does not leave a partial journal behind.
+func (j *journal) save() error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("Could not save upload journal: %w", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+		return fmt.Errorf("Could not save upload journal: %w", err)
+	}
+	tmp := j.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("Could not save upload journal: %w", err)
+	}
+	if err = os.Rename(tmp, j.path); err != nil {
+		return fmt.Errorf("Could not save upload journal: %w", err)
+	}
+
+	return nil
+}
+
+// remove deletes the journal, and the uploaded file if it is temporary
+func (j *journal) remove() {
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logs.Warningf("Could not remove upload journal %s: %w", j.path, err)
+	}
+	if j.Temporary {
+		if err := os.Remove(j.File); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logs.Warningf("Could not remove file %s: %w", j.File, err)
+		}
+	}
+}
+
+// DiscardUploads removes the journals of all failed uploads, along with the encrypted copies of files
+// that were kept so that the uploads could be resumed. Returns the number of discarded uploads.
+func DiscardUploads() (int, error) {
+	dir, err := journalDir()
+	if err != nil {
+		return 0, fmt.Errorf("Could not determine directory for upload journals: %w", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return 0, fmt.Errorf("Could not list upload journals: %w", err)
+	}
+
+	for _, path := range paths {
+		j := &journal{path: path}
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, j)
+		}
+		if err != nil {
+			// Journal is removed anyway, but the file it refers to is not known
+			logs.Warningf("Could not read upload journal %s: %w", path, err)
+		}
+		logs.Debugf("Discarding upload of object %s to container %s", j.Object, j.Container)
+		j.remove()
+	}
+
+	return len(paths), nil
+}
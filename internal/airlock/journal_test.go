@@ -0,0 +1,246 @@
+package airlock
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUpload_Resume(t *testing.T) {
+	origGetFileDetails := getFileDetails
+	origGetFileDetailsEncrypt := getFileDetailsEncrypt
+	origPut := put
+	origMinimumSegmentSize := minimumSegmentSize
+	defer func() {
+		getFileDetails = origGetFileDetails
+		getFileDetailsEncrypt = origGetFileDetailsEncrypt
+		put = origPut
+		minimumSegmentSize = origMinimumSegmentSize
+	}()
+
+	minimumSegmentSize = 4
+	content := "encrypted content of the file"
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(source, []byte("original content"), 0600); err != nil {
+		t.Fatalf("Failed to create file: %s", err.Error())
+	}
+	encryptedName := filepath.Join(dir, "encrypted.c4gh")
+
+	getFileDetails = func(filename string) (*os.File, string, int64, error) {
+		return nil, "", 0, errors.New("Should not have called getFileDetails()")
+	}
+	encryptions := 0
+	getFileDetailsEncrypt = func(filename string) (*os.File, string, int64, error) {
+		encryptions++
+		if err := os.WriteFile(encryptedName, []byte(content), 0600); err != nil {
+			return nil, "", 0, err
+		}
+		file, err := os.Open(encryptedName)
+
+		return file, "checksum", int64(len(content)), err
+	}
+
+	var segments []int
+	var timestamps []string
+	data := make(map[int]string)
+	failOn := 5
+	put = func(manifest string, segmentNro, segment_total int, upload_data io.Reader, query map[string]string) error {
+		if segmentNro == failOn {
+			return errExpected
+		}
+		if segmentNro != -1 {
+			buf := &bytes.Buffer{}
+			if _, err := buf.ReadFrom(upload_data); err != nil {
+				return err
+			}
+			data[segmentNro] = buf.String()
+		}
+		segments = append(segments, segmentNro)
+		timestamps = append(timestamps, query["timestamp"])
+
+		return nil
+	}
+
+	// Segment size is 2 * 4 bytes, which means the file has 4 segments and the upload fails at the manifest
+	failOn = -1
+	if err := Upload(source, "bucket/dir", 2, "", "", false, false); err == nil {
+		t.Fatal("Function did not return error")
+	}
+	if _, err := os.Stat(encryptedName); err != nil {
+		t.Fatalf("Encrypted file should have been kept: %s", err.Error())
+	}
+	jrnl, err := readJournal("bucket", "dir/file.txt.c4gh")
+	switch {
+	case err != nil:
+		t.Fatalf("Could not read journal: %s", err.Error())
+	case jrnl == nil:
+		t.Fatal("Journal should have been saved")
+	case !reflect.DeepEqual(jrnl.Segments, []int{1, 2, 3, 4}):
+		t.Fatalf("Journal contains incorrect segments %v", jrnl.Segments)
+	}
+
+	// Journal is modified so that the upload continues from the third segment
+	jrnl.Segments, jrnl.Timestamp = []int{1, 2}, "2024-05-06T07:08:09Z"
+	if err = jrnl.save(); err != nil {
+		t.Fatalf("Could not save journal: %s", err.Error())
+	}
+	failOn, segments, timestamps, data = 0, nil, nil, make(map[int]string)
+	if err = Upload(source, "bucket/dir", 100, "", "", false, true); err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+
+	switch {
+	case encryptions != 1:
+		t.Errorf("File should have been encrypted once, was encrypted %d times", encryptions)
+	case !reflect.DeepEqual(segments, []int{3, 4, -1}):
+		t.Errorf("Incorrect segments uploaded. Expected=%v, received=%v", []int{3, 4, -1}, segments)
+	case data[3]+data[4] != content[16:]:
+		t.Errorf("Incorrect data uploaded\nExpected=%q\nReceived=%q", content[16:], data[3]+data[4])
+	case !reflect.DeepEqual(timestamps, []string{jrnl.Timestamp, jrnl.Timestamp, jrnl.Timestamp}):
+		t.Errorf("Resumed upload should have used timestamp %s of the previous upload, received %v", jrnl.Timestamp, timestamps)
+	}
+	if _, err = os.Stat(encryptedName); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Encrypted file should have been removed")
+	}
+	if jrnl, err = readJournal("bucket", "dir/file.txt.c4gh"); err != nil || jrnl != nil {
+		t.Errorf("Journal should have been removed")
+	}
+}
+
+func TestPreviousUpload(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "file.txt")
+	temporary := filepath.Join(dir, "file.txt.c4gh")
+
+	var tests = []struct {
+		testname string
+		resume   bool
+		modify   func() error
+		valid    bool
+	}{
+		{"OK", true, func() error { return nil }, true},
+		{"NOT_RESUMED", false, func() error { return nil }, false},
+		{"SOURCE_MODIFIED", true, func() error { return os.WriteFile(source, []byte("other"), 0600) }, false},
+		{"TEMPORARY_MODIFIED", true, func() error { return os.WriteFile(temporary, []byte("x"), 0600) }, false},
+		{"TEMPORARY_REMOVED", true, func() error { return os.Remove(temporary) }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			if err := os.WriteFile(source, []byte("content"), 0600); err != nil {
+				t.Fatalf("Failed to create file: %s", err.Error())
+			}
+			if err := os.WriteFile(temporary, []byte("encrypted"), 0600); err != nil {
+				t.Fatalf("Failed to create file: %s", err.Error())
+			}
+			jrnl, err := newJournal("bucket", "file.txt.c4gh", source, temporary, "checksum", 9, 10, "now")
+			if err == nil {
+				err = jrnl.complete(1)
+			}
+			if err != nil {
+				t.Fatalf("Could not save journal: %s", err.Error())
+			}
+			if err = tt.modify(); err != nil {
+				t.Fatalf("Could not modify files: %s", err.Error())
+			}
+
+			prev := previousUpload("bucket", "file.txt.c4gh", source, tt.resume)
+			switch {
+			case tt.valid && prev == nil:
+				t.Fatal("Function should have returned journal")
+			case !tt.valid && prev != nil:
+				t.Errorf("Function should not have returned journal")
+			case tt.valid:
+				if !prev.SourceModified.Equal(jrnl.SourceModified) {
+					t.Errorf("Incorrect modification time. Expected=%v, received=%v", jrnl.SourceModified, prev.SourceModified)
+				}
+				prev.SourceModified = jrnl.SourceModified
+				if !reflect.DeepEqual(prev, jrnl) {
+					t.Errorf("Function returned incorrect journal\nExpected=%+v\nReceived=%+v", jrnl, prev)
+				}
+			}
+
+			_, errJournal := os.Stat(jrnl.path)
+			_, errTemporary := os.Stat(temporary)
+			if tt.valid {
+				jrnl.remove()
+			} else if !errors.Is(errJournal, os.ErrNotExist) || !errors.Is(errTemporary, os.ErrNotExist) {
+				t.Errorf("Journal and temporary file should have been removed")
+			}
+			if _, err = os.Stat(source); err != nil {
+				t.Errorf("Source file should not have been removed")
+			}
+		})
+	}
+}
+
+func TestJournalPath(t *testing.T) {
+	path1, err1 := journalPath("bucket", "dir/file")
+	path2, err2 := journalPath("bucket/dir", "file")
+	switch {
+	case err1 != nil || err2 != nil:
+		t.Fatalf("Function returned unexpected error: %v, %v", err1, err2)
+	case path1 == path2:
+		t.Errorf("Journals of different objects should not have the same path %s", path1)
+	case !strings.HasSuffix(path1, ".json"):
+		t.Errorf("Journal path %s should have suffix .json", path1)
+	}
+}
+
+func TestDiscardUploads(t *testing.T) {
+	origJournalDir := journalDir
+	defer func() { journalDir = origJournalDir }()
+
+	dir := t.TempDir()
+	journals := filepath.Join(dir, "journals")
+	journalDir = func() (string, error) {
+		return journals, nil
+	}
+
+	source := filepath.Join(dir, "file.txt")
+	temporary := filepath.Join(dir, "file.txt.c4gh")
+	if err := os.WriteFile(source, []byte("content"), 0600); err != nil {
+		t.Fatalf("Failed to create file: %s", err.Error())
+	}
+	if err := os.WriteFile(temporary, []byte("encrypted"), 0600); err != nil {
+		t.Fatalf("Failed to create file: %s", err.Error())
+	}
+	jrnl, err := newJournal("bucket", "file.txt.c4gh", source, temporary, "checksum", 9, 10, "now")
+	if err == nil {
+		err = jrnl.save()
+	}
+	if err != nil {
+		t.Fatalf("Could not save journal: %s", err.Error())
+	}
+	if err = os.WriteFile(filepath.Join(journals, "broken.json"), []byte("{"), 0600); err != nil {
+		t.Fatalf("Failed to create file: %s", err.Error())
+	}
+
+	n, err := DiscardUploads()
+	switch {
+	case err != nil:
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	case n != 2:
+		t.Errorf("Function discarded incorrect number of uploads. Expected=2, received=%d", n)
+	}
+	if entries, _ := os.ReadDir(journals); len(entries) != 0 {
+		t.Errorf("Journals were not removed: %v", entries)
+	}
+	if _, err = os.Stat(temporary); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Encrypted copy should have been removed")
+	}
+	if _, err = os.Stat(source); err != nil {
+		t.Errorf("Source file should not have been removed")
+	}
+
+	if n, err = DiscardUploads(); err != nil || n != 0 {
+		t.Errorf("Function should have discarded nothing, received %d, %v", n, err)
+	}
+}
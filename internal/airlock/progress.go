@@ -0,0 +1,157 @@
+package airlock
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Phases of an upload that are reported to the progress observer
+const (
+	PhaseEncrypting = "encrypting"
+	PhaseUploading  = "uploading"
+)
+
+// Progress is the state of one phase of an upload
+type Progress struct {
+	Filename  string  `json:"filename"`
+	Phase     string  `json:"phase"`
+	Bytes     int64   `json:"bytes"`     // number of bytes processed so far
+	Total     int64   `json:"total"`     // number of bytes in the phase
+	Speed     float64 `json:"speed"`     // bytes per second
+	Remaining float64 `json:"remaining"` // estimated number of seconds until the phase is complete, negative if unknown
+	Done      bool    `json:"done"`      // whether the phase has ended, either successfully or not
+}
+
+var progressObserver func(Progress)
+
+// progressInterval is the minimum time between two reports of the same phase
+var progressInterval = 200 * time.Millisecond
+
+// SetProgressObserver sets the function to which the progress of uploads is reported. The function is called
+// when a phase begins, at most every 200 milliseconds while it is running, and when it ends.
+func SetProgressObserver(fn func(Progress)) {
+	progressObserver = fn
+}
+
+// progressTracker counts the bytes processed in one phase of an upload and reports them to the progress observer.
+// A nil tracker is valid and does nothing, which is what newProgress returns if there is no observer.
+type progressTracker struct {
+	observer func(Progress)
+	progress Progress
+	initial  int64 // bytes that had been processed before the tracker was created
+	start    time.Time
+	bytes    atomic.Int64
+	lock     sync.Mutex // reports are sent one at a time
+	reported time.Time
+}
+
+// newProgress starts tracking phase 'phase' of the upload of file 'filename'. 'initial' bytes of the
+// 'total' bytes have already been processed, e.g. by an earlier upload that is being resumed.
+func newProgress(filename, phase string, total, initial int64) *progressTracker {
+	if progressObserver == nil {
+		return nil
+	}
+
+	p := &progressTracker{
+		observer: progressObserver, progress: Progress{Filename: filename, Phase: phase, Total: total},
+		initial: initial, start: time.Now(),
+	}
+	p.bytes.Store(initial)
+	p.report(true)
+
+	return p
+}
+
+// add records that 'n' more bytes have been processed. 'n' is negative if bytes need to be processed again.
+func (p *progressTracker) add(n int64) {
+	if p == nil || n == 0 {
+		return
+	}
+	p.bytes.Add(n)
+	p.report(false)
+}
+
+// finish reports that the phase has ended
+func (p *progressTracker) finish() {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	p.progress.Done = true
+	p.lock.Unlock()
+	p.report(true)
+}
+
+// report sends the progress to the observer unless it was sent less than 'progressInterval' ago and 'force' is false
+func (p *progressTracker) report(force bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	if !force && now.Sub(p.reported) < progressInterval {
+		return
+	}
+	p.reported = now
+
+	progress := p.progress
+	progress.Bytes = p.bytes.Load()
+	progress.Remaining = -1
+	if elapsed := now.Sub(p.start).Seconds(); elapsed > 0 {
+		progress.Speed = float64(progress.Bytes-p.initial) / elapsed
+	}
+	if progress.Speed > 0 {
+		progress.Remaining = float64(progress.Total-progress.Bytes) / progress.Speed
+	}
+	p.observer(progress)
+}
+
+// progressReader counts the bytes that are read from 'r'. If 'r' can seek, so can progressReader, so that
+// requests can still be retried, and the bytes that are read again are not counted twice.
+type progressReader struct {
+	r    io.Reader
+	p    *progressTracker
+	read int64 // bytes counted by this reader
+	pos  int64 // offset from the position where reading started
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.pos += int64(n)
+	if pr.pos > pr.read {
+		pr.p.add(pr.pos - pr.read)
+		pr.read = pr.pos
+	}
+
+	return n, err
+}
+
+func (pr *progressReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := pr.r.(io.Seeker)
+	if !ok {
+		return 0, errors.New("reader cannot seek")
+	}
+	current, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	abs, err := seeker.Seek(offset, whence)
+	if err != nil {
+		return abs, err
+	}
+	pr.pos += abs - current
+	if pr.pos < pr.read {
+		pr.p.add(max(pr.pos, 0) - pr.read)
+		pr.read = max(pr.pos, 0)
+	}
+
+	return abs, nil
+}
+
+// discard uncounts the bytes counted by the reader once it is no longer used, since they need to be read again
+func (pr *progressReader) discard() {
+	pr.p.add(-pr.read)
+	pr.read = 0
+}
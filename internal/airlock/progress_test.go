@@ -0,0 +1,133 @@
+package airlock
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/neicnordic/crypt4gh/keys"
+)
+
+func TestProgressReader(t *testing.T) {
+	origProgressObserver := progressObserver
+	defer func() { progressObserver = origProgressObserver }()
+
+	var last Progress
+	progressObserver = func(p Progress) { last = p }
+	progress := newProgress("file", PhaseUploading, 10, 0)
+	reader := &progressReader{r: strings.NewReader("0123456789"), p: progress}
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		t.Fatalf("Could not read data: %s", err.Error())
+	}
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("Could not seek: %s", err.Error())
+	}
+	if progress.bytes.Load() != 0 {
+		t.Errorf("Bytes read before seeking back should not be counted, received %d", progress.bytes.Load())
+	}
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Fatalf("Could not read data: %s", err.Error())
+	}
+	if progress.bytes.Load() != 10 {
+		t.Errorf("Incorrect number of bytes. Expected=10, received=%d", progress.bytes.Load())
+	}
+	reader.discard()
+	progress.finish()
+	if last.Bytes != 0 || !last.Done {
+		t.Errorf("Discarded bytes should not be counted, received %+v", last)
+	}
+
+	if _, err := (&progressReader{r: io.LimitReader(strings.NewReader(""), 0)}).Seek(0, io.SeekStart); err == nil {
+		t.Errorf("Reader that cannot seek should have returned error")
+	}
+}
+
+func TestUpload_Progress(t *testing.T) {
+	origPut := put
+	origMinimumSegmentSize := minimumSegmentSize
+	origPublicKey := ai.publicKey
+	origProgressObserver := progressObserver
+	origProgressInterval := progressInterval
+	defer func() {
+		put = origPut
+		minimumSegmentSize = origMinimumSegmentSize
+		ai.publicKey = origPublicKey
+		progressObserver = origProgressObserver
+		progressInterval = origProgressInterval
+	}()
+
+	publicKey, _, err := keys.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Could not generate key pair: %s", err.Error())
+	}
+	ai.publicKey = publicKey
+	minimumSegmentSize = 100
+	progressInterval = 0
+
+	content := strings.Repeat("All work and no play makes Jack a dull boy\n", 20)
+	file := filepath.Join(t.TempDir(), "file.txt")
+	if err = os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to create file: %s", err.Error())
+	}
+
+	var lock sync.Mutex
+	reports := make(map[string][]Progress)
+	SetProgressObserver(func(p Progress) {
+		lock.Lock()
+		defer lock.Unlock()
+		reports[p.Phase] = append(reports[p.Phase], p)
+	})
+
+	attempts := make(map[int]int)
+	put = func(_ string, segmentNro, _ int, upload_data io.Reader, _ map[string]string) error {
+		if segmentNro == -1 {
+			return nil
+		}
+		if _, err := io.ReadAll(upload_data); err != nil {
+			return err
+		}
+		// Second segment fails once after it has been read, so its bytes are counted again when it is retried
+		attempts[segmentNro]++
+		if segmentNro == 2 && attempts[segmentNro] == 1 {
+			return errExpected
+		}
+
+		return nil
+	}
+
+	if err = Upload(file, "bucket", 2, "", "", false, false); err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+
+	for phase, total := range map[string]int64{PhaseEncrypting: int64(len(content)), PhaseUploading: -1} {
+		received := reports[phase]
+		if len(received) < 2 {
+			t.Errorf("Phase %s should have been reported at least twice, received %v", phase, received)
+
+			continue
+		}
+		first, last := received[0], received[len(received)-1]
+		if total < 0 {
+			total = last.Total
+		}
+		switch {
+		case first.Filename != file || first.Bytes != 0 || first.Done:
+			t.Errorf("Incorrect first report for phase %s: %+v", phase, first)
+		case last.Total != total || last.Bytes != total || !last.Done:
+			t.Errorf("Incorrect last report for phase %s: %+v", phase, last)
+		}
+		for _, p := range received {
+			if p.Bytes > p.Total || p.Bytes < 0 {
+				t.Errorf("Phase %s reported %d/%d bytes", phase, p.Bytes, p.Total)
+			}
+		}
+	}
+	if reports[PhaseUploading][0].Total <= int64(len(content)) {
+		t.Errorf("Size of the encrypted file should have been reported, received %d", reports[PhaseUploading][0].Total)
+	}
+}
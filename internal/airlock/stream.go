@@ -0,0 +1,221 @@
+package airlock
+
+import (
+	"bytes"
+	"crypto/md5" // #nosec (Can't be helped at the moment)
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"sda-filesystem/internal/logs"
+	"sda-filesystem/internal/mountpoint"
+
+	"github.com/neicnordic/crypt4gh/model/headers"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// errStopped is returned by segmentWriter once the upload has failed and no more segments are needed
+var errStopped = errors.New("upload stopped")
+
+// streamed tells whether file 'filename' is encrypted while it is uploaded. This is the case if encryption
+// is streamed or if there is not enough space for an encrypted copy of the file. Files that fit in one segment
+// are always encrypted into a temporary file first, and so are files whose segments are smaller than a block
+// of the encrypted file, so that the header of the encrypted file fits in the first segment.
+var streamed = func(filename string, segmentSize uint64) bool {
+	info, err := os.Stat(filename)
+	if err != nil || uint64(info.Size()) < segmentSize || segmentSize < uint64(headers.UnencryptedDataSegmentSize) {
+		return false
+	}
+	if streamEncryption {
+		return true
+	}
+
+	memLeft, err := mountpoint.BytesAvailable(os.TempDir())
+	if err != nil || int64(memLeft) >= info.Size() {
+		return false
+	}
+	logs.Infof("Not enough space for an encrypted copy of file %s", filename)
+
+	return true
+}
+
+// encryptedSize returns the size of a file of 'size' bytes once it has been encrypted with a header of 'headerSize'
+// bytes. Each block of the file is encrypted separately and a file always has at least one block.
+func encryptedSize(headerSize, size int64) int64 {
+	blockSize := int64(headers.UnencryptedDataSegmentSize)
+	blocks := max((size+blockSize-1)/blockSize, 1)
+
+	return headerSize + size + blocks*(chacha20poly1305.NonceSize+chacha20poly1305.Overhead)
+}
+
+// segmentWriter splits the data written to it into segments of 'size' bytes, which are uploaded with 'upload' while
+// they are written. Segments are uploaded one at a time, since the next segment is written only once the previous
+// one has been sent. Writing fails once the upload of a segment has failed.
+type segmentWriter struct {
+	size    int64
+	upload  func(segment int, r io.Reader) error
+	current *io.PipeWriter // writer of the segment that is being uploaded
+	done    chan error     // result of the upload of the current segment
+	segment int            // number of the current segment
+	n       int64          // number of bytes written to the current segment
+	written int64          // number of bytes written in total
+	failed  int            // number of the segment whose upload failed
+	err     error          // error of the failed segment
+}
+
+func (w *segmentWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if w.err != nil {
+			return written, errStopped
+		}
+		if w.current == nil {
+			w.start()
+		}
+
+		n, err := w.current.Write(p[:min(int64(len(p)), w.size-w.n)])
+		written += n
+		w.written += int64(n)
+		w.n += int64(n)
+		p = p[n:]
+		if err != nil || w.n == w.size {
+			w.finish()
+		}
+		if err != nil && w.err == nil {
+			w.failed, w.err = w.segment, errors.New("segment was not sent completely")
+		}
+	}
+
+	return written, nil
+}
+
+// start begins the upload of the next segment
+func (w *segmentWriter) start() {
+	r, pw := io.Pipe()
+	w.current, w.done = pw, make(chan error, 1)
+	w.segment, w.n = int(w.written/w.size)+1, 0
+	go func(segment int) {
+		err := w.upload(segment, r)
+		// Writing fails if the upload has stopped reading the segment
+		r.CloseWithError(errStopped)
+		w.done <- err
+	}(w.segment)
+}
+
+// finish ends the current segment and waits for its upload to finish
+func (w *segmentWriter) finish() {
+	w.current.Close()
+	if err := <-w.done; err != nil {
+		w.failed, w.err = w.segment, err
+	}
+	w.current = nil
+}
+
+// Close finishes the upload of the last segment if it is not empty.
+// Returns the error of the segment whose upload failed, if any.
+func (w *segmentWriter) Close() error {
+	if w.current != nil {
+		w.finish()
+	}
+
+	return w.err
+}
+
+// switchWriter passes the data written to it to 'w', which can be changed between writes
+type switchWriter struct {
+	w io.Writer
+}
+
+func (w *switchWriter) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
+// uploadStream uploads file 'filename' as 'uploadName' while it is encrypted, so that the disk does not need
+// space for an encrypted copy of the file. The encrypted file is split into segments that are sent to the server
+// as they are encrypted, so nothing is written to disk. This also means that segments are uploaded one at a time
+// and that a segment whose upload fails cannot be retried. The size of the encrypted file is known beforehand, but
+// its checksum only once the file has been read, which is why the checksum is sent with the manifest if 'checksum'
+// is true. The upload cannot be resumed since the encryption is different each time.
+func uploadStream(filename, uploadName string, u segmentUpload, checksum bool) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("Failed to get details for file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("Failed to get details for file %s: %w", filename, err)
+	}
+
+	hash := md5.New() // #nosec
+	sw := &segmentWriter{size: int64(u.segmentSize)}
+	sw.upload = func(segment int, r io.Reader) error {
+		if uint64(segment) > u.total {
+			// The size of the encrypted file is checked once it has been written
+			return fmt.Errorf("encrypted file is larger than the expected %d bytes", u.size)
+		}
+		logs.Infof("Uploading segment %v/%v", segment, u.total)
+		reader := &progressReader{r: r, p: u.progress}
+		if err := put(u.manifest, segment, int(u.total), reader, u.query); err != nil {
+			reader.discard()
+
+			return err
+		}
+
+		return nil
+	}
+	// The header is kept in memory until the size of the encrypted file is known
+	header := &bytes.Buffer{}
+	output := &switchWriter{w: header}
+	c4ghWriter, err := newCrypt4GHWriter(output)
+	if err != nil {
+		return fmt.Errorf("Failed to encrypt file %s: %w", filename, err)
+	}
+
+	u.size = encryptedSize(int64(header.Len()), info.Size())
+	u.total = uint64(math.Ceil(float64(u.size) / float64(u.segmentSize)))
+	logs.Debugf("File size %v", u.size)
+	logs.Info("Beginning to upload object " + u.query["filename"] + " to container " + u.query["bucket"])
+	u.progress = newProgress(filename, PhaseUploading, u.size, 0)
+	defer u.progress.finish()
+
+	output.w = io.MultiWriter(hash, sw)
+	_, err = output.Write(header.Bytes())
+	if err == nil {
+		_, err = io.Copy(c4ghWriter, file)
+	}
+	if err == nil {
+		err = c4ghWriter.Close()
+	}
+	if closeErr := sw.Close(); closeErr != nil {
+		return fmt.Errorf("Uploading file %s failed: %w", filepath.Base(uploadName), u.failures([]int{sw.failed}, []error{closeErr}))
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to encrypt file %s: %w", filename, err)
+	}
+	if sw.written != u.size {
+		return fmt.Errorf("Encrypted file %s has size %d instead of the expected %d", filename, sw.written, u.size)
+	}
+
+	if checksum {
+		query := maps.Clone(u.query)
+		query["encfilesize"] = strconv.FormatInt(u.size, 10)
+		query["encchecksum"] = hex.EncodeToString(hash.Sum(nil))
+		u.query = query
+	}
+
+	logs.Info("Uploading manifest file")
+	var empty *os.File
+	if err = put(u.manifest, -1, -1, empty, u.query); err != nil {
+		return fmt.Errorf("Uploading manifest file failed: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package airlock
+
+import (
+	"bytes"
+	"crypto/md5" // #nosec
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/neicnordic/crypt4gh/keys"
+	"github.com/neicnordic/crypt4gh/streaming"
+)
+
+func TestEncryptedSize(t *testing.T) {
+	origPublicKey := ai.publicKey
+	defer func() { ai.publicKey = origPublicKey }()
+
+	publicKey, _, err := keys.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Could not generate key pair: %s", err.Error())
+	}
+	ai.publicKey = publicKey
+
+	for _, size := range []int{0, 1, 65535, 65536, 65537, 200000} {
+		t.Run(strconv.Itoa(size), func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			c4ghWriter, err := newCrypt4GHWriter(buf)
+			if err != nil {
+				t.Fatalf("Could not create crypt4gh writer: %s", err.Error())
+			}
+			headerSize := int64(buf.Len())
+			if _, err = c4ghWriter.Write(make([]byte, size)); err == nil {
+				err = c4ghWriter.Close()
+			}
+			if err != nil {
+				t.Fatalf("Could not encrypt data: %s", err.Error())
+			}
+
+			if encSize := encryptedSize(headerSize, int64(size)); encSize != int64(buf.Len()) {
+				t.Errorf("Function returned incorrect size. Expected=%d, received=%d", buf.Len(), encSize)
+			}
+		})
+	}
+}
+
+func TestUpload_Stream(t *testing.T) {
+	var tests = []struct {
+		testname, errStr string
+		failOn           int
+	}{
+		{"OK", "", 0},
+		{"FAIL_SEGMENT", "Uploading file file.txt.c4gh failed: segment 2/4: " + errExpected.Error(), 2},
+		{"FAIL_MANIFEST", "Uploading manifest file failed: " + errExpected.Error(), -1},
+	}
+
+	origGetFileDetailsEncrypt := getFileDetailsEncrypt
+	origPut := put
+	origMinimumSegmentSize := minimumSegmentSize
+	origPublicKey := ai.publicKey
+	defer func() {
+		getFileDetailsEncrypt = origGetFileDetailsEncrypt
+		put = origPut
+		minimumSegmentSize = origMinimumSegmentSize
+		ai.publicKey = origPublicKey
+		SetParallelSegments(1)
+		SetStreamEncryption(false)
+	}()
+
+	publicKey, privateKey, err := keys.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Could not generate key pair: %s", err.Error())
+	}
+	ai.publicKey = publicKey
+	minimumSegmentSize = 1 << 16
+	SetParallelSegments(2)
+	SetStreamEncryption(true)
+
+	dir := t.TempDir()
+	content := make([]byte, 200000)
+	if _, err = rand.Read(content); err != nil {
+		t.Fatalf("Could not generate content: %s", err.Error())
+	}
+	source := filepath.Join(dir, "file.txt")
+	if err = os.WriteFile(source, content, 0600); err != nil {
+		t.Fatalf("Failed to create file: %s", err.Error())
+	}
+
+	getFileDetailsEncrypt = func(filename string) (*os.File, string, int64, error) {
+		return nil, "", 0, errors.New("Should not have called getFileDetailsEncrypt()")
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("TMPDIR", tmp)
+
+			var lock sync.Mutex
+			data := make(map[int][]byte)
+			var manifestQuery map[string]string
+			put = func(manifest string, segmentNro, segment_total int, upload_data io.Reader, query map[string]string) error {
+				if segmentNro == tt.failOn {
+					return errExpected
+				}
+				if segmentNro == -1 {
+					if manifest != "bucket/.segments/dir/file.txt.c4gh/" {
+						t.Errorf("Incorrect manifest %s", manifest)
+					}
+					manifestQuery = query
+
+					return nil
+				}
+				if segment_total != 4 {
+					t.Errorf("Function received incorrect segment total. Expected=4, received=%d", segment_total)
+				}
+				if _, ok := query["encchecksum"]; ok {
+					t.Errorf("Segment %d should not have been sent with the checksum of the encrypted file", segmentNro)
+				}
+				b, err := io.ReadAll(upload_data)
+				if err != nil {
+					return err
+				}
+				lock.Lock()
+				defer lock.Unlock()
+				data[segmentNro] = b
+
+				return nil
+			}
+
+			err := Upload(source, "bucket/dir", 1, "", source, false, false)
+			if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+				t.Errorf("Temporary files were left behind: %v", entries)
+			}
+			switch {
+			case tt.errStr != "":
+				if err == nil {
+					t.Error("Function did not return error")
+				} else if err.Error() != tt.errStr {
+					t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errStr, err.Error())
+				}
+
+				return
+			case err != nil:
+				t.Fatalf("Function returned unexpected error: %s", err.Error())
+			}
+
+			var encrypted []byte
+			for i := 1; i <= 4; i++ {
+				if i < 4 && len(data[i]) != 1<<16 {
+					t.Errorf("Segment %d has incorrect size %d", i, len(data[i]))
+				}
+				encrypted = append(encrypted, data[i]...)
+			}
+			sum := md5.Sum(encrypted) // #nosec
+			switch {
+			case manifestQuery["encchecksum"] != hex.EncodeToString(sum[:]):
+				t.Errorf("Incorrect checksum. Expected=%s, received=%s", hex.EncodeToString(sum[:]), manifestQuery["encchecksum"])
+			case manifestQuery["encfilesize"] != strconv.Itoa(len(encrypted)):
+				t.Errorf("Incorrect file size. Expected=%d, received=%s", len(encrypted), manifestQuery["encfilesize"])
+			case manifestQuery["filesize"] != strconv.Itoa(len(content)):
+				t.Errorf("Incorrect original file size. Expected=%d, received=%s", len(content), manifestQuery["filesize"])
+			}
+
+			c4ghr, err := streaming.NewCrypt4GHReader(bytes.NewReader(encrypted), privateKey, nil)
+			if err != nil {
+				t.Fatalf("Failed to create crypt4gh reader: %s", err.Error())
+			}
+			if message, err := io.ReadAll(c4ghr); err != nil {
+				t.Errorf("Failed to read from encrypted file: %s", err.Error())
+			} else if !bytes.Equal(message, content) {
+				t.Errorf("Uploaded file decrypted to incorrect content")
+			}
+		})
+	}
+}
+
+func TestStreamed(t *testing.T) {
+	defer SetStreamEncryption(false)
+
+	file := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(file, []byte(strings.Repeat("a", 1<<17)), 0600); err != nil {
+		t.Fatalf("Failed to create file: %s", err.Error())
+	}
+
+	var tests = []struct {
+		testname    string
+		stream      bool
+		segmentSize uint64
+		expected    bool
+	}{
+		{"STREAM", true, 1 << 16, true},
+		{"NOT_STREAM", false, 1 << 16, false},
+		{"ONE_SEGMENT", true, 1 << 18, false},
+		{"SMALL_SEGMENTS", true, 1 << 10, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			SetStreamEncryption(tt.stream)
+			if streamed(file, tt.segmentSize) != tt.expected {
+				t.Errorf("Function should have returned %t", tt.expected)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -22,16 +23,42 @@ import (
 	"sda-filesystem/internal/logs"
 )
 
-const chunkSize = 1 << 25
+// DefaultChunkSize is the default size of the chunks in which files are downloaded and cached
+const DefaultChunkSize = 1 << 25
 
-var hi = httpInfo{requestTimeout: 20, httpRetry: 3, repositories: make(map[string]fuseInfo)}
+// DefaultMemoryCacheSize is the default maximum size of the in-memory cache
+const DefaultMemoryCacheSize = 1 << 30
+
+// DefaultDiskCacheSize is the default maximum size of the on-disk cache
+const DefaultDiskCacheSize = 10 << 30
+
+// DefaultRequestRetries is the default number of times an HTTP request is attempted
+const DefaultRequestRetries = 3
+
+// DefaultRetryDelay is the default delay before a failed HTTP request is attempted again
+const DefaultRetryDelay = 500 * time.Millisecond
+
+// minChunkSize is the smallest chunk size that can be configured
+const minChunkSize = 1 << 20
+
+// maxPrefetches is the maximum number of chunks that are prefetched at the same time
+const maxPrefetches = 4
+
+var hi = httpInfo{requestTimeout: 20, httpRetry: DefaultRequestRetries, retryDelay: DefaultRetryDelay, repositories: make(map[string]fuseInfo)}
 var allRepositories = make(map[string]fuseInfo)
 var downloadCache *cache.Ristretto
+var cacheTTL = cache.RistrettoCacheTTL
+var chunkSize int64 = DefaultChunkSize
+var readAhead = 2
+var prefetchSlots = make(chan struct{}, maxPrefetches)
+var downloads = chunkDownloads{calls: make(map[string]*chunkCall)}
+var reuseBuffers = false
 
 // httpInfo contains all necessary variables used during HTTP requests
 type httpInfo struct {
 	requestTimeout int
 	httpRetry      int
+	retryDelay     time.Duration
 	certPath       string
 	basicToken     string
 	sdsToken       string
@@ -44,15 +71,65 @@ type httpInfo struct {
 type fuseInfo interface {
 	getEnvs() error
 	authenticate(...string) error
-	getNthLevel(string, ...string) ([]Metadata, error)
-	updateAttributes([]string, string, any) error
-	downloadData([]string, any, int64, int64) error
+	getNthLevel(context.Context, string, ...string) ([]Metadata, error)
+	updateAttributes(context.Context, []string, string, any) error
+	downloadData(context.Context, []string, any, int64, int64) error
+}
+
+// CacheConfig contains the settings used when creating the cache for downloaded data.
+// Fields left to zero are given default values.
+type CacheConfig struct {
+	Dir        string        // If set, data is cached on disk in this directory instead of memory
+	DiskSize   int64         // Maximum number of bytes the disk cache may use
+	MemorySize int64         // Maximum number of bytes the in-memory cache may use
+	ChunkSize  int64         // Size of the chunks in which files are downloaded and cached
+	TTL        time.Duration // Time after which downloaded data expires from cache
 }
 
 // Metadata contains node metadata fetched from an api
 type Metadata struct {
-	Bytes int64  `json:"bytes"`
-	Name  string `json:"name"`
+	Bytes        int64             `json:"bytes"`
+	Name         string            `json:"name"`
+	LastModified time.Time         `json:"-"` // zero if unknown
+	Created      time.Time         `json:"-"` // zero if unknown
+	Attributes   map[string]string `json:"-"` // additional information shown as extended attributes
+}
+
+// ObjectAttributes contains the attributes of an object that are known only after its data has been requested
+type ObjectAttributes struct {
+	Size      int64
+	Decrypted bool
+}
+
+// timeLayouts are the formats in which repositories return timestamps.
+// Timestamps without a time zone are in UTC.
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999"}
+
+// parseTime parses a timestamp returned by a repository. Returns zero time if timestamp is invalid.
+func parseTime(value string) time.Time {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// UnmarshalJSON decodes metadata and the modification time from an object storage listing
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	type metadata Metadata
+	listing := struct {
+		*metadata
+		LastModified string `json:"last_modified"`
+	}{metadata: (*metadata)(m)}
+
+	if err := json.Unmarshal(data, &listing); err != nil {
+		return err
+	}
+	m.LastModified = parseTime(listing.LastModified)
+
+	return nil
 }
 
 // RequestError is used to obtain the status code from the HTTP request
@@ -139,14 +216,44 @@ var GetSDSToken = func() string {
 	return hi.sdsToken
 }
 
-// InitializeCache creates a cache for downloaded data
-func InitializeCache() error {
+// InitializeCache creates a cache for downloaded data.
+// Data is kept in memory unless config.Dir is set, in which case it is stored on disk and persists between runs.
+func InitializeCache(config CacheConfig) error {
+	if config.ChunkSize == 0 {
+		config.ChunkSize = DefaultChunkSize
+	}
+	if config.MemorySize == 0 {
+		config.MemorySize = DefaultMemoryCacheSize
+	}
+	if config.TTL <= 0 {
+		config.TTL = cache.RistrettoCacheTTL
+	}
+
+	if config.ChunkSize < minChunkSize {
+		return fmt.Errorf("Chunk size must be at least %d MiB", minChunkSize>>20)
+	}
+
 	var err error
-	downloadCache, err = cache.NewRistrettoCache()
+	if config.Dir != "" {
+		if config.DiskSize < config.ChunkSize {
+			return fmt.Errorf("Disk cache size must be at least the chunk size %d MiB", config.ChunkSize>>20)
+		}
+		downloadCache, err = cache.NewDiskCache(config.Dir, config.DiskSize)
+	} else {
+		if config.MemorySize < config.ChunkSize {
+			return fmt.Errorf("Memory cache size must be at least the chunk size %d MiB", config.ChunkSize>>20)
+		}
+		downloadCache, err = cache.NewRistrettoCache(config.MemorySize, config.ChunkSize)
+	}
 	if err != nil {
 		return fmt.Errorf("Could not create cache: %w", err)
 	}
 
+	chunkSize = config.ChunkSize
+	cacheTTL = config.TTL
+	// Disk cache stores a copy of the data, so chunk buffers can be reused after they have been cached
+	reuseBuffers = config.Dir != ""
+
 	return nil
 }
 
@@ -219,8 +326,8 @@ func SettleRepositories() {
 	hi.preventEnable = true
 }
 
-// makeRequest sends HTTP requests and parses the responses
-var MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+// MakeRequest sends HTTP requests and parses the responses. The request is cancelled if 'ctx' is cancelled.
+var MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 	var response *http.Response
 
 	// Build HTTP request
@@ -233,6 +340,11 @@ var MakeRequest = func(url string, query, headers map[string]string, body io.Rea
 			request, err = http.NewRequest("PUT", url, nil)
 		} else {
 			request, err = http.NewRequest("PUT", url, body)
+			// Body has to be given again if request is retried
+			if getBody := rewindable(body); err == nil && getBody != nil {
+				request.GetBody = getBody
+				request.Body, _ = getBody()
+			}
 		}
 		timeout = time.Duration(108000) * time.Second
 	} else {
@@ -244,11 +356,6 @@ var MakeRequest = func(url string, query, headers map[string]string, body io.Rea
 		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	request = request.WithContext(ctx)
-
 	// Place query params if they are set
 	q := request.URL.Query()
 	for k, v := range query {
@@ -271,19 +378,52 @@ var MakeRequest = func(url string, query, headers map[string]string, body io.Rea
 	escapedURL = strings.ReplaceAll(escapedURL, "\r", "")
 
 	// Execute HTTP request
-	// retry the request as specified by hi.httpRetry variable
-	count := 0
-	for {
-		response, err = hi.client.Do(request)
-		logs.Debugf("Trying Request %s, attempt %d/%d", escapedURL, count+1, hi.httpRetry)
-		count++
-
-		if err != nil && count >= hi.httpRetry {
-			return err
+	// retry the request as specified by hi.httpRetry variable, each attempt has its own timeout
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		logs.Debugf("Trying Request %s, attempt %d/%d", escapedURL, attempt, hi.httpRetry)
+		response, err = hi.client.Do(request.WithContext(attemptCtx))
+
+		retry := false
+		switch {
+		case ctx.Err() != nil:
+			// No point in retrying if caller cancelled the request
+		case err != nil:
+			// Body cannot be sent again if it has been consumed and it cannot be rewound
+			retry = request.Body == nil || request.GetBody != nil
+		case body == nil && retryableStatus(response.StatusCode):
+			retry = true
 		}
-		if err == nil {
+		if !retry || attempt >= hi.httpRetry {
 			break
 		}
+
+		delay := retryDelay(attempt, response)
+		if err == nil {
+			logs.Debugf("Request %s returned status %d, retrying in %v", escapedURL, response.StatusCode, delay)
+			_, _ = io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		} else {
+			logs.Debugf("Request %s failed, retrying in %v: %s", escapedURL, delay, err.Error())
+		}
+		cancel()
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if request.GetBody != nil {
+			if request.Body, err = request.GetBody(); err != nil {
+				return fmt.Errorf("Could not rewind request body: %w", err)
+			}
+		}
+	}
+	if err != nil {
+		return err
 	}
 	defer response.Body.Close()
 
@@ -294,6 +434,13 @@ var MakeRequest = func(url string, query, headers map[string]string, body io.Rea
 		return &RequestError{response.StatusCode}
 	}
 
+	// A server that ignores the range would send the whole file
+	length, ranged := rangeLength(headers["Range"])
+	if ranged && response.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("Request for range %s returned status %d instead of %d",
+			headers["Range"], response.StatusCode, http.StatusPartialContent)
+	}
+
 	// Parse request
 	switch v := ret.(type) {
 	case *SpecialHeaders:
@@ -325,6 +472,14 @@ var MakeRequest = func(url string, query, headers map[string]string, body io.Rea
 		if _, err = io.ReadFull(response.Body, v); err != nil {
 			return fmt.Errorf("Copying response failed: %w", err)
 		}
+	case io.Writer:
+		var reader io.Reader = response.Body
+		if ranged {
+			reader = io.LimitReader(response.Body, length)
+		}
+		if _, err = io.Copy(v, reader); err != nil {
+			return fmt.Errorf("Copying response failed: %w", err)
+		}
 	case *[]byte:
 		if *v, err = io.ReadAll(response.Body); err != nil {
 			return fmt.Errorf("Copying response failed: %w", err)
@@ -340,61 +495,151 @@ var MakeRequest = func(url string, query, headers map[string]string, body io.Rea
 	return nil
 }
 
-var GetNthLevel = func(rep string, fsPath string, nodes ...string) ([]Metadata, error) {
-	return hi.repositories[rep].getNthLevel(filepath.FromSlash(fsPath), nodes...)
+// rangeLength returns the number of bytes requested with header Range value 'value' of the form "bytes=start-end".
+// Returns false if the header does not request a single range.
+func rangeLength(value string) (int64, bool) {
+	start, end, found := strings.Cut(strings.TrimPrefix(value, "bytes="), "-")
+	if !found || !strings.HasPrefix(value, "bytes=") {
+		return 0, false
+	}
+	first, err1 := strconv.ParseInt(start, 10, 64)
+	last, err2 := strconv.ParseInt(end, 10, 64)
+	if err1 != nil || err2 != nil || last < first {
+		return 0, false
+	}
+
+	return last - first + 1, true
+}
+
+var GetNthLevel = func(ctx context.Context, rep string, fsPath string, nodes ...string) ([]Metadata, error) {
+	return hi.repositories[rep].getNthLevel(ctx, filepath.FromSlash(fsPath), nodes...)
 }
 
 // UpdateAttributes modifies attributes of node in 'fsPath'.
 // 'nodes' contains the original names of each node in 'fsPath'
-var UpdateAttributes = func(nodes []string, fsPath string, attr any) error {
-	return hi.repositories[nodes[0]].updateAttributes(nodes[1:], filepath.FromSlash(fsPath), attr)
+var UpdateAttributes = func(ctx context.Context, nodes []string, fsPath string, attr any) error {
+	return hi.repositories[nodes[0]].updateAttributes(ctx, nodes[1:], filepath.FromSlash(fsPath), attr)
 }
 
 // DownloadData requests data between range [start, end) from an API.
-var DownloadData = func(nodes []string, path string, start int64, end int64, maxEnd int64) ([]byte, error) {
-	// chunk index of cache
-	chunk := start / chunkSize
-	// start coordinate of chunk
-	chStart := chunk * chunkSize
-	// end coordinate of chunk
-	chEnd := (chunk + 1) * chunkSize
+// If the data is not in cache, returns as soon as the requested range has been downloaded.
+var DownloadData = func(ctx context.Context, nodes []string, path string, start int64, end int64, maxEnd int64) ([]byte, error) {
+	chStart, chEnd := chunkRange(start, maxEnd)
+	ofst := start - chStart
+	endofst := end - chStart
 
-	// Final chunk may be shorter than others if file size restricts it
-	if chEnd > maxEnd {
-		chEnd = maxEnd
+	if buf, found := getChunk(nodes, chStart, chEnd, ofst, endofst); found {
+		cacheHits.Add(1)
+		logs.Debugf("Retrieved file %s from cache, with coordinates [%d, %d)", path, start, end)
+
+		return buf, nil
 	}
 
-	ofst := start - chStart
-	endofst := end - chStart
+	if endofst > chEnd-chStart {
+		endofst = chEnd - chStart
+	}
 
-	// We create the cache key based on path and requested bytes
-	cacheKey := toCacheKey(nodes, chStart)
-	response, found := downloadCache.Get(cacheKey)
+	cacheMisses.Add(1)
+	for {
+		call := joinChunk(ctx, nodes, path, chStart, chEnd)
+		data, err := call.read(ctx, ofst, endofst)
+		call.release()
 
-	if !found {
-		buf := make([]byte, chEnd-chStart)
-		err := hi.repositories[nodes[0]].downloadData(nodes[1:], buf, chStart, chEnd)
+		// The download was cancelled by the caller who started it, so try again
+		if errors.Is(err, context.Canceled) && ctx.Err() == nil {
+			continue
+		}
 		if err != nil {
 			return nil, fmt.Errorf("Retrieving data failed for %s: %w", path, err)
 		}
 
-		downloadCache.Set(cacheKey, buf, int64(len(buf)), time.Minute*60)
-		logs.Debugf("File %s stored in cache, with coordinates [%d, %d)", path, chStart, chEnd)
+		return data, nil
+	}
+}
+
+// DownloadRange downloads range [start, end) of the file in 'nodes' straight from the repository into 'w'.
+// Unlike DownloadData, the data is not stored in cache.
+var DownloadRange = func(ctx context.Context, nodes []string, path string, start, end int64, w io.Writer) error {
+	if err := hi.repositories[nodes[0]].downloadData(ctx, nodes[1:], w, start, end); err != nil {
+		return fmt.Errorf("Retrieving data failed for %s: %w", path, err)
+	}
+
+	return nil
+}
 
-		if endofst > int64(len(buf)) {
-			endofst = int64(len(buf))
+// SetReadAhead redefines the number of chunks that are prefetched when a file is read sequentially
+var SetReadAhead = func(chunks int) {
+	readAhead = chunks
+}
+
+// PrefetchData downloads the chunks that follow the chunk containing coordinate 'ofst' into cache in the background.
+// Chunks before coordinate 'from' have already been requested and are skipped. Returns the coordinate
+// up to which chunks have been requested, which should be given as 'from' in the next call.
+// Prefetching stops if 'ctx' is cancelled.
+var PrefetchData = func(ctx context.Context, nodes []string, path string, ofst, from, maxEnd int64) int64 {
+	chStart := (ofst/chunkSize + 1) * chunkSize
+	windowEnd := chStart + int64(readAhead)*chunkSize
+	if windowEnd > maxEnd {
+		windowEnd = maxEnd
+	}
+	if from > chStart {
+		chStart = from
+	}
+
+	for ; chStart < windowEnd; chStart += chunkSize {
+		select {
+		case prefetchSlots <- struct{}{}:
+		default:
+			// Too many prefetches in flight, try again on next read
+			return chStart
 		}
 
-		return buf[ofst:endofst], nil
+		_, chEnd := chunkRange(chStart, maxEnd)
+		go func(chStart, chEnd int64) {
+			defer func() { <-prefetchSlots }()
+
+			if _, found := getChunk(nodes, chStart, chEnd, 0, 0); found {
+				return
+			}
+
+			call := joinChunk(ctx, nodes, path, chStart, chEnd)
+			defer call.release()
+			select {
+			case <-call.done:
+				if call.err != nil {
+					logs.Debugf("Prefetching failed for %s: %s", path, call.err.Error())
+				}
+			case <-ctx.Done():
+			}
+		}(chStart, chEnd)
+	}
+
+	return chStart
+}
+
+// chunkRange returns the coordinates [chStart, chEnd) of the chunk that contains coordinate 'start'
+func chunkRange(start, maxEnd int64) (int64, int64) {
+	chStart := (start / chunkSize) * chunkSize
+	chEnd := chStart + chunkSize
+
+	// Final chunk may be shorter than others if file size restricts it
+	if chEnd > maxEnd {
+		chEnd = maxEnd
 	}
 
-	ret := response.([]byte)
-	if endofst > int64(len(ret)) {
-		endofst = int64(len(ret))
+	return chStart, chEnd
+}
+
+// getChunk returns range [ofst, endofst) of the chunk starting at 'chStart' if the chunk is found in cache
+func getChunk(nodes []string, chStart, chEnd, ofst, endofst int64) ([]byte, bool) {
+	buf, size, found := downloadCache.GetRange(toCacheKey(nodes, chStart), ofst, endofst)
+
+	// A chunk stored on disk by a run with a different chunk size cannot be used
+	if !found || size < chEnd-chStart {
+		return nil, false
 	}
-	logs.Debugf("Retrieved file %s from cache, with coordinates [%d, %d)", path, start, end)
 
-	return ret[ofst:endofst], nil
+	return buf, true
 }
 
 func toCacheKey(nodes []string, chunkIdx int64) string {
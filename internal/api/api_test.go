@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,6 +13,8 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -52,8 +55,8 @@ type mockRepository struct {
 
 func (r *mockRepository) getEnvs() error { return r.envError }
 
-func (r *mockRepository) downloadData(_ []string, buf any, _, _ int64) error {
-	_, _ = io.ReadFull(bytes.NewReader(r.mockDownloadDataBuf), buf.([]byte))
+func (r *mockRepository) downloadData(_ context.Context, _ []string, buf any, _, _ int64) error {
+	_, _ = buf.(io.Writer).Write(r.mockDownloadDataBuf)
 
 	return r.mockDownloadDataError
 }
@@ -264,38 +267,152 @@ func TestGetCommonEnv(t *testing.T) {
 	}
 }
 
-func TestInitializeCache(t *testing.T) {
-	origNewRistretto := cache.NewRistrettoCache
-	defer func() { cache.NewRistrettoCache = origNewRistretto }()
+func TestParseTime(t *testing.T) {
+	var tests = []struct {
+		testname, value string
+		expected        time.Time
+	}{
+		{"OK_RFC3339", "2023-05-06T07:08:09.123Z", time.Date(2023, 5, 6, 7, 8, 9, 123000000, time.UTC)},
+		{"OK_ZONE", "2023-05-06T10:08:09+03:00", time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC)},
+		{"OK_OBJECT_STORAGE", "2023-05-06T07:08:09.123456", time.Date(2023, 5, 6, 7, 8, 9, 123456000, time.UTC)},
+		{"OK_SPACE", "2023-05-06 07:08:09", time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC)},
+		{"EMPTY", "", time.Time{}},
+		{"INVALID", "yesterday", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			if received := parseTime(tt.value); !received.Equal(tt.expected) {
+				t.Errorf("Incorrect time. Expected=%v, received=%v", tt.expected, received)
+			}
+		})
+	}
+}
 
-	newCache := &cache.Ristretto{Cacheable: &mockCache{}}
-	cache.NewRistrettoCache = func() (*cache.Ristretto, error) {
-		return newCache, nil
+func TestMetadata_UnmarshalJSON(t *testing.T) {
+	data := `[{"name": "file.txt", "bytes": 100, "last_modified": "2023-05-06T07:08:09.123456"}, {"name": "image.jpg", "bytes": 5}]`
+	expected := []Metadata{
+		{Bytes: 100, Name: "file.txt", LastModified: time.Date(2023, 5, 6, 7, 8, 9, 123456000, time.UTC)},
+		{Bytes: 5, Name: "image.jpg"},
 	}
 
-	err := InitializeCache()
-	if err != nil {
-		t.Fatalf("Function returned error: %s", err.Error())
+	var meta []Metadata
+	if err := json.Unmarshal([]byte(data), &meta); err != nil {
+		t.Fatalf("Unmarshalling returned error: %s", err.Error())
+	}
+	if !reflect.DeepEqual(meta, expected) {
+		t.Errorf("Incorrect metadata\nExpected=%v\nReceived=%v", expected, meta)
 	}
-	if downloadCache != newCache {
-		t.Fatalf("downloadCache does not point to new cache")
+}
+
+func TestInitializeCache(t *testing.T) {
+	var tests = []struct {
+		testname           string
+		config             CacheConfig
+		ttl                time.Duration
+		memorySize, chunks int64
+		disk               bool
+	}{
+		{"OK_MEMORY", CacheConfig{}, cache.RistrettoCacheTTL, DefaultMemoryCacheSize, DefaultChunkSize, false},
+		{
+			"OK_MEMORY_CONFIGURED", CacheConfig{MemorySize: 1 << 34, ChunkSize: 1 << 22, TTL: 5 * time.Minute},
+			5 * time.Minute, 1 << 34, 1 << 22, false,
+		},
+		{
+			"OK_DISK", CacheConfig{Dir: "/tmp/cache", DiskSize: 1 << 30, TTL: 24 * time.Hour},
+			24 * time.Hour, 0, DefaultChunkSize, true,
+		},
+	}
+
+	origNewRistretto := cache.NewRistrettoCache
+	origNewDisk := cache.NewDiskCache
+	origCacheTTL := cacheTTL
+	origChunkSize := chunkSize
+	defer func() {
+		cache.NewRistrettoCache = origNewRistretto
+		cache.NewDiskCache = origNewDisk
+		cacheTTL = origCacheTTL
+		chunkSize = origChunkSize
+	}()
+
+	memoryCache := &cache.Ristretto{Cacheable: &mockCache{}}
+	diskCache := &cache.Ristretto{Cacheable: &mockCache{}}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			cache.NewRistrettoCache = func(maxCost, itemCost int64) (*cache.Ristretto, error) {
+				if maxCost != tt.memorySize || itemCost != tt.chunks {
+					return nil, fmt.Errorf("Memory cache received incorrect parameters %d and %d", maxCost, itemCost)
+				}
+
+				return memoryCache, nil
+			}
+			cache.NewDiskCache = func(dir string, maxCost int64) (*cache.Ristretto, error) {
+				if dir != tt.config.Dir || maxCost != tt.config.DiskSize {
+					return nil, fmt.Errorf("Disk cache received incorrect parameters %s and %d", dir, maxCost)
+				}
+
+				return diskCache, nil
+			}
+
+			err := InitializeCache(tt.config)
+			switch {
+			case err != nil:
+				t.Errorf("Function returned error: %s", err.Error())
+			case tt.disk && downloadCache != diskCache:
+				t.Errorf("downloadCache does not point to disk cache")
+			case !tt.disk && downloadCache != memoryCache:
+				t.Errorf("downloadCache does not point to memory cache")
+			case cacheTTL != tt.ttl:
+				t.Errorf("Incorrect cache TTL. Expected=%v, received=%v", tt.ttl, cacheTTL)
+			case chunkSize != tt.chunks:
+				t.Errorf("Incorrect chunk size. Expected=%d, received=%d", tt.chunks, chunkSize)
+			}
+		})
 	}
 }
 
 func TestInitializeCache_Error(t *testing.T) {
+	var tests = []struct {
+		testname, errText string
+		config            CacheConfig
+	}{
+		{"FAIL_MEMORY", "Could not create cache: " + errExpected.Error(), CacheConfig{}},
+		{"FAIL_DISK", "Could not create cache: " + errExpected.Error(), CacheConfig{Dir: "/tmp/cache", DiskSize: 1 << 30}},
+		{"FAIL_CHUNK_SIZE", "Chunk size must be at least 1 MiB", CacheConfig{ChunkSize: 1000}},
+		{
+			"FAIL_MEMORY_SIZE", "Memory cache size must be at least the chunk size 32 MiB",
+			CacheConfig{MemorySize: 1 << 20},
+		},
+		{
+			"FAIL_DISK_SIZE", "Disk cache size must be at least the chunk size 64 MiB",
+			CacheConfig{Dir: "/tmp/cache", DiskSize: 1 << 25, ChunkSize: 1 << 26},
+		},
+	}
+
 	origNewRistretto := cache.NewRistrettoCache
-	defer func() { cache.NewRistrettoCache = origNewRistretto }()
+	origNewDisk := cache.NewDiskCache
+	defer func() {
+		cache.NewRistrettoCache = origNewRistretto
+		cache.NewDiskCache = origNewDisk
+	}()
 
-	cache.NewRistrettoCache = func() (*cache.Ristretto, error) {
+	cache.NewRistrettoCache = func(_, _ int64) (*cache.Ristretto, error) {
+		return nil, errExpected
+	}
+	cache.NewDiskCache = func(_ string, _ int64) (*cache.Ristretto, error) {
 		return nil, errExpected
 	}
-	errText := "Could not create cache: " + errExpected.Error()
 
-	err := InitializeCache()
-	if err == nil {
-		t.Fatalf("Function should have returned error")
-	} else if err.Error() != errText {
-		t.Fatalf("Function returned incorrect error\nExpected=%s\nReceived=%s", errText, err.Error())
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			err := InitializeCache(tt.config)
+			if err == nil {
+				t.Errorf("Function should have returned error")
+			} else if err.Error() != tt.errText {
+				t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errText, err.Error())
+			}
+		})
 	}
 }
 
@@ -482,14 +599,14 @@ func TestMakeRequest(t *testing.T) {
 		{
 			testname: "OK_JSON",
 			mockHandlerFunc: func(rw http.ResponseWriter, req *http.Request) {
-				body, err := json.Marshal([]Metadata{{34, "project1"}, {67, "project/2"}, {8, "project3"}})
+				body, err := json.Marshal([]Metadata{{Bytes: 34, Name: "project1"}, {Bytes: 67, Name: "project/2"}, {Bytes: 8, Name: "project3"}})
 				if err != nil {
 					http.Error(rw, "Error 404", 404)
 				} else {
 					_, _ = rw.Write(body)
 				}
 			},
-			expectedBody: []Metadata{{34, "project1"}, {67, "project/2"}, {8, "project3"}},
+			expectedBody: []Metadata{{Bytes: 34, Name: "project1"}, {Bytes: 67, Name: "project/2"}, {Bytes: 8, Name: "project3"}},
 		},
 		{
 			testname: "OK_PUT",
@@ -518,7 +635,7 @@ func TestMakeRequest(t *testing.T) {
 		{
 			testname: "OK_JSON_ADD_QUERY_AND_HEADERS",
 			mockHandlerFunc: func(rw http.ResponseWriter, req *http.Request) {
-				body, err := json.Marshal([]Metadata{{34, "project1"}, {67, "project/2"}, {8, "project3"}})
+				body, err := json.Marshal([]Metadata{{Bytes: 34, Name: "project1"}, {Bytes: 67, Name: "project/2"}, {Bytes: 8, Name: "project3"}})
 				if err != nil {
 					http.Error(rw, "Error 404", 404)
 				} else {
@@ -527,7 +644,7 @@ func TestMakeRequest(t *testing.T) {
 			},
 			query:        map[string]string{"some": "thing"},
 			headers:      map[string]string{"some": "thing"},
-			expectedBody: []Metadata{{34, "project1"}, {67, "project/2"}, {8, "project3"}},
+			expectedBody: []Metadata{{Bytes: 34, Name: "project1"}, {Bytes: 67, Name: "project/2"}, {Bytes: 8, Name: "project3"}},
 		},
 		{
 			testname: "HEADERS_MISSING",
@@ -615,21 +732,21 @@ func TestMakeRequest(t *testing.T) {
 			switch v := tt.expectedBody.(type) {
 			case SpecialHeaders:
 				var headers SpecialHeaders
-				err = MakeRequest(server.URL, tt.query, tt.headers, nil, &headers)
+				err = MakeRequest(context.Background(), server.URL, tt.query, tt.headers, nil, &headers)
 				ret = headers
 			case []byte:
 				var buf []byte
 				if tt.givenBody == nil {
 					buf = make([]byte, len(v))
-					err = MakeRequest(server.URL, tt.query, tt.headers, nil, buf)
+					err = MakeRequest(context.Background(), server.URL, tt.query, tt.headers, nil, buf)
 					ret = buf
 				} else {
-					err = MakeRequest(server.URL, tt.query, tt.headers, tt.givenBody, &buf)
+					err = MakeRequest(context.Background(), server.URL, tt.query, tt.headers, tt.givenBody, &buf)
 					ret = buf
 				}
 			default:
 				var objects []Metadata
-				err = MakeRequest(server.URL, tt.query, tt.headers, nil, &objects)
+				err = MakeRequest(context.Background(), server.URL, tt.query, tt.headers, nil, &objects)
 				ret = objects
 			}
 
@@ -664,7 +781,7 @@ func TestMakeRequest_PutRequestNil_And_ReadAll_Error(t *testing.T) {
 	var buf []byte
 	var empty *os.File
 	errStr := "Copying response failed: unexpected EOF"
-	err := MakeRequest(server.URL, nil, nil, empty, &buf)
+	err := MakeRequest(context.Background(), server.URL, nil, nil, empty, &buf)
 	if err == nil {
 		t.Error("Function did not return error")
 	} else if err.Error() != errStr {
@@ -677,13 +794,104 @@ func TestMakeRequest_NewRequest_Error(t *testing.T) {
 	buf[0] = 0x7f
 	errText := fmt.Sprintf("parse %q: net/url: invalid control character in URL", string(buf))
 
-	if err := MakeRequest(string(buf), nil, nil, nil, buf); err == nil {
+	if err := MakeRequest(context.Background(), string(buf), nil, nil, nil, buf); err == nil {
 		t.Error("Function did not return error with invalid URL")
 	} else if err.Error() != errText {
 		t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", errText, err.Error())
 	}
 }
 
+func TestMakeRequest_Cancelled(t *testing.T) {
+	origClient := hi.client
+	origRetry := hi.httpRetry
+	defer func() {
+		hi.client = origClient
+		hi.httpRetry = origRetry
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		cancel()
+		<-req.Context().Done()
+	}))
+	defer server.Close()
+	hi.client = server.Client()
+	hi.httpRetry = 3
+
+	var buf []byte
+	err := MakeRequest(ctx, server.URL, nil, nil, nil, &buf)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Function should have returned error %v, received %v", context.Canceled, err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Cancelled request should not be retried, server received %d requests", requests.Load())
+	}
+}
+
+func TestMakeRequest_Range(t *testing.T) {
+	origClient := hi.client
+	defer func() { hi.client = origClient }()
+
+	var tests = []struct {
+		testname, errText, expectedBody string
+		status                          int
+	}{
+		{"OK", "", "cdef", http.StatusPartialContent},
+		{"FAIL_RANGE_IGNORED", "Request for range bytes=2-5 returned status 200 instead of 206", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				rw.WriteHeader(tt.status)
+				// Server sends more than was asked for
+				_, _ = rw.Write([]byte("cdefghij"))
+			}))
+			defer server.Close()
+			hi.client = server.Client()
+
+			var buf bytes.Buffer
+			err := MakeRequest(context.Background(), server.URL, nil, map[string]string{"Range": "bytes=2-5"}, nil, &buf)
+			switch {
+			case tt.errText != "":
+				if err == nil {
+					t.Errorf("Function did not return error")
+				} else if err.Error() != tt.errText {
+					t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errText, err.Error())
+				}
+			case err != nil:
+				t.Errorf("Function returned unexpected error: %s", err.Error())
+			case buf.String() != tt.expectedBody:
+				t.Errorf("Incorrect response body. Expected=%s, received=%s", tt.expectedBody, buf.String())
+			}
+		})
+	}
+}
+
+func TestRangeLength(t *testing.T) {
+	var tests = []struct {
+		value  string
+		length int64
+		ranged bool
+	}{
+		{"bytes=0-9", 10, true},
+		{"bytes=100-100", 1, true},
+		{"", 0, false},
+		{"bytes=5-", 0, false},
+		{"bytes=9-0", 0, false},
+		{"items=0-9", 0, false},
+	}
+
+	for _, tt := range tests {
+		length, ranged := rangeLength(tt.value)
+		if length != tt.length || ranged != tt.ranged {
+			t.Errorf("Range %q returned (%d, %t), expected (%d, %t)", tt.value, length, ranged, tt.length, tt.ranged)
+		}
+	}
+}
+
 func TestDownloadData_FoundCache(t *testing.T) {
 	// Substitute mock functions
 	// Save original functions before test
@@ -700,7 +908,7 @@ func TestDownloadData_FoundCache(t *testing.T) {
 	downloadCache.Set("sdconnect_project_container_object_0", expectedData, int64(len(expectedData)), time.Minute*1)
 
 	// Invoke function
-	data, err := DownloadData(
+	data, err := DownloadData(context.Background(),
 		[]string{"sdconnect", "project", "container", "object"},
 		"/path/to/file.txt",
 		0, 15, 10,
@@ -735,7 +943,7 @@ func TestDownloadData_FoundNoCache(t *testing.T) {
 	hi.repositories = map[string]fuseInfo{"sdconnect": mockRepo}
 
 	// Invoke function
-	data, err := DownloadData(
+	data, err := DownloadData(context.Background(),
 		[]string{"sdconnect", "project", "container", "object"},
 		"/path/to/file.txt",
 		0, 15, 10,
@@ -770,7 +978,7 @@ func TestDownloadData_FoundNoCache_Error(t *testing.T) {
 	hi.repositories = map[string]fuseInfo{"sdconnect": mockRepo}
 
 	// Invoke function
-	data, err := DownloadData(
+	data, err := DownloadData(context.Background(),
 		[]string{"sdconnect", "project", "container", "object"},
 		"/path/to/file.txt",
 		0, 15, 10,
@@ -825,3 +1033,311 @@ func TestDeleteFileFromCache(t *testing.T) {
 		t.Fatalf("Function did not delete the entire file from cache, missed %v", missedKeys)
 	}
 }
+
+type mockSyncCache struct {
+	cache.Cacheable
+
+	lock sync.Mutex
+	data map[string][]byte
+}
+
+func (c *mockSyncCache) Get(key string) (any, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	data, ok := c.data[key]
+
+	return data, ok
+}
+
+func (c *mockSyncCache) Set(key string, value any, _ int64, _ time.Duration) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.data[key] = value.([]byte)
+
+	return true
+}
+
+func TestDownloadRange(t *testing.T) {
+	var tests = []struct {
+		testname, data, errStr string
+		err                    error
+	}{
+		{"OK", "hellothere", "", nil},
+		{"FAIL", "hello", "Retrieving data failed for /path/to/file.txt: some error", errors.New("some error")},
+	}
+
+	origDownloadCache := downloadCache
+	origRepositories := hi.repositories
+	defer func() {
+		downloadCache = origDownloadCache
+		hi.repositories = origRepositories
+	}()
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			storage := &mockCache{}
+			downloadCache = &cache.Ristretto{Cacheable: storage}
+			hi.repositories = map[string]fuseInfo{"sdconnect": &mockRepository{
+				mockDownloadDataBuf:   []byte(tt.data),
+				mockDownloadDataError: tt.err,
+			}}
+
+			var buf bytes.Buffer
+			err := DownloadRange(context.Background(), []string{"sdconnect", "project", "container", "object"},
+				"/path/to/file.txt", 0, 10, &buf)
+
+			switch {
+			case tt.errStr == "" && err != nil:
+				t.Errorf("Function returned unexpected error: %s", err.Error())
+			case tt.errStr != "" && err == nil:
+				t.Errorf("Function should have returned error")
+			case tt.errStr != "" && err.Error() != tt.errStr:
+				t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errStr, err.Error())
+			}
+			if buf.String() != tt.data {
+				t.Errorf("Incorrect data. Expected=%s, received=%s", tt.data, buf.String())
+			}
+			if storage.key != "" {
+				t.Errorf("Data should not have been stored in cache")
+			}
+		})
+	}
+}
+
+func TestPrefetchData(t *testing.T) {
+	var tests = []struct {
+		testname          string
+		ofst, from, ret   int64
+		readAhead, filled int
+		cached, keys      []string
+	}{
+		{"OK_1", 0, 0, 30, 2, 0, nil, []string{"path_10", "path_20"}},
+		{"OK_2", 5, 30, 30, 2, 0, nil, nil},
+		{"OK_3", 25, 30, 50, 2, 0, nil, []string{"path_30", "path_40"}},
+		{"OK_4", 12, 0, 50, 3, 0, []string{"path_30"}, []string{"path_20", "path_40"}},
+		{"DISABLED", 0, 0, 10, 0, 0, nil, nil},
+		{"NO_SLOTS", 0, 0, 20, 2, maxPrefetches - 1, nil, []string{"path_10"}},
+	}
+
+	origChunkSize := chunkSize
+	origReadAhead := readAhead
+	origDownloadCache := downloadCache
+	origRepositories := hi.repositories
+	defer func() {
+		chunkSize = origChunkSize
+		readAhead = origReadAhead
+		downloadCache = origDownloadCache
+		hi.repositories = origRepositories
+	}()
+
+	chunkSize = 10
+	hi.repositories = map[string]fuseInfo{"path": &mockRepository{mockDownloadDataBuf: []byte("0123456789")}}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			storage := &mockSyncCache{data: make(map[string][]byte)}
+			downloadCache = &cache.Ristretto{Cacheable: storage}
+			for _, key := range tt.cached {
+				storage.data[key] = []byte("cached_val")
+			}
+			SetReadAhead(tt.readAhead)
+
+			for i := 0; i < tt.filled; i++ {
+				prefetchSlots <- struct{}{}
+			}
+			ret := PrefetchData(context.Background(), []string{"path"}, "path", tt.ofst, tt.from, 45)
+			for i := 0; i < tt.filled; i++ {
+				<-prefetchSlots
+			}
+
+			// Prefetching has finished once every slot can be acquired
+			for i := 0; i < maxPrefetches; i++ {
+				prefetchSlots <- struct{}{}
+			}
+			for i := 0; i < maxPrefetches; i++ {
+				<-prefetchSlots
+			}
+
+			if ret != tt.ret {
+				t.Errorf("Incorrect return value. Expected %d, received %d", tt.ret, ret)
+			}
+			if len(storage.data) != len(tt.cached)+len(tt.keys) {
+				t.Errorf("Cache should contain %d items, found %d", len(tt.cached)+len(tt.keys), len(storage.data))
+			}
+			for _, key := range tt.keys {
+				if _, ok := storage.data[key]; !ok {
+					t.Errorf("Chunk %s was not prefetched", key)
+				}
+			}
+			for _, key := range tt.cached {
+				if string(storage.data[key]) != "cached_val" {
+					t.Errorf("Cached chunk %s was downloaded again", key)
+				}
+			}
+		})
+	}
+}
+
+type mockBlockingRepository struct {
+	fuseInfo
+
+	calls   atomic.Int32
+	release chan struct{}
+	data    []byte
+	err     error
+}
+
+func (r *mockBlockingRepository) downloadData(_ context.Context, _ []string, buf any, _, _ int64) error {
+	r.calls.Add(1)
+	<-r.release
+	if r.err != nil {
+		return r.err
+	}
+	_, err := buf.(io.Writer).Write(r.data)
+
+	return err
+}
+
+func TestDownloadData_Deduplicate(t *testing.T) {
+	var tests = []struct {
+		testname string
+		err      error
+	}{
+		{"OK", nil},
+		{"FAIL_DOWNLOAD", errExpected},
+	}
+
+	origDownloadCache := downloadCache
+	origRepositories := hi.repositories
+	defer func() {
+		downloadCache = origDownloadCache
+		hi.repositories = origRepositories
+	}()
+
+	readers := 5
+	nodes := []string{"sdconnect", "project", "container", "object"}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			downloadCache = &cache.Ristretto{Cacheable: &mockSyncCache{data: make(map[string][]byte)}}
+			repo := &mockBlockingRepository{release: make(chan struct{}), data: []byte("hellothere"), err: tt.err}
+			hi.repositories = map[string]fuseInfo{"sdconnect": repo}
+			deduplicated := DeduplicatedDownloads()
+
+			var wg sync.WaitGroup
+			results := make([][]byte, readers)
+			errs := make([]error, readers)
+			for i := 0; i < readers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					results[i], errs[i] = DownloadData(context.Background(), nodes, "/path/to/file.txt", 0, 5, 10)
+				}(i)
+			}
+
+			for i := 0; DeduplicatedDownloads()-deduplicated < int64(readers-1); i++ {
+				if i == 100 {
+					t.Fatal("Readers did not start waiting for the ongoing download")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			close(repo.release)
+			wg.Wait()
+
+			if calls := repo.calls.Load(); calls != 1 {
+				t.Errorf("Chunk should have been downloaded once, was downloaded %d times", calls)
+			}
+			for i := 0; i < readers; i++ {
+				if tt.err != nil {
+					if !errors.Is(errs[i], tt.err) {
+						t.Errorf("Reader %d received incorrect error: %v", i, errs[i])
+					}
+				} else if errs[i] != nil {
+					t.Errorf("Reader %d received unexpected error: %s", i, errs[i].Error())
+				} else if string(results[i]) != "hello" {
+					t.Errorf("Reader %d received incorrect data. Expected=hello, received=%s", i, results[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadData_Deduplicate_Cancelled(t *testing.T) {
+	origDownloadCache := downloadCache
+	origRepositories := hi.repositories
+	defer func() {
+		downloadCache = origDownloadCache
+		hi.repositories = origRepositories
+	}()
+
+	downloadCache = &cache.Ristretto{Cacheable: &mockSyncCache{data: make(map[string][]byte)}}
+	repo := &mockCancellableRepository{started: make(chan struct{})}
+	hi.repositories = map[string]fuseInfo{"sdconnect": repo}
+	nodes := []string{"sdconnect", "project", "container", "object"}
+
+	// First reader starts the download and then gives up
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		_, err := DownloadData(ctx1, nodes, "/path/to/file.txt", 0, 5, 10)
+		errc <- err
+	}()
+	<-repo.started
+
+	// Second reader waits for the first download. It gives up as well.
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	deduplicated := DeduplicatedDownloads()
+	go func() {
+		_, err := DownloadData(ctx2, nodes, "/path/to/file.txt", 0, 5, 10)
+		errc <- err
+	}()
+	for DeduplicatedDownloads() == deduplicated {
+		time.Sleep(time.Millisecond)
+	}
+	cancel2()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("Waiting reader should have returned error %v, received %v", context.Canceled, err)
+	}
+
+	// Third reader should start a new download once the first one is cancelled
+	data := make(chan []byte)
+	go func() {
+		buf, err := DownloadData(context.Background(), nodes, "/path/to/file.txt", 0, 5, 10)
+		if err != nil {
+			t.Errorf("Third reader returned unexpected error: %s", err.Error())
+		}
+		data <- buf
+	}()
+	for DeduplicatedDownloads() == deduplicated+1 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel1()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("First reader should have returned error %v, received %v", context.Canceled, err)
+	}
+
+	<-repo.started
+	if buf := <-data; string(buf) != "hello" {
+		t.Errorf("Third reader received incorrect data. Expected=hello, received=%s", buf)
+	}
+}
+
+type mockCancellableRepository struct {
+	fuseInfo
+
+	calls   atomic.Int32
+	started chan struct{}
+}
+
+// downloadData blocks until context is cancelled on the first call
+func (r *mockCancellableRepository) downloadData(ctx context.Context, _ []string, buf any, _, _ int64) error {
+	r.started <- struct{}{}
+	if r.calls.Add(1) == 1 {
+		<-ctx.Done()
+
+		return ctx.Err()
+	}
+	_, err := buf.(io.Writer).Write([]byte("hellothere"))
+
+	return err
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"sda-filesystem/internal/logs"
+)
+
+// chunkPool holds chunk buffers that are no longer in use so that they do not need to be allocated again
+var chunkPool sync.Pool
+
+// chunkDownloads keeps track of chunks which are currently being downloaded
+// so that concurrent requests for the same chunk result in only one download
+type chunkDownloads struct {
+	lock         sync.Mutex
+	calls        map[string]*chunkCall
+	deduplicated atomic.Int64
+}
+
+// chunkCall is a download of one chunk that other callers can wait for. The chunk is filled progressively
+// so that readers can use the beginning of the chunk before the rest of it has arrived.
+// Implements io.Writer so that the response of a request can be streamed into it.
+type chunkCall struct {
+	lock     sync.Mutex
+	buf      []byte
+	filled   int64
+	progress chan struct{} // closed and replaced every time more data arrives
+	done     chan struct{} // closed when the download has finished
+	err      error
+	refs     int  // number of goroutines using buf
+	retained bool // buf is stored in cache and must not be reused
+}
+
+// cacheHits and cacheMisses count the reads that were and were not served from cache
+var cacheHits, cacheMisses atomic.Int64
+
+// CacheStats tells how reads of file data have been served
+type CacheStats struct {
+	Hits                  int64 `json:"hits"`
+	Misses                int64 `json:"misses"`
+	DeduplicatedDownloads int64 `json:"deduplicated_downloads"`
+	ChunkSize             int64 `json:"chunk_size"`
+}
+
+// GetCacheStats returns the number of reads served from cache and from the repositories
+func GetCacheStats() CacheStats {
+	return CacheStats{
+		Hits:                  cacheHits.Load(),
+		Misses:                cacheMisses.Load(),
+		DeduplicatedDownloads: downloads.deduplicated.Load(),
+		ChunkSize:             chunkSize,
+	}
+}
+
+// DeduplicatedDownloads returns the number of chunk requests that were served by waiting
+// for an ongoing download of the same chunk instead of downloading it again
+func DeduplicatedDownloads() int64 {
+	return downloads.deduplicated.Load()
+}
+
+// joinChunk returns the ongoing download of chunk [chStart, chEnd), or starts a new download if there is none.
+// Caller must call release() once it no longer needs the chunk.
+func joinChunk(ctx context.Context, nodes []string, path string, chStart, chEnd int64) *chunkCall {
+	key := toCacheKey(nodes, chStart)
+
+	downloads.lock.Lock()
+	defer downloads.lock.Unlock()
+
+	if call, ok := downloads.calls[key]; ok {
+		call.lock.Lock()
+		call.refs++
+		call.lock.Unlock()
+		downloads.deduplicated.Add(1)
+		logs.Debugf("Waiting for ongoing download of file %s, with coordinates [%d, %d)", path, chStart, chEnd)
+
+		return call
+	}
+
+	// One reference for the caller and one for the download itself
+	call := &chunkCall{
+		buf:      getChunkBuffer(chEnd - chStart),
+		progress: make(chan struct{}),
+		done:     make(chan struct{}),
+		refs:     2,
+	}
+	downloads.calls[key] = call
+
+	go func() {
+		err := hi.repositories[nodes[0]].downloadData(ctx, nodes[1:], call, chStart, chEnd)
+		if err == nil && call.filled < int64(len(call.buf)) {
+			err = fmt.Errorf("Response ended after %d bytes: %w", call.filled, io.ErrUnexpectedEOF)
+		}
+
+		if err == nil {
+			downloadCache.Set(key, call.buf, int64(len(call.buf)), cacheTTL)
+			logs.Debugf("File %s stored in cache, with coordinates [%d, %d)", path, chStart, chEnd)
+		}
+
+		downloads.lock.Lock()
+		delete(downloads.calls, key)
+		downloads.lock.Unlock()
+
+		call.finish(err)
+	}()
+
+	return call
+}
+
+// Write appends data to the chunk and wakes up readers waiting for it
+func (c *chunkCall) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	n := copy(c.buf[c.filled:], p)
+	c.filled += int64(n)
+	close(c.progress)
+	c.progress = make(chan struct{})
+
+	if n < len(p) {
+		return n, io.ErrShortWrite
+	}
+
+	return n, nil
+}
+
+// read waits until range [start, end) of the chunk has been downloaded and returns a copy of it
+func (c *chunkCall) read(ctx context.Context, start, end int64) ([]byte, error) {
+	for {
+		c.lock.Lock()
+		filled, progress := c.filled, c.progress
+		var err error
+		select {
+		case <-c.done:
+			err = c.err
+		default:
+		}
+		c.lock.Unlock()
+
+		// Bytes before 'filled' are never written again so they can be read without the lock
+		if filled >= end {
+			return append([]byte(nil), c.buf[start:end]...), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		select {
+		case <-progress:
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// finish marks the download as finished and gives up the reference held by the download.
+// Buffer of a successful download is kept if it was stored in memory cache.
+func (c *chunkCall) finish(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.err = err
+	c.retained = err == nil && !reuseBuffers
+	close(c.done)
+	c.unref()
+}
+
+// release gives up a reference to the chunk
+func (c *chunkCall) release() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.unref()
+}
+
+// unref decrements the reference count. Buffer is reused once nobody needs it anymore.
+// Caller must hold c.lock.
+func (c *chunkCall) unref() {
+	c.refs--
+	if c.refs == 0 && !c.retained {
+		putChunkBuffer(c.buf)
+		c.buf = nil
+	}
+}
+
+func getChunkBuffer(size int64) []byte {
+	if buf, ok := chunkPool.Get().(*[]byte); ok && int64(cap(*buf)) >= size {
+		return (*buf)[:size]
+	}
+
+	return make([]byte, size, max(size, chunkSize))
+}
+
+func putChunkBuffer(buf []byte) {
+	// Buffers from before the chunk size was changed are left for the garbage collector
+	if int64(cap(buf)) == chunkSize {
+		chunkPool.Put(&buf)
+	}
+}
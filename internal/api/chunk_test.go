@@ -0,0 +1,243 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"sda-filesystem/internal/cache"
+)
+
+type mockStreamingRepository struct {
+	fuseInfo
+
+	data     []byte
+	split    int
+	release  chan struct{}
+	finished chan struct{}
+}
+
+// downloadData writes the first part of the data and blocks until released before writing the rest
+func (r *mockStreamingRepository) downloadData(_ context.Context, _ []string, buf any, _, _ int64) error {
+	defer close(r.finished)
+	w := buf.(io.Writer)
+	if _, err := w.Write(r.data[:r.split]); err != nil {
+		return err
+	}
+	<-r.release
+	_, err := w.Write(r.data[r.split:])
+
+	return err
+}
+
+func TestMakeRequest_Writer(t *testing.T) {
+	origClient := hi.client
+	defer func() { hi.client = origClient }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		_, _ = rw.Write([]byte("This is a message from the past"))
+	}))
+	defer server.Close()
+	hi.client = server.Client()
+
+	var buf bytes.Buffer
+	if err := MakeRequest(context.Background(), server.URL, nil, nil, nil, &buf); err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+	if buf.String() != "This is a message from the past" {
+		t.Errorf("Incorrect response body. Expected=This is a message from the past, received=%s", buf.String())
+	}
+}
+
+func TestDownloadData_Streaming(t *testing.T) {
+	origDownloadCache := downloadCache
+	origRepositories := hi.repositories
+	defer func() {
+		downloadCache = origDownloadCache
+		hi.repositories = origRepositories
+	}()
+
+	storage := &mockSyncCache{data: make(map[string][]byte)}
+	downloadCache = &cache.Ristretto{Cacheable: storage}
+	repo := &mockStreamingRepository{
+		data:     []byte("hellothere"),
+		split:    5,
+		release:  make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	hi.repositories = map[string]fuseInfo{"sdconnect": repo}
+	nodes := []string{"sdconnect", "project", "container", "object"}
+
+	// Beginning of the chunk is available before the rest of it has been downloaded
+	data, err := DownloadData(context.Background(), nodes, "/path/to/file.txt", 0, 5, 10)
+	if err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+	if string(data) != "hello" {
+		t.Errorf("Incorrect data. Expected=hello, received=%s", data)
+	}
+	select {
+	case <-repo.finished:
+		t.Fatal("Download should not have finished yet")
+	default:
+	}
+
+	// End of the chunk is returned once it arrives
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		data, err := DownloadData(context.Background(), nodes, "/path/to/file.txt", 5, 10, 10)
+		if err != nil {
+			t.Errorf("Function returned unexpected error: %s", err.Error())
+		} else if string(data) != "there" {
+			t.Errorf("Incorrect data. Expected=there, received=%s", data)
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(repo.release)
+	wg.Wait()
+	<-repo.finished
+
+	for i := 0; ; i++ {
+		if data, ok := storage.Get(toCacheKey(nodes, 0)); ok {
+			if string(data.([]byte)) != "hellothere" {
+				t.Errorf("Incorrect data in cache. Expected=hellothere, received=%s", data)
+			}
+
+			break
+		}
+		if i == 100 {
+			t.Fatal("Chunk was not stored in cache")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDownloadData_ShortResponse(t *testing.T) {
+	origDownloadCache := downloadCache
+	origRepositories := hi.repositories
+	defer func() {
+		downloadCache = origDownloadCache
+		hi.repositories = origRepositories
+	}()
+
+	storage := &mockSyncCache{data: make(map[string][]byte)}
+	downloadCache = &cache.Ristretto{Cacheable: storage}
+	hi.repositories = map[string]fuseInfo{"sdconnect": &mockRepository{mockDownloadDataBuf: []byte("hello")}}
+	nodes := []string{"sdconnect", "project", "container", "object"}
+
+	data, err := DownloadData(context.Background(), nodes, "/path/to/file.txt", 0, 3, 10)
+	if err != nil {
+		t.Errorf("Function returned unexpected error: %s", err.Error())
+	} else if string(data) != "hel" {
+		t.Errorf("Incorrect data. Expected=hel, received=%s", data)
+	}
+
+	_, err = DownloadData(context.Background(), nodes, "/path/to/file.txt", 3, 8, 10)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Function should have returned error %v, received %v", io.ErrUnexpectedEOF, err)
+	}
+	if _, ok := storage.Get(toCacheKey(nodes, 0)); ok {
+		t.Errorf("Incomplete chunk should not have been stored in cache")
+	}
+}
+
+func TestChunkCall_Release(t *testing.T) {
+	var tests = []struct {
+		testname string
+		reuse    bool
+		err      error
+		retained bool
+	}{
+		{"OK_MEMORY", false, nil, true},
+		{"OK_DISK", true, nil, false},
+		{"FAIL_DOWNLOAD", false, errExpected, false},
+	}
+
+	origDownloadCache := downloadCache
+	origRepositories := hi.repositories
+	origReuseBuffers := reuseBuffers
+	defer func() {
+		downloadCache = origDownloadCache
+		hi.repositories = origRepositories
+		reuseBuffers = origReuseBuffers
+	}()
+
+	nodes := []string{"sdconnect", "project", "container", "object"}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			downloadCache = &cache.Ristretto{Cacheable: &mockSyncCache{data: make(map[string][]byte)}}
+			hi.repositories = map[string]fuseInfo{"sdconnect": &mockRepository{
+				mockDownloadDataBuf: []byte("hellothere"), mockDownloadDataError: tt.err,
+			}}
+			reuseBuffers = tt.reuse
+
+			call := joinChunk(context.Background(), nodes, "/path/to/file.txt", 0, 10)
+			<-call.done
+			call.release()
+
+			call.lock.Lock()
+			defer call.lock.Unlock()
+			if call.refs != 0 {
+				t.Errorf("Chunk should have no references, has %d", call.refs)
+			}
+			if tt.retained && call.buf == nil {
+				t.Errorf("Buffer stored in memory cache should not have been released")
+			}
+			if !tt.retained && call.buf != nil {
+				t.Errorf("Buffer should have been returned to pool")
+			}
+		})
+	}
+}
+
+func TestGetCacheStats(t *testing.T) {
+	origDownloadCache := downloadCache
+	origRepositories := hi.repositories
+	origHits, origMisses := cacheHits.Load(), cacheMisses.Load()
+	defer func() {
+		downloadCache = origDownloadCache
+		hi.repositories = origRepositories
+		cacheHits.Store(origHits)
+		cacheMisses.Store(origMisses)
+	}()
+
+	cacheHits.Store(0)
+	cacheMisses.Store(0)
+	storage := &mockSyncCache{data: make(map[string][]byte)}
+	downloadCache = &cache.Ristretto{Cacheable: storage}
+	hi.repositories = map[string]fuseInfo{"sdconnect": &mockRepository{mockDownloadDataBuf: []byte("hellothere")}}
+	nodes := []string{"sdconnect", "project", "container", "object"}
+
+	if _, err := DownloadData(context.Background(), nodes, "/path/to/file.txt", 0, 5, 10); err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+	for i := 0; ; i++ {
+		if _, ok := storage.Get(toCacheKey(nodes, 0)); ok {
+			break
+		}
+		if i == 100 {
+			t.Fatal("Chunk was not stored in cache")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := DownloadData(context.Background(), nodes, "/path/to/file.txt", 5, 10, 10); err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+
+	stats := GetCacheStats()
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Incorrect cache stats. Expected 1 hit and 1 miss, received %+v", stats)
+	}
+	if stats.ChunkSize != chunkSize {
+		t.Errorf("Incorrect chunk size. Expected=%d, received=%d", chunkSize, stats.ChunkSize)
+	}
+}
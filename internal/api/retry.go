@@ -0,0 +1,88 @@
+package api
+
+import (
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxRetryDelay is the longest time waited between two attempts of a request
+const maxRetryDelay = time.Minute
+
+// SetRequestRetries redefines how many times a request is attempted and how long is waited
+// before the first retry. The wait is doubled after each failed attempt.
+var SetRequestRetries = func(attempts int, delay time.Duration) {
+	hi.httpRetry = max(attempts, 1)
+	hi.retryDelay = delay
+}
+
+// retryableStatus tells if a request that received response status 'code' may succeed if it is sent again
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// retryDelay returns how long to wait before attempt number 'attempt'+1. Exponential backoff with jitter is used,
+// unless the server has asked to wait longer with header Retry-After.
+var retryDelay = func(attempt int, response *http.Response) time.Duration {
+	var delay time.Duration
+	if hi.retryDelay > 0 {
+		delay = hi.retryDelay << (attempt - 1)
+		if delay > maxRetryDelay || delay <= 0 {
+			delay = maxRetryDelay
+		}
+		// Jitter prevents clients from retrying all at the same time
+		delay = delay/2 + rand.N(delay/2+1) // #nosec G404 -- Randomness does not need to be cryptographically secure
+	}
+
+	if response != nil {
+		if after := retryAfter(response.Header.Get("Retry-After")); after > delay {
+			delay = min(after, maxRetryDelay)
+		}
+	}
+
+	return delay
+}
+
+// retryAfter parses the value of header Retry-After, which is either in seconds or an HTTP date
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
+
+// rewindable returns a function that gives 'body' from its current position again, so that the body can be
+// resent if a request is retried. Returns nil if 'body' cannot be rewound.
+func rewindable(body io.Reader) func() (io.ReadCloser, error) {
+	seeker, ok := body.(io.ReadSeeker)
+	if !ok {
+		return nil
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil
+	}
+
+	return func() (io.ReadCloser, error) {
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		// Transport must not close the body so that it can be read again
+		return io.NopCloser(seeker), nil
+	}
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetRequestRetries(t *testing.T) {
+	origRetry, origDelay := hi.httpRetry, hi.retryDelay
+	defer func() { hi.httpRetry, hi.retryDelay = origRetry, origDelay }()
+
+	SetRequestRetries(5, time.Second)
+	if hi.httpRetry != 5 || hi.retryDelay != time.Second {
+		t.Errorf("Incorrect retry settings. Expected=5 and %v, received=%d and %v", time.Second, hi.httpRetry, hi.retryDelay)
+	}
+
+	SetRequestRetries(0, 0)
+	if hi.httpRetry != 1 {
+		t.Errorf("Request should be attempted at least once, received %d attempts", hi.httpRetry)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var tests = []struct {
+		testname, value string
+		min, max        time.Duration
+	}{
+		{"EMPTY", "", 0, 0},
+		{"SECONDS", "120", 2 * time.Minute, 2 * time.Minute},
+		{"NEGATIVE", "-5", 0, 0},
+		{"DATE", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 59 * time.Minute, time.Hour},
+		{"INVALID", "soon", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			if after := retryAfter(tt.value); after < tt.min || after > tt.max {
+				t.Errorf("Incorrect wait for value %q. Expected between %v and %v, received %v", tt.value, tt.min, tt.max, after)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	origDelay := hi.retryDelay
+	defer func() { hi.retryDelay = origDelay }()
+
+	hi.retryDelay = time.Second
+	var tests = []struct {
+		testname   string
+		attempt    int
+		retryAfter string
+		min, max   time.Duration
+	}{
+		{"FIRST", 1, "", 500 * time.Millisecond, time.Second},
+		{"THIRD", 3, "", 2 * time.Second, 4 * time.Second},
+		{"CAPPED", 40, "", maxRetryDelay / 2, maxRetryDelay},
+		{"RETRY_AFTER", 1, "10", 10 * time.Second, 10 * time.Second},
+		{"RETRY_AFTER_SHORT", 3, "1", 2 * time.Second, 4 * time.Second},
+		{"RETRY_AFTER_CAPPED", 1, "3600", maxRetryDelay, maxRetryDelay},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			response := &http.Response{Header: http.Header{}}
+			response.Header.Set("Retry-After", tt.retryAfter)
+			if delay := retryDelay(tt.attempt, response); delay < tt.min || delay > tt.max {
+				t.Errorf("Incorrect delay. Expected between %v and %v, received %v", tt.min, tt.max, delay)
+			}
+		})
+	}
+}
+
+func TestMakeRequest_Retry(t *testing.T) {
+	var tests = []struct {
+		testname string
+		statuses []int
+		body     io.Reader
+		requests int
+		err      error
+	}{
+		{"OK_FIRST", []int{200}, nil, 1, nil},
+		{"OK_UNAVAILABLE", []int{503, 502, 200}, nil, 3, nil},
+		{"OK_TOO_MANY", []int{429, 504, 206}, nil, 3, nil},
+		{"FAIL_NOT_RETRYABLE", []int{500, 200}, nil, 1, &RequestError{500}},
+		{"FAIL_ATTEMPTS", []int{503, 503, 503, 200}, nil, 3, &RequestError{503}},
+		{"FAIL_PUT", []int{503, 201}, strings.NewReader("data"), 1, &RequestError{503}},
+	}
+
+	origClient := hi.client
+	origRetry, origDelay := hi.httpRetry, hi.retryDelay
+	defer func() {
+		hi.client = origClient
+		hi.httpRetry, hi.retryDelay = origRetry, origDelay
+	}()
+	hi.httpRetry, hi.retryDelay = 3, time.Millisecond
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				rw.WriteHeader(tt.statuses[requests])
+				requests++
+			}))
+			defer server.Close()
+			hi.client = server.Client()
+
+			var buf []byte
+			err := MakeRequest(context.Background(), server.URL, nil, nil, tt.body, &buf)
+
+			var re, expectedRe *RequestError
+			switch {
+			case tt.err == nil && err != nil:
+				t.Errorf("Returned unexpected error: %s", err.Error())
+			case tt.err != nil && (!errors.As(err, &re) || !errors.As(tt.err, &expectedRe) || re.StatusCode != expectedRe.StatusCode):
+				t.Errorf("Incorrect error. Expected=%v, received=%v", tt.err, err)
+			case requests != tt.requests:
+				t.Errorf("Server received %d requests, expected %d", requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestMakeRequest_Retry_Body(t *testing.T) {
+	var tests = []struct {
+		testname string
+		body     io.Reader
+		requests int
+	}{
+		{"OK_SEEKER", io.NewSectionReader(strings.NewReader("skip this is the body"), 5, 16), 2},
+		{"OK_BUFFER", bytes.NewBufferString("this is the body"), 2},
+		{"FAIL_NOT_REWINDABLE", io.LimitReader(strings.NewReader("this is the body"), 16), 1},
+	}
+
+	origClient := hi.client
+	origRetry, origDelay := hi.httpRetry, hi.retryDelay
+	defer func() {
+		hi.client = origClient
+		hi.httpRetry, hi.retryDelay = origRetry, origDelay
+	}()
+	hi.httpRetry, hi.retryDelay = 3, time.Millisecond
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			var lock sync.Mutex
+			requests := 0
+			received := ""
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				data, _ := io.ReadAll(req.Body)
+
+				lock.Lock()
+				defer lock.Unlock()
+				requests++
+				if requests == 1 {
+					// Connection is closed without a response so that the client sees a transport error
+					conn, _, err := rw.(http.Hijacker).Hijack()
+					if err == nil {
+						conn.Close()
+					}
+
+					return
+				}
+				received = string(data)
+				rw.WriteHeader(http.StatusCreated)
+			}))
+			defer server.Close()
+			hi.client = server.Client()
+
+			var buf []byte
+			err := MakeRequest(context.Background(), server.URL, nil, nil, tt.body, &buf)
+
+			lock.Lock()
+			defer lock.Unlock()
+			switch {
+			case requests != tt.requests:
+				t.Errorf("Server received %d requests, expected %d", requests, tt.requests)
+			case tt.requests == 1 && err == nil:
+				t.Error("Function should have returned error")
+			case tt.requests > 1 && err != nil:
+				t.Errorf("Returned unexpected error: %s", err.Error())
+			case tt.requests > 1 && received != "this is the body":
+				t.Errorf("Server received incorrect body on retry. Expected=%q, received=%q", "this is the body", received)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
@@ -19,9 +20,9 @@ const SDConnectPrnt string = "SD Connect"
 
 // This exists for unit test mocking
 type connectable interface {
-	getProjects() ([]Metadata, error)
-	getToken(string) (sToken, error)
-	getSTokens([]Metadata) map[string]sToken
+	getProjects(context.Context) ([]Metadata, error)
+	getToken(context.Context, string) (sToken, error)
+	getSTokens(context.Context, []Metadata) map[string]sToken
 }
 
 type connecter struct {
@@ -66,10 +67,10 @@ func init() {
 // Functions for connecter
 //
 
-func (c *connecter) getProjects() ([]Metadata, error) {
+func (c *connecter) getProjects(ctx context.Context) ([]Metadata, error) {
 	var projects []Metadata
 	headers := map[string]string{"X-Authorization": "Basic " + *c.token}
-	err := MakeRequest(*c.url+"/projects", nil, headers, nil, &projects)
+	err := MakeRequest(ctx, *c.url+"/projects", nil, headers, nil, &projects)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to retrieve %s projects: %w", SDConnectPrnt, err)
 	}
@@ -77,7 +78,7 @@ func (c *connecter) getProjects() ([]Metadata, error) {
 	return projects, nil
 }
 
-func (c *connecter) getToken(name string) (sToken, error) {
+func (c *connecter) getToken(ctx context.Context, name string) (sToken, error) {
 	query := map[string]string{"project": name}
 	headers := map[string]string{"X-Authorization": "Basic " + *c.token}
 
@@ -87,18 +88,18 @@ func (c *connecter) getToken(name string) (sToken, error) {
 
 	// Request token
 	ret := sToken{}
-	err := MakeRequest(*c.url+"/token", query, headers, nil, &ret)
+	err := MakeRequest(ctx, *c.url+"/token", query, headers, nil, &ret)
 
 	return ret, err
 }
 
 // getSTokens fetches the scoped tokens
 // Using only one goroutine since SD Desktop VM should only allow for one project
-func (c *connecter) getSTokens(projects []Metadata) map[string]sToken {
+func (c *connecter) getSTokens(ctx context.Context, projects []Metadata) map[string]sToken {
 	newSTokens := make(map[string]sToken)
 
 	for i := range projects {
-		projectToken, err := c.getToken(projects[i].Name)
+		projectToken, err := c.getToken(ctx, projects[i].Name)
 		if err != nil {
 			logs.Warningf("Failed to retrieve %s scoped token for %s: %w", SDConnectPrnt, projects[i].Name, err)
 
@@ -143,21 +144,21 @@ func (c *sdConnectInfo) authenticate(auth ...string) error {
 
 	if projectReplacement != "" {
 		c.overriden = true
-		c.projects = []Metadata{{-1, projectReplacement}}
+		c.projects = []Metadata{{Bytes: -1, Name: projectReplacement}}
 
 		var token sToken
-		token, err = c.getToken(projectReplacement)
+		token, err = c.getToken(context.Background(), projectReplacement)
 		if err == nil {
 			c.sTokens = map[string]sToken{projectReplacement: token}
 
 			return nil
 		}
-	} else if c.projects, err = c.getProjects(); err == nil {
+	} else if c.projects, err = c.getProjects(context.Background()); err == nil {
 		if len(c.projects) == 0 {
 			return fmt.Errorf("No projects found for %s", SDConnectPrnt)
 		}
 		logs.Infof("Retrieved %d %s project(s)", len(c.projects), SDConnectPrnt)
-		c.sTokens = c.getSTokens(c.projects)
+		c.sTokens = c.getSTokens(context.Background(), c.projects)
 
 		return nil
 	}
@@ -173,7 +174,7 @@ func (c *sdConnectInfo) authenticate(auth ...string) error {
 	return err
 }
 
-func (c *sdConnectInfo) getNthLevel(fsPath string, nodes ...string) ([]Metadata, error) {
+func (c *sdConnectInfo) getNthLevel(ctx context.Context, fsPath string, nodes ...string) ([]Metadata, error) {
 	if len(nodes) == 0 {
 		return c.projects, nil
 	}
@@ -194,9 +195,9 @@ func (c *sdConnectInfo) getNthLevel(fsPath string, nodes ...string) ([]Metadata,
 
 	for {
 		var tmpmeta []Metadata
-		err := c.makeRequest(path, nodes[0], query, headers, &tmpmeta)
-		if c.tokenExpired(err) {
-			err = c.makeRequest(path, nodes[0], query, headers, &tmpmeta)
+		err := c.makeRequest(ctx, path, nodes[0], query, headers, &tmpmeta)
+		if c.tokenExpired(ctx, err) {
+			err = c.makeRequest(ctx, path, nodes[0], query, headers, &tmpmeta)
 		}
 
 		if err != nil {
@@ -217,11 +218,11 @@ func (c *sdConnectInfo) getNthLevel(fsPath string, nodes ...string) ([]Metadata,
 	return meta, nil
 }
 
-func (c *sdConnectInfo) tokenExpired(err error) bool {
+func (c *sdConnectInfo) tokenExpired(ctx context.Context, err error) bool {
 	var re *RequestError
 	if errors.As(err, &re) && re.StatusCode == 401 {
 		logs.Infof("%s tokens no longer valid. Fetching them again", SDConnectPrnt)
-		c.sTokens = c.getSTokens(c.projects)
+		c.sTokens = c.getSTokens(ctx, c.projects)
 
 		return true
 	}
@@ -229,30 +230,31 @@ func (c *sdConnectInfo) tokenExpired(err error) bool {
 	return false
 }
 
-func (c *sdConnectInfo) updateAttributes(nodes []string, path string, attr any) error {
+func (c *sdConnectInfo) updateAttributes(ctx context.Context, nodes []string, path string, attr any) error {
 	if len(nodes) < 3 {
 		return fmt.Errorf("Cannot update attributes for path %s", path)
 	}
 
-	size, ok := attr.(*int64)
+	attrs, ok := attr.(*ObjectAttributes)
 	if !ok {
-		return fmt.Errorf("%s updateAttributes() was called with incorrect attribute. Expected type *int64, received %v",
+		return fmt.Errorf("%s updateAttributes() was called with incorrect attribute. Expected type *api.ObjectAttributes, received %v",
 			SDConnectPrnt, reflect.TypeOf(attr))
 	}
 
 	var headers SpecialHeaders
-	if err := c.downloadData(nodes, &headers, 0, 2); err != nil {
+	if err := c.downloadData(ctx, nodes, &headers, 0, 2); err != nil {
 		return err
 	}
 	if headers.SegmentedObjectSize != -1 {
 		logs.Infof("Object %s is a segmented object with size %d", path, headers.SegmentedObjectSize)
-		*size = headers.SegmentedObjectSize
+		attrs.Size = headers.SegmentedObjectSize
 	}
+	attrs.Decrypted = headers.Decrypted
 	if headers.Decrypted {
-		dSize := calculateDecryptedSize(*size, headers.HeaderSize)
+		dSize := calculateDecryptedSize(attrs.Size, headers.HeaderSize)
 		if dSize != -1 {
 			logs.Debugf("Object %s is automatically decrypted", path)
-			*size = dSize
+			attrs.Size = dSize
 		} else {
 			logs.Warningf("API returned header 'X-Decrypted' even though size of object %s is too small", path)
 		}
@@ -261,7 +263,7 @@ func (c *sdConnectInfo) updateAttributes(nodes []string, path string, attr any)
 	return nil
 }
 
-func (c *sdConnectInfo) makeRequest(path, project string, query, headers map[string]string, ret any) error {
+func (c *sdConnectInfo) makeRequest(ctx context.Context, path, project string, query, headers map[string]string, ret any) error {
 	token := c.sTokens[project]
 	headers["X-Project-ID"] = token.ProjectID
 	headers["X-Authorization"] = "Bearer " + token.Token
@@ -270,10 +272,10 @@ func (c *sdConnectInfo) makeRequest(path, project string, query, headers map[str
 		headers["X-Project-Name"] = project
 	}
 
-	return MakeRequest(path, query, headers, nil, ret)
+	return MakeRequest(ctx, path, query, headers, nil, ret)
 }
 
-func (c *sdConnectInfo) downloadData(nodes []string, buffer any, start, end int64) error {
+func (c *sdConnectInfo) downloadData(ctx context.Context, nodes []string, buffer any, start, end int64) error {
 	// Query params
 	query := map[string]string{
 		"project":   nodes[0],
@@ -287,9 +289,9 @@ func (c *sdConnectInfo) downloadData(nodes []string, buffer any, start, end int6
 	path := c.url + "/data"
 
 	// Request data
-	err := c.makeRequest(path, nodes[0], query, headers, buffer)
-	if c.tokenExpired(err) {
-		return c.makeRequest(path, nodes[0], query, headers, buffer)
+	err := c.makeRequest(ctx, path, nodes[0], query, headers, buffer)
+	if c.tokenExpired(ctx, err) {
+		return c.makeRequest(ctx, path, nodes[0], query, headers, buffer)
 	}
 
 	return err
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -20,7 +21,7 @@ type mockConnecter struct {
 	tokenErr    error
 }
 
-func (c *mockConnecter) getProjects() ([]Metadata, error) {
+func (c *mockConnecter) getProjects(_ context.Context) ([]Metadata, error) {
 	if c.projectsErr != nil {
 		return nil, fmt.Errorf("getProjects error: %w", c.projectsErr)
 	}
@@ -28,7 +29,7 @@ func (c *mockConnecter) getProjects() ([]Metadata, error) {
 	return c.projects, nil
 }
 
-func (c *mockConnecter) getToken(string) (sToken, error) {
+func (c *mockConnecter) getToken(context.Context, string) (sToken, error) {
 	if c.tokenErr != nil {
 		return sToken{}, fmt.Errorf("getToken error: %w", c.tokenErr)
 	}
@@ -36,7 +37,7 @@ func (c *mockConnecter) getToken(string) (sToken, error) {
 	return c.token, nil
 }
 
-func (c *mockConnecter) getSTokens([]Metadata) map[string]sToken {
+func (c *mockConnecter) getSTokens(context.Context, []Metadata) map[string]sToken {
 	return c.sTokens
 }
 
@@ -47,11 +48,11 @@ func Test_SDConnect_GetProjects(t *testing.T) {
 	}{
 		{
 			"OK_1", "google.com", "7ce5ic",
-			[]Metadata{{234, "Jack"}, {2, "yur586bl"}, {7489, "rtu6u__78bgi"}},
+			[]Metadata{{Bytes: 234, Name: "Jack"}, {Bytes: 2, Name: "yur586bl"}, {Bytes: 7489, Name: "rtu6u__78bgi"}},
 		},
 		{
 			"OK_2", "example.com", "2cjv05fgi",
-			[]Metadata{{740, "rtu6u__78boi"}, {83, "85cek6o"}},
+			[]Metadata{{Bytes: 740, Name: "rtu6u__78boi"}, {Bytes: 83, Name: "85cek6o"}},
 		},
 		{
 			"OK_EMPTY", "hs.fi", "WHM6d.7k", []Metadata{},
@@ -63,7 +64,7 @@ func Test_SDConnect_GetProjects(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.testname, func(t *testing.T) {
-			MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+			MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 				if token, ok := headers["X-Authorization"]; !ok || token != "Basic "+tt.token {
 					return fmt.Errorf("Incorrect header 'X-Authorization'\nExpected=%s\nReceived=%s", "Bearer "+tt.token, token)
 				}
@@ -82,7 +83,7 @@ func Test_SDConnect_GetProjects(t *testing.T) {
 			// for now ignore this as it will be fixed in go 1.22
 			// https://stackoverflow.com/questions/62446118/implicit-memory-aliasing-in-for-loop
 			c := connecter{url: &url, token: &tt.token} // #nosec G601
-			projects, err := c.getProjects()
+			projects, err := c.getProjects(context.Background())
 
 			if err != nil {
 				t.Errorf("Unexpected error: %s", err.Error())
@@ -97,14 +98,14 @@ func Test_SDConnect_GetProjects_Error(t *testing.T) {
 	origMakeRequest := MakeRequest
 	defer func() { MakeRequest = origMakeRequest }()
 
-	MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+	MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 		return errExpected
 	}
 
 	url := "url"
 	token := "token"
 	c := connecter{url: &url, token: &token}
-	projects, err := c.getProjects()
+	projects, err := c.getProjects(context.Background())
 
 	if err == nil {
 		t.Error("Function should have returned error")
@@ -125,15 +126,15 @@ func Test_SDConnect_GetSTokens(t *testing.T) {
 		sTokens  map[string]sToken
 	}{
 		{
-			"OK_1", []Metadata{{56, "project1"}, {67, "project2"}}, false,
+			"OK_1", []Metadata{{Bytes: 56, Name: "project1"}, {Bytes: 67, Name: "project2"}}, false,
 			map[string]sToken{"project1": {"vhjk", "cud7"}, "project2": {"d6l", "88x6l"}},
 		},
 		{
-			"OK_2", []Metadata{{23, "pr1568"}, {90, "pr2097"}}, true,
+			"OK_2", []Metadata{{Bytes: 23, Name: "pr1568"}, {Bytes: 90, Name: "pr2097"}}, true,
 			map[string]sToken{"pr1568": {"6rxy", "7cli87t"}, "pr2097": {"7cek", "25c8"}},
 		},
 		{
-			"FAIL_STOKENS", []Metadata{{496, "pr152"}, {271, "pr375"}, {12, "pr225"}}, false,
+			"FAIL_STOKENS", []Metadata{{Bytes: 496, Name: "pr152"}, {Bytes: 271, Name: "pr375"}, {Bytes: 12, Name: "pr225"}}, false,
 			map[string]sToken{"pr225": {"8vgicö", "xfd6"}},
 		},
 	}
@@ -143,7 +144,7 @@ func Test_SDConnect_GetSTokens(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.testname, func(t *testing.T) {
-			MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+			MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 				if _, ok := tt.sTokens[query["project"]]; !ok {
 					return fmt.Errorf("Error occurred")
 				}
@@ -172,7 +173,7 @@ func Test_SDConnect_GetSTokens(t *testing.T) {
 			token := "token"
 			overridden := tt.override
 			c := connecter{url: &url, token: &token, overriden: &overridden}
-			newSTokens := c.getSTokens(tt.projects)
+			newSTokens := c.getSTokens(context.Background(), tt.projects)
 
 			if !reflect.DeepEqual(newSTokens, tt.sTokens) {
 				t.Errorf("sTokens incorrect.\nExpected=%s\nReceived=%s", tt.sTokens, newSTokens)
@@ -264,7 +265,7 @@ func Test_SDConnect_GetEnvs(t *testing.T) {
 }
 
 func Test_SDConnect_ValidateLogin_OK(t *testing.T) {
-	projects := []Metadata{{56, "pr1"}, {45, "pr56"}, {8, "pr88"}}
+	projects := []Metadata{{Bytes: 56, Name: "pr1"}, {Bytes: 45, Name: "pr56"}, {Bytes: 8, Name: "pr88"}}
 	mockC := &mockConnecter{sTokens: map[string]sToken{"s1": {"sToken", "proj1"}}, projects: projects}
 	sd := &sdConnectInfo{connectable: mockC}
 
@@ -291,7 +292,7 @@ func Test_SDConnect_ValidateLogin_OK(t *testing.T) {
 
 func Test_SDConnect_ValidateLogin_Override_OK(t *testing.T) {
 	project := "project_7376"
-	projects := []Metadata{{-1, project}}
+	projects := []Metadata{{Bytes: -1, Name: project}}
 	mockC := &mockConnecter{
 		projectsErr: errors.New("should not have fetched projects"),
 		token:       sToken{"sToken", "projectID"},
@@ -401,10 +402,10 @@ func Test_SDConnect_GetNthLevel_Projects(t *testing.T) {
 	defer func() { MakeRequest = origMakeRequest }()
 
 	mockC := &mockConnecter{}
-	projects := []Metadata{{34, "Pr3"}, {90, "Pr56"}, {123, "Pr7"}, {4, "Pr12"}}
+	projects := []Metadata{{Bytes: 34, Name: "Pr3"}, {Bytes: 90, Name: "Pr56"}, {Bytes: 123, Name: "Pr7"}, {Bytes: 4, Name: "Pr12"}}
 	sd := &sdConnectInfo{connectable: mockC, projects: projects}
 
-	meta, err := sd.getNthLevel("")
+	meta, err := sd.getNthLevel(context.Background(), "")
 	if err != nil {
 		t.Errorf("Function returned error: %s", err.Error())
 	} else if !reflect.DeepEqual(meta, projects) {
@@ -435,7 +436,7 @@ func Test_SDConnect_CalculateDecryptedSize(t *testing.T) {
 func Test_SDConnect_GetNthLevel_Fail_NoNodes(t *testing.T) {
 	md := []Metadata{{Bytes: 10, Name: "project1"}}
 	sd := &sdConnectInfo{projects: md}
-	metadata, err := sd.getNthLevel("fspath")
+	metadata, err := sd.getNthLevel(context.Background(), "fspath")
 	if err != nil {
 		t.Errorf("Function failed, expected no error, received=%v", err)
 	}
@@ -446,7 +447,7 @@ func Test_SDConnect_GetNthLevel_Fail_NoNodes(t *testing.T) {
 
 func Test_SDConnect_GetNthLevel_Fail_Path(t *testing.T) {
 	sd := &sdConnectInfo{}
-	metadata, err := sd.getNthLevel("fspath", "1", "2", "3")
+	metadata, err := sd.getNthLevel(context.Background(), "fspath", "1", "2", "3")
 	if err != nil {
 		t.Errorf("Function failed, expected no error, received=%v", err)
 	}
@@ -459,14 +460,14 @@ func Test_SDConnect_GetNthLevel_Fail_Request(t *testing.T) {
 	// Mock
 	origMakeRequest := MakeRequest
 	defer func() { MakeRequest = origMakeRequest }()
-	MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+	MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 		return errors.New("some error")
 	}
 	sd := &sdConnectInfo{}
 
 	// Test
 	expectedError := "Failed to retrieve metadata for fspath: some error"
-	_, err := sd.getNthLevel("fspath", "1", "2")
+	_, err := sd.getNthLevel(context.Background(), "fspath", "1", "2")
 	if err.Error() != expectedError {
 		t.Errorf("Function failed, expected=%s, received=%v", expectedError, err)
 	}
@@ -478,7 +479,7 @@ func Test_SDConnect_GetNthLevel_Pass_1Node(t *testing.T) {
 	defer func() { MakeRequest = origMakeRequest }()
 
 	count := 0
-	MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+	MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 		_ = json.NewDecoder(bytes.NewReader([]byte(`[{"bytes":100,"name":"thingy1"}]`))).Decode(ret)
 		if count == 0 {
 			count++
@@ -491,7 +492,7 @@ func Test_SDConnect_GetNthLevel_Pass_1Node(t *testing.T) {
 	sd := &sdConnectInfo{}
 
 	// Test
-	meta, err := sd.getNthLevel("fspath", "1")
+	meta, err := sd.getNthLevel(context.Background(), "fspath", "1")
 	if err != nil {
 		t.Fatalf("Function failed, expected no error, received=%v", err)
 	}
@@ -509,7 +510,7 @@ func Test_SDConnect_GetNthLevel_Pass_2Node(t *testing.T) {
 	defer func() { MakeRequest = origMakeRequest }()
 
 	count := 0
-	MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+	MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 		switch count {
 		case 0:
 			_ = json.NewDecoder(bytes.NewReader([]byte(`[{"bytes":100,"name":"thingy2"}]`))).Decode(ret)
@@ -524,10 +525,10 @@ func Test_SDConnect_GetNthLevel_Pass_2Node(t *testing.T) {
 		return nil
 	}
 	sd := &sdConnectInfo{}
-	objects := []Metadata{{100, "thingy2"}, {674, "thingy3"}}
+	objects := []Metadata{{Bytes: 100, Name: "thingy2"}, {Bytes: 674, Name: "thingy3"}}
 
 	// Test
-	meta, err := sd.getNthLevel("fspath", "1", "2")
+	meta, err := sd.getNthLevel(context.Background(), "fspath", "1", "2")
 	if err != nil {
 		t.Errorf("Function failed, expected no error, received=%v", err)
 	}
@@ -542,7 +543,7 @@ func Test_SDConnect_GetNthLevel_Pass_TokenExpired(t *testing.T) {
 	defer func() { MakeRequest = origMakeRequest }()
 
 	count := 0
-	MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+	MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 		if token, ok := headers["X-Authorization"]; ok && token == "Bearer freshToken" {
 			if count == 0 {
 				_ = json.NewDecoder(bytes.NewReader([]byte(`[{"bytes":100,"name":"thingy3"}]`))).Decode(ret)
@@ -565,7 +566,7 @@ func Test_SDConnect_GetNthLevel_Pass_TokenExpired(t *testing.T) {
 	}
 
 	// Test
-	meta, err := sd.getNthLevel("sdconnect", "project", "container")
+	meta, err := sd.getNthLevel(context.Background(), "sdconnect", "project", "container")
 	if err != nil {
 		t.Fatalf("Function failed, expected no error, received=%v", err)
 	}
@@ -585,7 +586,7 @@ func Test_SDConnect_GetNthLevel_Fail_TokenExpired(t *testing.T) {
 	expectedError := "Failed to retrieve metadata for sdconnect: API responded with status 401 Unauthorized"
 	origMakeRequest := MakeRequest
 	defer func() { MakeRequest = origMakeRequest }()
-	MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+	MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 		return &RequestError{http.StatusUnauthorized}
 	}
 	mockC := &mockConnecter{sTokens: map[string]sToken{"project": {"freshToken", "projectID"}}}
@@ -596,7 +597,7 @@ func Test_SDConnect_GetNthLevel_Fail_TokenExpired(t *testing.T) {
 	}
 
 	// Test
-	_, err := sd.getNthLevel("sdconnect", "project", "container")
+	_, err := sd.getNthLevel(context.Background(), "sdconnect", "project", "container")
 	if err.Error() != expectedError {
 		t.Errorf("Function failed, expected=%s, received=%v", expectedError, err)
 	}
@@ -628,7 +629,7 @@ func Test_SDConnect_UpdateAttributes(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.testname, func(t *testing.T) {
-			MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+			MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 				switch v := ret.(type) {
 				case *SpecialHeaders:
 					v.Decrypted = tt.decrypted
@@ -641,14 +642,17 @@ func Test_SDConnect_UpdateAttributes(t *testing.T) {
 				}
 			}
 
-			var size = tt.initSize
+			attrs := ObjectAttributes{Size: tt.initSize}
 			sd := &sdConnectInfo{}
-			err := sd.updateAttributes([]string{"path", "to", "file"}, "path/to/file", &size)
+			err := sd.updateAttributes(context.Background(), []string{"path", "to", "file"}, "path/to/file", &attrs)
 
-			if err != nil {
+			switch {
+			case err != nil:
 				t.Errorf("Unexpected error: %s", err.Error())
-			} else if size != tt.finalSize {
-				t.Errorf("Final size was incorrect. Expected=%d, received=%d", tt.finalSize, size)
+			case attrs.Size != tt.finalSize:
+				t.Errorf("Final size was incorrect. Expected=%d, received=%d", tt.finalSize, attrs.Size)
+			case attrs.Decrypted != tt.decrypted:
+				t.Errorf("Decryption status was incorrect. Expected=%t, received=%t", tt.decrypted, attrs.Decrypted)
 			}
 		})
 	}
@@ -667,12 +671,12 @@ func Test_SDConnect_UpdateAttributes_Error(t *testing.T) {
 		},
 		{
 			"WRONG_DATA_TYPE",
-			"SD Connect updateAttributes() was called with incorrect attribute. Expected type *int64, received *string",
+			"SD Connect updateAttributes() was called with incorrect attribute. Expected type *api.ObjectAttributes, received *string",
 			[]string{"Folder", "dir", "file"}, nil, "test",
 		},
 		{
 			"FAIL_DOWNLOAD", errExpected.Error(),
-			[]string{"Folder", "dir", "file"}, errExpected, int64(10),
+			[]string{"Folder", "dir", "file"}, errExpected, ObjectAttributes{Size: 10},
 		},
 	}
 
@@ -681,17 +685,17 @@ func Test_SDConnect_UpdateAttributes_Error(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.testname, func(t *testing.T) {
-			MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+			MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 				return tt.requestErr
 			}
 
 			var err error
 			sd := &sdConnectInfo{}
 			switch v := tt.value.(type) {
-			case int64:
-				err = sd.updateAttributes(tt.nodes, strings.Join(tt.nodes, "/"), &v)
+			case ObjectAttributes:
+				err = sd.updateAttributes(context.Background(), tt.nodes, strings.Join(tt.nodes, "/"), &v)
 			case string:
-				err = sd.updateAttributes(tt.nodes, strings.Join(tt.nodes, "/"), &v)
+				err = sd.updateAttributes(context.Background(), tt.nodes, strings.Join(tt.nodes, "/"), &v)
 			}
 
 			if err == nil {
@@ -713,7 +717,7 @@ func Test_SDConnect_DownloadData_Pass(t *testing.T) {
 	}
 	origMakeRequest := MakeRequest
 	defer func() { MakeRequest = origMakeRequest }()
-	MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+	MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 		// Test that headers were computed properly
 		if !reflect.DeepEqual(headers, expectedHeaders) {
 			t.Errorf("Function failed\nExpected=%s\nReceived=%s", expectedHeaders, headers)
@@ -726,7 +730,7 @@ func Test_SDConnect_DownloadData_Pass(t *testing.T) {
 
 	// Test
 	buf := make([]byte, 10)
-	err := sd.downloadData([]string{"project", "container", "object"}, buf, 0, 10)
+	err := sd.downloadData(context.Background(), []string{"project", "container", "object"}, buf, 0, 10)
 
 	if err != nil {
 		t.Fatalf("Function failed, expected no error, received=%v", err)
@@ -749,7 +753,7 @@ func Test_SDConnect_DownloadData_Pass_TokenExpired(t *testing.T) {
 	origMakeRequest := MakeRequest
 	defer func() { MakeRequest = origMakeRequest }()
 
-	MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+	MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 		if token, ok := headers["X-Authorization"]; ok && token == "Bearer freshToken" {
 			// Test that headers were computed properly
 			if !reflect.DeepEqual(headers, expectedHeaders) {
@@ -772,7 +776,7 @@ func Test_SDConnect_DownloadData_Pass_TokenExpired(t *testing.T) {
 
 	// Test
 	buf := make([]byte, 10)
-	err := sd.downloadData([]string{"project", "container", "object"}, buf, 0, 10)
+	err := sd.downloadData(context.Background(), []string{"project", "container", "object"}, buf, 0, 10)
 
 	if err != nil {
 		t.Fatalf("Function failed, expected no error, received=%v", err)
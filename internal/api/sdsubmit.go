@@ -1,8 +1,10 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"net/url"
 	"strconv"
 	"strings"
@@ -20,8 +22,8 @@ const SDSubmitPrnt string = "SD Apply"
 
 // This exists for unit test mocking
 type submittable interface {
-	getFiles(string, string, string) ([]Metadata, error)
-	getDatasets(string) ([]string, error)
+	getFiles(context.Context, string, string, string) ([]Metadata, error)
+	getDatasets(context.Context, string) ([]string, error)
 }
 
 type submitter struct {
@@ -51,6 +53,20 @@ type fileInfo struct {
 	LastModified              string `json:"lastModified"`
 }
 
+// attributes returns the file metadata that is exposed as extended attributes
+func (f *fileInfo) attributes() map[string]string {
+	attrs := map[string]string{
+		"checksum":      f.DecryptedFileChecksum,
+		"checksum_type": f.DecryptedFileChecksumType,
+		"file_id":       f.FileID,
+		"dataset_id":    f.DatasetID,
+		"created_at":    f.CreatedAt,
+	}
+	maps.DeleteFunc(attrs, func(_, value string) bool { return value == "" })
+
+	return attrs
+}
+
 func init() {
 	su := &submitter{fileIDs: make(map[string]string)}
 	sd := &sdSubmitInfo{submittable: su}
@@ -62,9 +78,9 @@ func init() {
 // Functions for submitter
 //
 
-func (s *submitter) getDatasets(urlStr string) ([]string, error) {
+func (s *submitter) getDatasets(ctx context.Context, urlStr string) ([]string, error) {
 	var datasets []string
-	err := MakeRequest(urlStr+"/metadata/datasets", nil, nil, nil, &datasets)
+	err := MakeRequest(ctx, urlStr+"/metadata/datasets", nil, nil, nil, &datasets)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to retrieve %s datasets from API %s: %w", SDSubmitPrnt, urlStr, err)
 	}
@@ -74,7 +90,7 @@ func (s *submitter) getDatasets(urlStr string) ([]string, error) {
 	return datasets, nil
 }
 
-func (s *submitter) getFiles(fsPath, urlStr, dataset string) ([]Metadata, error) {
+func (s *submitter) getFiles(ctx context.Context, fsPath, urlStr, dataset string) ([]Metadata, error) {
 	var query map[string]string
 	origDataset := dataset
 	split := strings.Split(dataset, "://")
@@ -86,7 +102,7 @@ func (s *submitter) getFiles(fsPath, urlStr, dataset string) ([]Metadata, error)
 	// Request files
 	var files []fileInfo
 	path := urlStr + "/metadata/datasets/" + url.PathEscape(dataset) + "/files"
-	err := MakeRequest(path, query, nil, nil, &files)
+	err := MakeRequest(ctx, path, query, nil, nil, &files)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to retrieve files for dataset %s: %w", fsPath, err)
 	}
@@ -98,7 +114,13 @@ func (s *submitter) getFiles(fsPath, urlStr, dataset string) ([]Metadata, error)
 			if len(filePath) != 2 {
 				return nil, fmt.Errorf("Invalid file path: %s", files[i].FilePath)
 			}
-			md := Metadata{Name: filePath[1], Bytes: files[i].DecryptedFileSize}
+			md := Metadata{
+				Name:         filePath[1],
+				Bytes:        files[i].DecryptedFileSize,
+				LastModified: parseTime(files[i].LastModified),
+				Created:      parseTime(files[i].CreatedAt),
+				Attributes:   files[i].attributes(),
+			}
 			metadata = append(metadata, md)
 
 			s.lock.Lock()
@@ -141,7 +163,7 @@ func (s *sdSubmitInfo) authenticate(_ ...string) error {
 	count, count500 := 0, 0
 
 	for i := range s.urls {
-		datasets, err := s.getDatasets(s.urls[i])
+		datasets, err := s.getDatasets(context.Background(), s.urls[i])
 		if err != nil {
 			var re *RequestError
 			if errors.As(err, &re) && re.StatusCode == 401 {
@@ -175,7 +197,7 @@ func (s *sdSubmitInfo) authenticate(_ ...string) error {
 	return nil
 }
 
-func (s *sdSubmitInfo) getNthLevel(fsPath string, nodes ...string) ([]Metadata, error) {
+func (s *sdSubmitInfo) getNthLevel(ctx context.Context, fsPath string, nodes ...string) ([]Metadata, error) {
 	switch len(nodes) {
 	case 0:
 		i := 0
@@ -192,18 +214,18 @@ func (s *sdSubmitInfo) getNthLevel(fsPath string, nodes ...string) ([]Metadata,
 			return nil, fmt.Errorf("Tried to request files for invalid dataset %s", fsPath)
 		}
 
-		return s.getFiles(fsPath, s.urls[idx], nodes[0])
+		return s.getFiles(ctx, fsPath, s.urls[idx], nodes[0])
 	default:
 		return nil, nil
 	}
 }
 
 // Dummy function, not needed
-func (s *sdSubmitInfo) updateAttributes(_ []string, _ string, _ any) error {
+func (s *sdSubmitInfo) updateAttributes(_ context.Context, _ []string, _ string, _ any) error {
 	return nil
 }
 
-func (s *sdSubmitInfo) downloadData(nodes []string, buffer any, start, end int64) error {
+func (s *sdSubmitInfo) downloadData(ctx context.Context, nodes []string, buffer any, start, end int64) error {
 	idx, ok := s.datasets[nodes[0]]
 	if !ok {
 		return fmt.Errorf("Tried to request content of %s file %s with invalid dataset %s", SDSubmitPrnt, nodes[1], nodes[0])
@@ -218,5 +240,5 @@ func (s *sdSubmitInfo) downloadData(nodes []string, buffer any, start, end int64
 	// Request data
 	path := s.urls[idx] + "/files/" + s.fileIDs[nodes[0]+"_"+strings.Join(nodes[1:], "/")]
 
-	return MakeRequest(path, query, nil, nil, buffer)
+	return MakeRequest(ctx, path, query, nil, nil, buffer)
 }
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 )
 
 const constantError = "some error"
@@ -22,7 +24,7 @@ type mockSubmitter struct {
 	mockError    error
 }
 
-func (s *mockSubmitter) getDatasets(urlStr string) ([]string, error) {
+func (s *mockSubmitter) getDatasets(_ context.Context, urlStr string) ([]string, error) {
 	if urlStr == s.mockURLOK {
 		return s.mockDatasets, nil
 	}
@@ -31,7 +33,7 @@ func (s *mockSubmitter) getDatasets(urlStr string) ([]string, error) {
 
 }
 
-func (s *mockSubmitter) getFiles(_, urlStr, _ string) ([]Metadata, error) {
+func (s *mockSubmitter) getFiles(_ context.Context, _, urlStr, _ string) ([]Metadata, error) {
 	if urlStr == s.mockURLOK {
 		return s.mockFiles, nil
 	}
@@ -44,14 +46,14 @@ func Test_SDSubmit_GetDatasets_Fail(t *testing.T) {
 	// Mock
 	origMakeRequest := MakeRequest
 	defer func() { MakeRequest = origMakeRequest }()
-	MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+	MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 		return errors.New(constantError)
 	}
 
 	// Test
 	expectedError := "Failed to retrieve SD Apply datasets from API url: some error"
 	s := submitter{}
-	_, err := s.getDatasets("url")
+	_, err := s.getDatasets(context.Background(), "url")
 
 	if err == nil {
 		t.Error("Function did not return error")
@@ -65,7 +67,7 @@ func Test_SDSubmit_GetDatasets_Pass(t *testing.T) {
 	expectedBody := []string{"dataset1", "dataset2", "dataset3"}
 	origMakeRequest := MakeRequest
 	defer func() { MakeRequest = origMakeRequest }()
-	MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+	MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 		_ = json.NewDecoder(bytes.NewReader([]byte(`["dataset1","dataset2","dataset3"]`))).Decode(ret)
 
 		return nil
@@ -73,7 +75,7 @@ func Test_SDSubmit_GetDatasets_Pass(t *testing.T) {
 
 	// Test
 	s := submitter{}
-	datasets, err := s.getDatasets("url")
+	datasets, err := s.getDatasets(context.Background(), "url")
 
 	if err != nil {
 		t.Fatalf("Function failed, expected no error, received=%v", err)
@@ -87,14 +89,14 @@ func Test_SDSubmit_GetFiles_Fail(t *testing.T) {
 	// Mock
 	origMakeRequest := MakeRequest
 	defer func() { MakeRequest = origMakeRequest }()
-	MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+	MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 		return errors.New(constantError)
 	}
 
 	// Test
 	expectedError := "Failed to retrieve files for dataset fspath: some error"
 	s := submitter{}
-	_, err := s.getFiles("fspath", "url", "dataset1")
+	_, err := s.getFiles(context.Background(), "fspath", "url", "dataset1")
 
 	if err == nil {
 		t.Error("Function did not return error")
@@ -116,6 +118,8 @@ func Test_SDSubmit_GetFiles_Pass(t *testing.T) {
 			DecryptedFileSize:     10,
 			DecryptedFileChecksum: "abc123",
 			Status:                "READY",
+			CreatedAt:             "2023-01-02T03:04:05Z",
+			LastModified:          "2023-05-06T07:08:09Z",
 		},
 		{
 			FileID:                "file2",
@@ -132,7 +136,7 @@ func Test_SDSubmit_GetFiles_Pass(t *testing.T) {
 	testFileJSON, _ := json.Marshal(testFile)
 	origMakeRequest := MakeRequest
 	defer func() { MakeRequest = origMakeRequest }()
-	MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+	MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 		_ = json.NewDecoder(bytes.NewReader(testFileJSON)).Decode(ret)
 
 		return nil
@@ -140,7 +144,7 @@ func Test_SDSubmit_GetFiles_Pass(t *testing.T) {
 
 	// Test
 	s := submitter{fileIDs: make(map[string]string)}
-	meta, err := s.getFiles("fspath", "url", "dataset1")
+	meta, err := s.getFiles(context.Background(), "fspath", "url", "dataset1")
 
 	if err != nil {
 		t.Fatalf("Function failed, expected no error, received=%v", err)
@@ -155,6 +159,18 @@ func Test_SDSubmit_GetFiles_Pass(t *testing.T) {
 	if s.fileIDs["dataset1_file1.txt"] != "file1" {
 		t.Errorf("Function failed, expected=%s, received=%s", "file1", s.fileIDs["dataset1_file1.txt"])
 	}
+	if !meta[0].Created.Equal(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("Function returned incorrect creation time %v", meta[0].Created)
+	}
+	if !meta[0].LastModified.Equal(time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC)) {
+		t.Errorf("Function returned incorrect modification time %v", meta[0].LastModified)
+	}
+	expectedAttrs := map[string]string{
+		"checksum": "abc123", "file_id": "file1", "dataset_id": "dataset1", "created_at": "2023-01-02T03:04:05Z",
+	}
+	if !reflect.DeepEqual(meta[0].Attributes, expectedAttrs) {
+		t.Errorf("Function returned incorrect attributes\nExpected=%v\nReceived=%v", expectedAttrs, meta[0].Attributes)
+	}
 }
 
 func Test_SDSubmit_GetFiles_Split_Pass(t *testing.T) {
@@ -175,7 +191,7 @@ func Test_SDSubmit_GetFiles_Split_Pass(t *testing.T) {
 	testFileJSON, _ := json.Marshal(testFile)
 	origMakeRequest := MakeRequest
 	defer func() { MakeRequest = origMakeRequest }()
-	MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+	MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 		path := "url/metadata/datasets/dataset1/files"
 		if url != path {
 			return fmt.Errorf("makeRequest() received incorrect url\nExpected=%s\nReceived=%s", path, url)
@@ -190,7 +206,7 @@ func Test_SDSubmit_GetFiles_Split_Pass(t *testing.T) {
 
 	// Test
 	s := submitter{fileIDs: make(map[string]string)}
-	meta, err := s.getFiles("fspath", "url", "https://dataset1")
+	meta, err := s.getFiles(context.Background(), "fspath", "url", "https://dataset1")
 
 	if err != nil {
 		t.Fatalf("Function failed, expected no error, received=%v", err)
@@ -435,7 +451,7 @@ func Test_SDSubmit_GetNthLevel_Pass_0(t *testing.T) {
 			Bytes: -1,
 		},
 	}
-	datasets, err := s.getNthLevel("irrelevant")
+	datasets, err := s.getNthLevel(context.Background(), "irrelevant")
 
 	if err != nil {
 		t.Fatalf("Function failed, expected no error, received=%v", err)
@@ -457,7 +473,7 @@ func Test_SDSubmit_GetNthLevel_Fail_1(t *testing.T) {
 
 	// Test
 	expectedError := "Tried to request files for invalid dataset fspath"
-	_, err := s.getNthLevel("fspath", "dataset2")
+	_, err := s.getNthLevel(context.Background(), "fspath", "dataset2")
 
 	if err == nil {
 		t.Error("Function did not return error")
@@ -476,7 +492,7 @@ func Test_SDSubmit_GetNthLevel_Pass_1(t *testing.T) {
 	}
 
 	// Test
-	files, err := s.getNthLevel("fspath", "dataset1")
+	files, err := s.getNthLevel(context.Background(), "fspath", "dataset1")
 
 	if err != nil {
 		t.Fatalf("Function failed, expected no error, received=%v", err)
@@ -491,7 +507,7 @@ func Test_SDSubmit_GetNthLevel_Default(t *testing.T) {
 	s := &sdSubmitInfo{}
 
 	// Test
-	files, err := s.getNthLevel("fspath", "node1", "node2")
+	files, err := s.getNthLevel(context.Background(), "fspath", "node1", "node2")
 
 	if err != nil {
 		t.Fatalf("Function failed, expected no error, received=%v", err)
@@ -503,7 +519,7 @@ func Test_SDSubmit_GetNthLevel_Default(t *testing.T) {
 
 func Test_SDSubmit_UpdateAttributes(t *testing.T) {
 	s := &sdSubmitInfo{}
-	if s.updateAttributes(nil, "", nil) != nil {
+	if s.updateAttributes(context.Background(), nil, "", nil) != nil {
 		t.Error("Function should have returned 'nil'")
 	}
 }
@@ -515,7 +531,7 @@ func Test_SDSubmit_DownloadData_Fail(t *testing.T) {
 	// Test
 	expectedError := "Tried to request content of SD Apply file file1 with invalid dataset missing"
 	buf := []byte{}
-	err := s.downloadData([]string{"missing", "file1"}, buf, 0, 0)
+	err := s.downloadData(context.Background(), []string{"missing", "file1"}, buf, 0, 0)
 
 	if err == nil {
 		t.Error("Function did not return error")
@@ -529,7 +545,7 @@ func Test_SDSubmit_DownloadData_Pass(t *testing.T) {
 	expectedData := []byte("hellothere")
 	origMakeRequest := MakeRequest
 	defer func() { MakeRequest = origMakeRequest }()
-	MakeRequest = func(url string, query, headers map[string]string, body io.Reader, ret any) error {
+	MakeRequest = func(ctx context.Context, url string, query, headers map[string]string, body io.Reader, ret any) error {
 		_, _ = io.ReadFull(bytes.NewReader(expectedData), ret.([]byte))
 
 		return nil
@@ -542,7 +558,7 @@ func Test_SDSubmit_DownloadData_Pass(t *testing.T) {
 
 	// Test
 	buf := make([]byte, 10)
-	err := s.downloadData([]string{"dataset1", "file1"}, buf, 0, 10)
+	err := s.downloadData(context.Background(), []string{"dataset1", "file1"}, buf, 0, 10)
 
 	if err != nil {
 		t.Fatalf("Function failed, expected no error, received=%v", err)
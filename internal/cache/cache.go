@@ -1,14 +1,15 @@
 package cache
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/dgraph-io/ristretto"
 )
 
-var cache *Ristretto
-var onceCache sync.Once
+var cache *storage
+var cacheLock sync.Mutex
 
 // RistrettoCacheTTL contains the default time after which a key-value in cache pair will expire
 const RistrettoCacheTTL = 60 * time.Minute
@@ -26,38 +27,77 @@ type Cacheable interface {
 	Clear()
 }
 
+// rangeGetter is implemented by caches that can return part of an item without loading all of it
+type rangeGetter interface {
+	GetRange(string, int64, int64) ([]byte, int64, bool)
+}
+
+// GetRange returns range [start, end) of the item behind key "key", the size of the whole item and a boolean
+// representing whether the item was found or not. The range is cut short if the item ends before 'end'.
+// Only items of type []byte are returned.
+func (r *Ristretto) GetRange(key string, start, end int64) ([]byte, int64, bool) {
+	if rg, ok := r.Cacheable.(rangeGetter); ok {
+		return rg.GetRange(key, start, end)
+	}
+
+	val, found := r.Get(key)
+	if !found {
+		return nil, 0, false
+	}
+	buf, ok := val.([]byte)
+	if !ok {
+		return nil, 0, false
+	}
+	size := int64(len(buf))
+	end = min(end, size)
+	if start > end {
+		return nil, size, true
+	}
+
+	return buf[start:end], size, true
+}
+
 // Because otherwise we cannot mock cache for tests
 type storage struct {
 	cache *ristretto.Cache
 }
 
-// NewRistrettoCache initializes a cache
-var NewRistrettoCache = func() (*Ristretto, error) {
-	var err error
-	onceCache.Do(func() {
-		var ristrettoCache *ristretto.Cache
-		ristrettoCache, err = ristretto.NewCache(&ristretto.Config{
-			// Maximum number of items in cache
-			// A recommended number is expected maximum times 10
-			// so 30 * 10 = 300
-			NumCounters: 300,
-			// Maximum size of cache
-			// Maximum chunk size that is requested is 32MiB.
-			// 1GiB cache can fit 32 items of size 32MiB each
-			// or more items if smaller than 32MiB, as long as
-			// there are not more than 300 items.
-			// Runtime seems to allocate roughly double the size of max cache size,
-			// so this now allocates ~2GiB of memory during runtime.
-			MaxCost:     1 << 30, // 1GiB
-			BufferItems: 64,
-		})
-
-		if err == nil {
-			cache = &Ristretto{Cacheable: &storage{ristrettoCache}}
-		}
+// NewRistrettoCache initializes an in-memory cache which can use at most 'maxCost' bytes.
+// 'itemCost' is the expected size of a typical item and is used to determine how many items the cache tracks.
+// Calling the function again replaces the previous cache with an empty one of the new size,
+// and the previous cache is closed.
+var NewRistrettoCache = func(maxCost, itemCost int64) (*Ristretto, error) {
+	if itemCost <= 0 || maxCost < itemCost {
+		return nil, fmt.Errorf("Cache of size %d cannot hold items of size %d", maxCost, itemCost)
+	}
+
+	ristrettoCache, err := ristretto.NewCache(&ristretto.Config{
+		// Maximum number of items in cache
+		// A recommended number is expected maximum times 10,
+		// e.g. a 1GiB cache with 32MiB items gets 32 * 10 = 320.
+		// Items can be smaller than itemCost, but
+		// there cannot be more than NumCounters items.
+		NumCounters: 10 * (maxCost / itemCost),
+		// Maximum size of cache
+		// Runtime seems to allocate roughly double the size of max cache size,
+		// so a 1GiB cache allocates ~2GiB of memory during runtime.
+		MaxCost:     maxCost,
+		BufferItems: 64,
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	// Only one in-memory cache is kept so that the memory of the previous one is released
+	if cache != nil {
+		cache.cache.Close()
+	}
+	cache = &storage{ristrettoCache}
 
-	return cache, err
+	return &Ristretto{Cacheable: cache}, nil
 }
 
 // Get returns item behind key "key" and a boolean representing whether the item was found or not
@@ -8,7 +8,7 @@ import (
 const wait = 10 * time.Millisecond
 
 func TestNewRistrettoCache(t *testing.T) {
-	c, err := NewRistrettoCache()
+	c, err := NewRistrettoCache(1<<30, 1<<25)
 	if err != nil {
 		t.Fatalf("Creating cache failed: %s", err.Error())
 	}
@@ -17,18 +17,45 @@ func TestNewRistrettoCache(t *testing.T) {
 		t.Fatal("Cache is nil")
 	}
 
-	c2, err2 := NewRistrettoCache()
-	if err2 != nil {
+	c.Set("key", "value", 5, -1)
+	time.Sleep(wait)
+
+	// Cache is replaced when it is initialized again
+	c2, err := NewRistrettoCache(1<<20, 1<<10)
+	if err != nil {
 		t.Fatalf("Second call failed: %s", err.Error())
 	}
+	if c2 == c {
+		t.Fatal("Second call returned the same cache")
+	}
+	if _, ok := c2.Get("key"); ok {
+		t.Error("New cache should be empty")
+	}
+	if _, ok := c.Get("key"); ok {
+		t.Error("Previous cache should have been closed")
+	}
+}
 
-	if c2 != c {
-		t.Fatalf("Second call returned a different cache. Expected address %p, received %p", c, c2)
+func TestNewRistrettoCache_Error(t *testing.T) {
+	var tests = []struct {
+		testname          string
+		maxCost, itemCost int64
+	}{
+		{"FAIL_ZERO_ITEM", 1 << 30, 0},
+		{"FAIL_TOO_SMALL", 1 << 20, 1 << 25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			if _, err := NewRistrettoCache(tt.maxCost, tt.itemCost); err == nil {
+				t.Errorf("Function should have returned error for sizes %d and %d", tt.maxCost, tt.itemCost)
+			}
+		})
 	}
 }
 
 func TestSetAndGet(t *testing.T) {
-	c, err := NewRistrettoCache()
+	c, err := NewRistrettoCache(1<<30, 1<<25)
 	if err != nil {
 		t.Fatalf("Creating cache failed: %s", err.Error())
 	}
@@ -56,8 +83,32 @@ func TestSetAndGet(t *testing.T) {
 	}
 }
 
+func TestGetRange(t *testing.T) {
+	c, err := NewRistrettoCache(1<<30, 1<<25)
+	if err != nil {
+		t.Fatalf("Creating cache failed: %s", err.Error())
+	}
+
+	c.Set("range", []byte("0123456789"), 10, -1)
+	c.Set("string", "not bytes", 9, -1)
+	time.Sleep(wait)
+
+	data, size, ok := c.GetRange("range", 7, 20)
+	switch {
+	case !ok:
+		t.Fatal("Could not find value from cache")
+	case size != 10:
+		t.Errorf("Incorrect item size. Expected=10, received=%d", size)
+	case string(data) != "789":
+		t.Errorf("Cache returned incorrect range\nExpected=789\nReceived=%s", data)
+	}
+	if _, _, ok = c.GetRange("string", 0, 5); ok {
+		t.Error("Cache should not return a range of a value that is not a byte slice")
+	}
+}
+
 func TestSetAndGet_Expired(t *testing.T) {
-	c, err := NewRistrettoCache()
+	c, err := NewRistrettoCache(1<<30, 1<<25)
 	if err != nil {
 		t.Fatalf("Creating cache failed: %s", err.Error())
 	}
@@ -81,7 +132,7 @@ func TestSetAndGet_Expired(t *testing.T) {
 }
 
 func TestDel(t *testing.T) {
-	c, err := NewRistrettoCache()
+	c, err := NewRistrettoCache(1<<30, 1<<25)
 	if err != nil {
 		t.Fatalf("Creating cache failed: %s", err.Error())
 	}
@@ -101,7 +152,7 @@ func TestDel(t *testing.T) {
 }
 
 func TestClear(t *testing.T) {
-	c, err := NewRistrettoCache()
+	c, err := NewRistrettoCache(1<<30, 1<<25)
 	if err != nil {
 		t.Fatalf("Creating cache failed: %s", err.Error())
 	}
@@ -0,0 +1,389 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// headerSize is the number of bytes at the beginning of each cache file that store the expiration time
+const headerSize = 8
+
+// touchInterval is how often the modification time of a file is updated when its item is used.
+// The most recent use of an item is tracked in memory, the file only tells the next run roughly when it was used.
+const touchInterval = time.Minute
+
+// diskStorage stores cache items as files in a directory so that they persist between runs.
+// Items are evicted in least recently used order once the total size exceeds maxCost.
+type diskStorage struct {
+	dir     string
+	maxCost int64
+	cost    int64
+	lock    sync.Mutex
+	items   map[string]*list.Element
+	lru     *list.List       // front is the most recently used item
+	pending map[string]int64 // sizes of evicted files that could not be removed yet, still counted in cost
+}
+
+// diskItem is the bookkeeping for one file in the cache directory
+type diskItem struct {
+	name    string
+	size    int64
+	expires time.Time
+	touched time.Time // modification time of the file
+	readers int       // number of reads in progress, the file is removed only once they have finished
+	evicted bool      // item has been removed from the index while it was being read
+}
+
+// NewDiskCache initializes a cache which stores items in directory 'dir' using at most 'maxCost' bytes of disk.
+// Items left in the directory by a previous run are loaded into the cache.
+var NewDiskCache = func(dir string, maxCost int64) (*Ristretto, error) {
+	if maxCost <= 0 {
+		return nil, fmt.Errorf("Disk cache size must be positive, received %d", maxCost)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("Could not create cache directory %s: %w", dir, err)
+	}
+
+	ds := &diskStorage{dir: dir, maxCost: maxCost, items: make(map[string]*list.Element), lru: list.New(),
+		pending: make(map[string]int64)}
+	if err := ds.load(); err != nil {
+		return nil, fmt.Errorf("Could not read cache directory %s: %w", dir, err)
+	}
+
+	return &Ristretto{Cacheable: ds}, nil
+}
+
+// load fills in the index from files already present in the cache directory.
+// Modification times of the files are used to restore the least recently used order.
+func (ds *diskStorage) load() error {
+	entries, err := os.ReadDir(ds.dir)
+	if err != nil {
+		return err
+	}
+
+	type loaded struct {
+		item    *diskItem
+		modTime time.Time
+	}
+	var found []loaded
+
+	now := time.Now()
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		name := entry.Name()
+		path := filepath.Join(ds.dir, name)
+
+		// Leftovers from writes that were interrupted
+		if _, err := hex.DecodeString(name); err != nil || len(name) != 2*sha256.Size {
+			os.Remove(path)
+
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.Size() < headerSize {
+			os.Remove(path)
+
+			continue
+		}
+
+		expires, err := readExpiration(path)
+		if err != nil || (!expires.IsZero() && now.After(expires)) {
+			os.Remove(path)
+
+			continue
+		}
+
+		item := &diskItem{name: name, size: info.Size() - headerSize, expires: expires, touched: info.ModTime()}
+		found = append(found, loaded{item: item, modTime: info.ModTime()})
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].modTime.Before(found[j].modTime)
+	})
+
+	for i := range found {
+		ds.items[found[i].item.name] = ds.lru.PushFront(found[i].item)
+		ds.cost += found[i].item.size
+	}
+	ds.evict()
+
+	return nil
+}
+
+func readExpiration(path string) (time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+
+	header := make([]byte, headerSize)
+	if _, err = io.ReadFull(file, header); err != nil {
+		return time.Time{}, err
+	}
+
+	return decodeExpiration(header), nil
+}
+
+func decodeExpiration(header []byte) time.Time {
+	nanos := int64(binary.BigEndian.Uint64(header))
+	if nanos == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nanos)
+}
+
+func encodeExpiration(expires time.Time) []byte {
+	header := make([]byte, headerSize)
+	if !expires.IsZero() {
+		binary.BigEndian.PutUint64(header, uint64(expires.UnixNano()))
+	}
+
+	return header
+}
+
+// fileName hashes key so that any key can be used as a file name
+func fileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns item behind key "key" and a boolean representing whether the item was found or not
+func (ds *diskStorage) Get(key string) (any, bool) {
+	data, _, found := ds.GetRange(key, 0, math.MaxInt64)
+	if !found {
+		return nil, false
+	}
+
+	return data, true
+}
+
+// GetRange returns range [start, end) of the item behind key "key", the size of the whole item
+// and a boolean representing whether the item was found or not. Only the range is read from disk.
+func (ds *diskStorage) GetRange(key string, start, end int64) ([]byte, int64, bool) {
+	item, ok := ds.use(fileName(key))
+	if !ok {
+		return nil, 0, false
+	}
+	defer ds.release(item)
+
+	end = min(end, item.size)
+	if start >= end {
+		return []byte{}, item.size, true
+	}
+
+	file, err := os.Open(filepath.Join(ds.dir, item.name))
+	if err != nil {
+		// File was replaced or removed by another process
+		return nil, 0, false
+	}
+	defer file.Close()
+
+	data := make([]byte, end-start)
+	if _, err = file.ReadAt(data, headerSize+start); err != nil {
+		return nil, 0, false
+	}
+
+	return data, item.size, true
+}
+
+// use looks up the item in file 'name' and marks it as the most recently used item. The file is not removed
+// while it is being read, so caller must call release() once it has finished reading the file.
+func (ds *diskStorage) use(name string) (*diskItem, bool) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	elem, ok := ds.items[name]
+	if !ok {
+		return nil, false
+	}
+	item := elem.Value.(*diskItem)
+	now := time.Now()
+	if !item.expires.IsZero() && now.After(item.expires) {
+		ds.remove(elem)
+
+		return nil, false
+	}
+	ds.lru.MoveToFront(elem)
+	item.readers++
+
+	// Modification time tells the next run which items were used most recently
+	if now.Sub(item.touched) >= touchInterval {
+		item.touched = now
+		_ = os.Chtimes(filepath.Join(ds.dir, name), now, now)
+	}
+
+	return item, true
+}
+
+// release marks that a read of 'item' has finished and removes the file of the item
+// if the item was evicted during the read
+func (ds *diskStorage) release(item *diskItem) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	item.readers--
+	if !item.evicted || item.readers > 0 {
+		return
+	}
+	if _, ok := ds.items[item.name]; ok {
+		// The file now belongs to a new item with the same key
+		ds.cost -= item.size
+	} else {
+		ds.removeFile(item.name, item.size)
+	}
+}
+
+// Set stores data to cache with specific key and ttl. If ttl == -1, RistrettoCacheTTL will be used.
+// If ttl == 0, the item does not expire. Only values of type []byte can be stored on disk.
+func (ds *diskStorage) Set(key string, value any, _ int64, ttl time.Duration) bool {
+	data, ok := value.([]byte)
+	if !ok || int64(len(data)) > ds.maxCost {
+		return false
+	}
+
+	if ttl == -1 {
+		ttl = RistrettoCacheTTL
+	}
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+
+	// Write to a temporary file first so that a half written item is never visible
+	tmp, err := os.CreateTemp(ds.dir, "tmp-*")
+	if err != nil {
+		return false
+	}
+	_, err = tmp.Write(encodeExpiration(expires))
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+
+		return false
+	}
+
+	name := fileName(key)
+
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if err = os.Rename(tmp.Name(), filepath.Join(ds.dir, name)); err != nil {
+		os.Remove(tmp.Name())
+
+		return false
+	}
+
+	if elem, ok := ds.items[name]; ok {
+		ds.cost -= elem.Value.(*diskItem).size
+		ds.lru.Remove(elem)
+	}
+	// The new file replaced an evicted file that could not be removed earlier
+	if size, ok := ds.pending[name]; ok {
+		ds.cost -= size
+		delete(ds.pending, name)
+	}
+
+	item := &diskItem{name: name, size: int64(len(data)), expires: expires, touched: time.Now()}
+	ds.items[name] = ds.lru.PushFront(item)
+	ds.cost += item.size
+	ds.evict()
+
+	return true
+}
+
+// Del deletes item with key "key" from cache
+func (ds *diskStorage) Del(key string) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if elem, ok := ds.items[fileName(key)]; ok {
+		ds.remove(elem)
+	}
+}
+
+// Clear removes every item from cache
+func (ds *diskStorage) Clear() {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	for _, elem := range ds.items {
+		ds.remove(elem)
+	}
+}
+
+// evict removes least recently used items until the cache fits into maxCost. Caller must hold the lock.
+func (ds *diskStorage) evict() {
+	ds.retryRemovals()
+	for ds.cost > ds.maxCost {
+		elem := ds.lru.Back()
+		if elem == nil {
+			return
+		}
+		ds.remove(elem)
+	}
+}
+
+// remove deletes the item in 'elem' from the index and the disk. If the item is being read, its file is removed
+// once the reads have finished. Caller must hold the lock.
+func (ds *diskStorage) remove(elem *list.Element) {
+	item := elem.Value.(*diskItem)
+	ds.lru.Remove(elem)
+	delete(ds.items, item.name)
+	if item.readers > 0 {
+		item.evicted = true
+
+		return
+	}
+	ds.removeFile(item.name, item.size)
+}
+
+// removeFile removes file 'name' of 'size' bytes from the disk. If the file cannot be removed, its size stays
+// in the cost and removal is retried on the next eviction. Caller must hold the lock.
+func (ds *diskStorage) removeFile(name string, size int64) {
+	if !removed(filepath.Join(ds.dir, name)) {
+		ds.pending[name] = size
+
+		return
+	}
+	ds.cost -= size
+}
+
+// retryRemovals tries again to remove the files that could not be removed earlier. Caller must hold the lock.
+func (ds *diskStorage) retryRemovals() {
+	for name, size := range ds.pending {
+		if removed(filepath.Join(ds.dir, name)) {
+			delete(ds.pending, name)
+			ds.cost -= size
+		}
+	}
+}
+
+// removed removes file 'path' and tells whether the file no longer exists
+func removed(path string) bool {
+	err := os.Remove(path)
+
+	return err == nil || errors.Is(err, fs.ErrNotExist)
+}
@@ -0,0 +1,287 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewDiskCache_Error(t *testing.T) {
+	if _, err := NewDiskCache(t.TempDir(), 0); err == nil {
+		t.Error("Function should have returned error with zero size")
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, []byte("not a directory"), 0600); err != nil {
+		t.Fatalf("Failed to create file: %s", err.Error())
+	}
+	if _, err := NewDiskCache(filepath.Join(file, "cache"), 100); err == nil {
+		t.Error("Function should have returned error when directory cannot be created")
+	}
+}
+
+func TestDiskCache_SetAndGet(t *testing.T) {
+	c, err := NewDiskCache(t.TempDir(), 100)
+	if err != nil {
+		t.Fatalf("Creating cache failed: %s", err.Error())
+	}
+
+	content := []byte("¿why is a raven like a writing desk?")
+	if !c.Set("bob", content, int64(len(content)), -1) {
+		t.Fatal("Saving value failed")
+	}
+
+	val, ok := c.Get("bob")
+	if !ok {
+		t.Fatal("Could not find value from cache")
+	}
+	if data, ok := val.([]byte); !ok {
+		t.Fatalf("Stored value is not a byte slice")
+	} else if !bytes.Equal(data, content) {
+		t.Fatalf("Cache returned incorrect value\nExpected=%s\nReceived=%s", content, data)
+	}
+
+	if c.Set("alice", "not bytes", 9, -1) {
+		t.Error("Cache should not store values that are not byte slices")
+	}
+	if c.Set("carol", make([]byte, 101), 101, -1) {
+		t.Error("Cache should not store values larger than its maximum size")
+	}
+}
+
+func TestDiskCache_Expired(t *testing.T) {
+	c, err := NewDiskCache(t.TempDir(), 100)
+	if err != nil {
+		t.Fatalf("Creating cache failed: %s", err.Error())
+	}
+
+	content := []byte("To infinity and beyond")
+	if !c.Set("muumi", content, int64(len(content)), 50*time.Millisecond) {
+		t.Fatal("Saving value failed")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := c.Get("muumi"); ok {
+		t.Fatal("Cache returned value even though item should have expired")
+	}
+}
+
+func TestDiskCache_Eviction(t *testing.T) {
+	c, err := NewDiskCache(t.TempDir(), 30)
+	if err != nil {
+		t.Fatalf("Creating cache failed: %s", err.Error())
+	}
+
+	c.Set("first", bytes.Repeat([]byte("a"), 10), 10, -1)
+	c.Set("second", bytes.Repeat([]byte("b"), 10), 10, -1)
+	c.Set("third", bytes.Repeat([]byte("c"), 10), 10, -1)
+
+	// Makes "second" the least recently used item
+	if _, ok := c.Get("first"); !ok {
+		t.Fatal("Could not find value 'first' from cache")
+	}
+	c.Set("fourth", bytes.Repeat([]byte("d"), 10), 10, -1)
+
+	if _, ok := c.Get("second"); ok {
+		t.Error("Least recently used item was not evicted")
+	}
+	for _, key := range []string{"first", "third", "fourth"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("Item %q should not have been evicted", key)
+		}
+	}
+}
+
+func TestDiskCache_Eviction_Reading(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewDiskCache(dir, 20)
+	if err != nil {
+		t.Fatalf("Creating cache failed: %s", err.Error())
+	}
+	ds := c.Cacheable.(*diskStorage)
+
+	c.Set("first", bytes.Repeat([]byte("a"), 10), 10, -1)
+	c.Set("second", bytes.Repeat([]byte("b"), 10), 10, -1)
+
+	// Item is evicted while it is being read
+	item, ok := ds.use(fileName("first"))
+	if !ok {
+		t.Fatal("Could not find value 'first' from cache")
+	}
+	c.Set("third", bytes.Repeat([]byte("c"), 10), 10, -1)
+	c.Set("fourth", bytes.Repeat([]byte("d"), 10), 10, -1)
+
+	if _, ok := ds.items[item.name]; ok {
+		t.Error("Item should have been evicted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, item.name)); err != nil {
+		t.Errorf("File of an item that is being read should not be removed: %s", err.Error())
+	}
+	if ds.cost != 20 {
+		t.Errorf("Incorrect cost. Expected 20, received %d", ds.cost)
+	}
+
+	ds.release(item)
+	if _, err := os.Stat(filepath.Join(dir, item.name)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("File should have been removed once it was no longer read")
+	}
+	if ds.cost != 10 {
+		t.Errorf("Incorrect cost. Expected 10, received %d", ds.cost)
+	}
+}
+
+func TestDiskCache_Eviction_RemoveFails(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewDiskCache(dir, 20)
+	if err != nil {
+		t.Fatalf("Creating cache failed: %s", err.Error())
+	}
+	ds := c.Cacheable.(*diskStorage)
+
+	c.Set("first", bytes.Repeat([]byte("a"), 10), 10, -1)
+
+	// A non-empty directory cannot be removed, like a file that is open on Windows
+	path := filepath.Join(dir, fileName("first"))
+	if err = os.Remove(path); err != nil {
+		t.Fatalf("Failed to remove file: %s", err.Error())
+	}
+	if err = os.MkdirAll(filepath.Join(path, "blocker"), 0700); err != nil {
+		t.Fatalf("Failed to create directory: %s", err.Error())
+	}
+
+	c.Set("second", bytes.Repeat([]byte("b"), 10), 10, -1)
+	c.Set("third", bytes.Repeat([]byte("c"), 10), 10, -1)
+	if _, ok := ds.pending[fileName("first")]; !ok {
+		t.Fatal("File that could not be removed should be pending removal")
+	}
+	// Space taken by the file that could not be removed is freed by evicting the next item
+	if _, ok := c.Get("second"); ok {
+		t.Error("File that could not be removed should still be counted in the size of the cache")
+	}
+	if ds.cost != 20 {
+		t.Errorf("Incorrect cost. Expected 20, received %d", ds.cost)
+	}
+
+	if err = os.Remove(filepath.Join(path, "blocker")); err != nil {
+		t.Fatalf("Failed to remove directory: %s", err.Error())
+	}
+	c.Set("fourth", bytes.Repeat([]byte("d"), 10), 10, -1)
+	if len(ds.pending) != 0 {
+		t.Errorf("Removal should have been retried, %d files are still pending", len(ds.pending))
+	}
+	if ds.cost != 20 {
+		t.Errorf("Incorrect cost. Expected 20, received %d", ds.cost)
+	}
+}
+
+func TestDiskCache_Persist(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewDiskCache(dir, 100)
+	if err != nil {
+		t.Fatalf("Creating cache failed: %s", err.Error())
+	}
+
+	content := []byte("I will survive")
+	c.Set("key", content, int64(len(content)), -1)
+	c.Set("expires", []byte("Gone soon"), 9, 10*time.Millisecond)
+
+	// Leftover from an interrupted write
+	if err = os.WriteFile(filepath.Join(dir, "tmp-1234"), []byte("partial"), 0600); err != nil {
+		t.Fatalf("Failed to create file: %s", err.Error())
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	c2, err := NewDiskCache(dir, 100)
+	if err != nil {
+		t.Fatalf("Creating second cache failed: %s", err.Error())
+	}
+
+	if val, ok := c2.Get("key"); !ok {
+		t.Error("Item did not persist between caches")
+	} else if !bytes.Equal(val.([]byte), content) {
+		t.Errorf("Cache returned incorrect value\nExpected=%s\nReceived=%s", content, val)
+	}
+	if _, ok := c2.Get("expires"); ok {
+		t.Error("Expired item was loaded from disk")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read cache directory: %s", err.Error())
+	}
+	if len(entries) != 1 {
+		t.Errorf("Cache directory should contain exactly one file, found %d", len(entries))
+	}
+}
+
+func TestDiskCache_DelAndClear(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewDiskCache(dir, 100)
+	if err != nil {
+		t.Fatalf("Creating cache failed: %s", err.Error())
+	}
+
+	c.Set("key", []byte("I am information"), 16, -1)
+	c.Set("key2", []byte("More information"), 16, -1)
+	c.Set("key3", []byte("very secret info"), 16, -1)
+
+	c.Del("key")
+	if _, ok := c.Get("key"); ok {
+		t.Errorf("Item was not deleted from cache")
+	}
+
+	c.Clear()
+	if _, ok := c.Get("key2"); ok {
+		t.Errorf("Key 'key2' was not cleared from cache")
+	}
+	if _, ok := c.Get("key3"); ok {
+		t.Errorf("Key 'key3' was not cleared from cache")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read cache directory: %s", err.Error())
+	}
+	if len(entries) != 0 {
+		t.Errorf("Cache directory should be empty, found %d files", len(entries))
+	}
+}
+
+func TestDiskCache_GetRange(t *testing.T) {
+	c, err := NewDiskCache(t.TempDir(), 100)
+	if err != nil {
+		t.Fatalf("Creating cache failed: %s", err.Error())
+	}
+	c.Set("key", []byte("0123456789"), 10, -1)
+
+	var tests = []struct {
+		testname   string
+		start, end int64
+		data       string
+	}{
+		{"MIDDLE", 2, 5, "234"},
+		{"PAST_END", 7, 20, "789"},
+		{"EMPTY", 0, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			data, size, ok := c.GetRange("key", tt.start, tt.end)
+			switch {
+			case !ok:
+				t.Fatal("Could not find value from cache")
+			case size != 10:
+				t.Errorf("Incorrect item size. Expected=10, received=%d", size)
+			case string(data) != tt.data:
+				t.Errorf("Cache returned incorrect range\nExpected=%s\nReceived=%s", tt.data, data)
+			}
+		})
+	}
+
+	if _, _, ok := c.GetRange("nokey", 0, 5); ok {
+		t.Error("Cache returned range of item that does not exist")
+	}
+}
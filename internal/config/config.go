@@ -0,0 +1,287 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"sda-filesystem/internal/api"
+	"sda-filesystem/internal/logs"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileEnv can be set to the path of a configuration file that is used instead of the default files
+const fileEnv = "FS_CONFIG"
+
+const fileName = "config.yaml"
+
+// Config contains the settings that can be given in a configuration file.
+// Fields that are not present in the file are nil or empty.
+type Config struct {
+	SDConnectAPI string  `yaml:"sd_connect_api"`
+	SDApplyAPI   string  `yaml:"sd_apply_api"`
+	ProxyURL     string  `yaml:"proxy_url"`
+	Certs        string  `yaml:"certs"`
+	Mount        string  `yaml:"mount"`
+	LogLevel     string  `yaml:"log_level"`
+	HTTP         HTTP    `yaml:"http"`
+	Cache        Cache   `yaml:"cache"`
+	Airlock      Airlock `yaml:"airlock"`
+}
+
+// HTTP contains the settings for HTTP requests
+type HTTP struct {
+	Timeout    *int `yaml:"timeout"`     // seconds
+	Retries    *int `yaml:"retries"`     // attempts
+	RetryDelay *int `yaml:"retry_delay"` // milliseconds
+}
+
+// Cache contains the settings for caching downloaded data
+type Cache struct {
+	Dir       string `yaml:"dir"`
+	DiskSize  *int   `yaml:"disk_size"`  // MiB
+	Memory    *int   `yaml:"memory"`     // MiB
+	ChunkSize *int   `yaml:"chunk_size"` // MiB
+	TTL       *int   `yaml:"ttl"`        // minutes
+	ReadAhead *int   `yaml:"read_ahead"` // chunks
+}
+
+// Airlock contains the default settings for exporting files
+type Airlock struct {
+	SegmentSize *int  `yaml:"segment_size"` // MB
+	Parallel    *int  `yaml:"parallel"`     // segments
+	Quiet       *bool `yaml:"quiet"`
+	Stream      *bool `yaml:"stream"`
+}
+
+// Files returns the configuration files that are read, in the order they are applied. The system-wide file is
+// followed by the file of the user. If environment variable FS_CONFIG is set, only that file is read.
+var Files = func() []string {
+	if file, ok := os.LookupEnv(fileEnv); ok {
+		return []string{file}
+	}
+
+	files := []string{}
+	switch runtime.GOOS {
+	case "windows":
+		if dir, ok := os.LookupEnv("ProgramData"); ok {
+			files = append(files, filepath.Join(dir, "sda-filesystem", fileName))
+		}
+	default:
+		files = append(files, filepath.Join("/etc", "sda-filesystem", fileName))
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		files = append(files, filepath.Join(dir, "sda-filesystem", fileName))
+	}
+
+	return files
+}
+
+// Load reads the configuration files returned by Files and returns the configuration along with the files
+// that were read. Settings in later files override those in earlier files.
+// Files that do not exist are skipped, unless the file was given in FS_CONFIG.
+var Load = func() (*Config, []string, error) {
+	_, required := os.LookupEnv(fileEnv)
+	cfg := &Config{}
+	read := []string{}
+	for _, file := range Files() {
+		err := cfg.readFile(file)
+		if !required && errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		logs.Debugf("Read configuration file %s", file)
+		read = append(read, file)
+	}
+
+	return cfg, read, nil
+}
+
+// LoadFile reads only the configuration file 'file'
+func LoadFile(file string) (*Config, error) {
+	cfg := &Config{}
+	if err := cfg.readFile(file); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) readFile(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("Could not read configuration file %s: %w", file, err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("Invalid configuration file %s: %w", file, err)
+	}
+
+	c.Certs = expandHome(c.Certs)
+	c.Mount = expandHome(c.Mount)
+	c.Cache.Dir = expandHome(c.Cache.Dir)
+
+	return nil
+}
+
+// expandHome replaces a leading ~ in 'path' with the home directory of the user
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, path[1:])
+}
+
+// SetEnv sets the environment variables that correspond to the endpoints and certificates in the configuration.
+// Variables that are already set in the environment are not changed.
+func (c *Config) SetEnv() error {
+	values := map[string]string{
+		"FS_SD_CONNECT_API": c.SDConnectAPI,
+		"FS_SD_SUBMIT_API":  c.SDApplyAPI,
+		"PROXY_URL":         c.ProxyURL,
+		"FS_CERTS":          c.Certs,
+	}
+	for name, value := range values {
+		if _, ok := os.LookupEnv(name); ok || value == "" {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return fmt.Errorf("Could not set environment variable %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// SetFlags sets the flags in 'values' to the values from the configuration, so that they act as defaults which
+// the command line can override. Must be called before the flags are parsed. Nil values are skipped.
+func SetFlags(flags *flag.FlagSet, values map[string]any) error {
+	for name, value := range values {
+		var str string
+		switch v := value.(type) {
+		case string:
+			if v == "" {
+				continue
+			}
+			str = v
+		case *int:
+			if v == nil {
+				continue
+			}
+			str = strconv.Itoa(*v)
+		case *bool:
+			if v == nil {
+				continue
+			}
+			str = strconv.FormatBool(*v)
+		default:
+			return fmt.Errorf("Configuration for flag %s has unsupported type %T", name, value)
+		}
+
+		if err := flags.Set(name, str); err != nil {
+			return fmt.Errorf("Invalid configuration for flag %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks that the values in the configuration are sensible
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(validURL(c.SDConnectAPI), "sd_connect_api %q is not a valid https URL", c.SDConnectAPI)
+	for _, u := range strings.Split(c.SDApplyAPI, ",") {
+		check(validURL(u), "sd_apply_api %q is not a valid https URL", u)
+	}
+	check(validURL(c.ProxyURL), "proxy_url %q is not a valid https URL", c.ProxyURL)
+	if c.Certs != "" {
+		info, err := os.Stat(c.Certs)
+		check(err == nil && !info.IsDir(), "certs %s is not a file", c.Certs)
+	}
+	if c.Mount != "" {
+		info, err := os.Stat(c.Mount)
+		check(err != nil || info.IsDir(), "mount %s is not a directory", c.Mount)
+	}
+	if c.LogLevel != "" {
+		check(logs.ValidLevel(c.LogLevel), "log_level %q is not one of {debug,info,warning,error}", c.LogLevel)
+	}
+
+	positive := map[string]*int{
+		"http.timeout": c.HTTP.Timeout, "http.retries": c.HTTP.Retries,
+		"cache.disk_size": c.Cache.DiskSize, "cache.memory": c.Cache.Memory,
+		"cache.chunk_size": c.Cache.ChunkSize, "cache.ttl": c.Cache.TTL,
+	}
+	for _, name := range sortedKeys(positive) {
+		value := positive[name]
+		check(value == nil || *value > 0, "%s must be positive", name)
+	}
+	// A chunk has to fit in both caches, values that are not set are compared with the defaults
+	if chunkSize := Or(c.Cache.ChunkSize, api.DefaultChunkSize>>20); chunkSize > 0 {
+		check(Or(c.Cache.Memory, api.DefaultMemoryCacheSize>>20) >= chunkSize,
+			"cache.memory cannot be smaller than cache.chunk_size")
+		check(Or(c.Cache.DiskSize, api.DefaultDiskCacheSize>>20) >= chunkSize,
+			"cache.disk_size cannot be smaller than cache.chunk_size")
+	}
+	check(c.HTTP.RetryDelay == nil || *c.HTTP.RetryDelay >= 0, "http.retry_delay cannot be negative")
+	check(c.Cache.ReadAhead == nil || *c.Cache.ReadAhead >= 0, "cache.read_ahead cannot be negative")
+	check(c.Airlock.SegmentSize == nil || (*c.Airlock.SegmentSize >= 10 && *c.Airlock.SegmentSize <= 4000),
+		"airlock.segment_size must be in range 10-4000")
+	check(c.Airlock.Parallel == nil || *c.Airlock.Parallel > 0, "airlock.parallel must be positive")
+
+	return errors.Join(errs...)
+}
+
+// Or returns the value behind 'value', or 'fallback' if 'value' is nil
+func Or[T any](value *T, fallback T) T {
+	if value == nil {
+		return fallback
+	}
+
+	return *value
+}
+
+// validURL tells if 'value' is empty or a URL with scheme https
+func validURL(value string) bool {
+	if value == "" {
+		return true
+	}
+	u, err := url.ParseRequestURI(value)
+
+	return err == nil && u.Scheme == "https"
+}
+
+func sortedKeys(m map[string]*int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	return keys
+}
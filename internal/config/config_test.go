@@ -0,0 +1,289 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Could not write file %s: %s", path, err.Error())
+	}
+
+	return path
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	system := writeFile(t, dir, "system.yaml", `
+sd_connect_api: https://connect.example.com
+mount: /mnt/system
+http:
+  timeout: 30
+  retries: 5
+cache:
+  memory: 512
+`)
+	user := writeFile(t, dir, "user.yaml", `
+mount: /mnt/user
+http:
+  timeout: 10
+airlock:
+  quiet: true
+`)
+
+	origFiles := Files
+	defer func() { Files = origFiles }()
+	Files = func() []string {
+		return []string{system, filepath.Join(dir, "missing.yaml"), user}
+	}
+
+	cfg, files, err := Load()
+	if err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+	if !reflect.DeepEqual(files, []string{system, user}) {
+		t.Errorf("Incorrect files read. Expected=%v, received=%v", []string{system, user}, files)
+	}
+
+	switch {
+	case cfg.SDConnectAPI != "https://connect.example.com":
+		t.Errorf("Incorrect sd_connect_api %s", cfg.SDConnectAPI)
+	case cfg.Mount != "/mnt/user":
+		t.Errorf("User configuration should override system configuration, received mount %s", cfg.Mount)
+	case cfg.HTTP.Timeout == nil || *cfg.HTTP.Timeout != 10:
+		t.Errorf("Incorrect http.timeout %v", cfg.HTTP.Timeout)
+	case cfg.HTTP.Retries == nil || *cfg.HTTP.Retries != 5:
+		t.Errorf("Value missing from user configuration should be kept, received http.retries %v", cfg.HTTP.Retries)
+	case cfg.HTTP.RetryDelay != nil:
+		t.Errorf("http.retry_delay should not be set")
+	case cfg.Cache.Memory == nil || *cfg.Cache.Memory != 512:
+		t.Errorf("Incorrect cache.memory %v", cfg.Cache.Memory)
+	case cfg.Airlock.Quiet == nil || !*cfg.Airlock.Quiet:
+		t.Errorf("Incorrect airlock.quiet %v", cfg.Airlock.Quiet)
+	}
+}
+
+func TestLoad_Error(t *testing.T) {
+	dir := t.TempDir()
+	unknown := writeFile(t, dir, "unknown.yaml", "mountpoint: /mnt\n")
+	invalid := writeFile(t, dir, "invalid.yaml", "http:\n  timeout: soon\n")
+
+	var tests = []struct {
+		testname, file, errStr string
+	}{
+		{"UNKNOWN_FIELD", unknown, "Invalid configuration file " + unknown + ": yaml: unmarshal errors:\n  line 1: field mountpoint not found in type config.Config"},
+		{"INVALID_VALUE", invalid, "Invalid configuration file " + invalid},
+		{"MISSING_FS_CONFIG", filepath.Join(dir, "missing.yaml"), "Could not read configuration file " + filepath.Join(dir, "missing.yaml")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			t.Setenv(fileEnv, tt.file)
+			_, _, err := Load()
+			if err == nil {
+				t.Errorf("Function should have returned error")
+			} else if !strings.HasPrefix(err.Error(), tt.errStr) {
+				t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errStr, err.Error())
+			}
+		})
+	}
+}
+
+func TestLoadFile_Empty(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "empty.yaml", "# nothing here\n")
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+	if !reflect.DeepEqual(*cfg, Config{}) {
+		t.Errorf("Configuration should be empty, received %+v", *cfg)
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("No home directory")
+	}
+
+	var tests = []struct {
+		path, expected string
+	}{
+		{"~", home},
+		{"~/Projects", filepath.Join(home, "Projects")},
+		{"/mnt/~/Projects", "/mnt/~/Projects"},
+		{"~user/Projects", "~user/Projects"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if path := expandHome(tt.path); path != tt.expected {
+			t.Errorf("Incorrect path for %q. Expected=%s, received=%s", tt.path, tt.expected, path)
+		}
+	}
+}
+
+func TestSetEnv(t *testing.T) {
+	t.Setenv("FS_SD_CONNECT_API", "https://env.example.com")
+	t.Setenv("FS_CERTS", "")
+	os.Unsetenv("FS_CERTS")
+	t.Setenv("FS_SD_SUBMIT_API", "")
+	os.Unsetenv("FS_SD_SUBMIT_API")
+
+	cfg := &Config{SDConnectAPI: "https://config.example.com", Certs: "/etc/certs.pem"}
+	if err := cfg.SetEnv(); err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+
+	if value := os.Getenv("FS_SD_CONNECT_API"); value != "https://env.example.com" {
+		t.Errorf("Environment variable should override configuration, received %s", value)
+	}
+	if value := os.Getenv("FS_CERTS"); value != "/etc/certs.pem" {
+		t.Errorf("Environment variable FS_CERTS was not set from configuration, received %s", value)
+	}
+	if _, ok := os.LookupEnv("FS_SD_SUBMIT_API"); ok {
+		t.Errorf("Environment variable FS_SD_SUBMIT_API should not have been set")
+	}
+}
+
+func TestSetFlags(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	mount := flags.String("mount", "default", "")
+	timeout := flags.Int("timeout", 20, "")
+	retries := flags.Int("retries", 3, "")
+	quiet := flags.Bool("quiet", false, "")
+	yes := true
+
+	err := SetFlags(flags, map[string]any{"mount": "/mnt/config", "timeout": intPtr(40), "retries": (*int)(nil), "quiet": &yes})
+	if err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+	if err = flags.Parse([]string{"-timeout", "50"}); err != nil {
+		t.Fatalf("Could not parse flags: %s", err.Error())
+	}
+
+	if *mount != "/mnt/config" || *timeout != 50 || *retries != 3 || !*quiet {
+		t.Errorf("Incorrect flag values: mount=%s, timeout=%d, retries=%d, quiet=%t", *mount, *timeout, *retries, *quiet)
+	}
+}
+
+func TestSetFlags_Error(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Int("timeout", 20, "")
+
+	var tests = []struct {
+		testname, errStr string
+		values           map[string]any
+	}{
+		{"UNKNOWN_FLAG", "Invalid configuration for flag mount: no such flag -mount", map[string]any{"mount": "/mnt"}},
+		{"INVALID_TYPE", "Configuration for flag timeout has unsupported type int", map[string]any{"timeout": 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			err := SetFlags(flags, tt.values)
+			if err == nil {
+				t.Errorf("Function should have returned error")
+			} else if err.Error() != tt.errStr {
+				t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errStr, err.Error())
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	certs := writeFile(t, dir, "certs.pem", "")
+
+	var tests = []struct {
+		testname string
+		cfg      Config
+		errStrs  []string
+	}{
+		{"OK_EMPTY", Config{}, nil},
+		{
+			"OK", Config{
+				SDConnectAPI: "https://connect.example.com", SDApplyAPI: "https://a.example.com,https://b.example.com",
+				Certs: certs, Mount: filepath.Join(dir, "new"), LogLevel: "debug",
+				HTTP:    HTTP{Timeout: intPtr(1), RetryDelay: intPtr(0)},
+				Cache:   Cache{ReadAhead: intPtr(0)},
+				Airlock: Airlock{SegmentSize: intPtr(10), Parallel: intPtr(1)},
+			}, nil,
+		},
+		{
+			"FAIL_URLS", Config{SDConnectAPI: "http://connect.example.com", SDApplyAPI: "https://a.example.com,b"},
+			[]string{
+				`sd_connect_api "http://connect.example.com" is not a valid https URL`,
+				`sd_apply_api "b" is not a valid https URL`,
+			},
+		},
+		{
+			"FAIL_PATHS", Config{Certs: dir, Mount: certs},
+			[]string{"certs " + dir + " is not a file", "mount " + certs + " is not a directory"},
+		},
+		{
+			"FAIL_NUMBERS", Config{
+				LogLevel: "warn",
+				HTTP:     HTTP{Timeout: intPtr(0), RetryDelay: intPtr(-1)},
+				Cache:    Cache{ChunkSize: intPtr(-3), ReadAhead: intPtr(-1)},
+				Airlock:  Airlock{SegmentSize: intPtr(5000), Parallel: intPtr(0)},
+			},
+			[]string{
+				`log_level "warn" is not one of {debug,info,warning,error}`,
+				"cache.chunk_size must be positive",
+				"http.timeout must be positive",
+				"http.retry_delay cannot be negative",
+				"cache.read_ahead cannot be negative",
+				"airlock.segment_size must be in range 10-4000",
+				"airlock.parallel must be positive",
+			},
+		},
+		{
+			"FAIL_CHUNK_SIZE", Config{Cache: Cache{DiskSize: intPtr(50), Memory: intPtr(50), ChunkSize: intPtr(64)}},
+			[]string{
+				"cache.memory cannot be smaller than cache.chunk_size",
+				"cache.disk_size cannot be smaller than cache.chunk_size",
+			},
+		},
+		{
+			"FAIL_CHUNK_SIZE_DEFAULT_MEMORY", Config{Cache: Cache{ChunkSize: intPtr(2048)}},
+			[]string{"cache.memory cannot be smaller than cache.chunk_size"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			switch {
+			case tt.errStrs == nil && err != nil:
+				t.Errorf("Function returned unexpected error: %s", err.Error())
+			case tt.errStrs != nil && err == nil:
+				t.Errorf("Function should have returned error")
+			case tt.errStrs != nil:
+				if expected := strings.Join(tt.errStrs, "\n"); err.Error() != expected {
+					t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", expected, err.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestOr(t *testing.T) {
+	if value := Or(intPtr(5), 10); value != 5 {
+		t.Errorf("Incorrect value. Expected=5, received=%d", value)
+	}
+	if value := Or(nil, 10); value != 10 {
+		t.Errorf("Incorrect value. Expected=10, received=%d", value)
+	}
+}
@@ -0,0 +1,158 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"sda-filesystem/internal/logs"
+)
+
+// requestTimeout is how long the server waits for a client to send its request
+const requestTimeout = 10 * time.Second
+
+// Request is sent by the client as one line of JSON
+type Request struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+// Response is sent by the server as one line of JSON. Error is empty if the command succeeded.
+type Response struct {
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// Handler runs a command with arguments 'args'. The returned data is encoded as JSON in the response.
+type Handler func(args []string) (any, error)
+
+// Server listens on a Unix domain socket and answers one request per connection
+type Server struct {
+	path     string
+	listener net.Listener
+	handlers map[string]Handler
+	wg       sync.WaitGroup
+}
+
+// Listen creates the socket at 'path' and starts serving the commands in 'handlers'.
+// A socket left behind by a process that is no longer running is replaced.
+var Listen = func(path string, handlers map[string]Handler) (*Server, error) {
+	listener, err := ListenUnix(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{path: path, listener: listener, handlers: handlers}
+	s.wg.Add(1)
+	go s.serve()
+	logs.Infof("Listening for commands on %s", path)
+
+	return s, nil
+}
+
+// Close stops accepting new connections and waits for ongoing requests to finish
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			logs.Errorf("Could not accept connection to control socket: %w", err)
+
+			continue
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	var req Request
+	var resp Response
+
+	_ = conn.SetReadDeadline(time.Now().Add(requestTimeout))
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, &req)
+	}
+	if err != nil {
+		logs.Errorf("Could not read request from control socket: %w", err)
+		resp.Error = "Invalid request"
+	} else {
+		resp = s.run(req)
+	}
+
+	data, _ := json.Marshal(resp)
+	if _, err = conn.Write(append(data, '\n')); err != nil {
+		logs.Errorf("Could not send response to control socket: %w", err)
+	}
+}
+
+func (s *Server) run(req Request) (resp Response) {
+	handler, ok := s.handlers[req.Command]
+	if !ok {
+		resp.Error = fmt.Sprintf("Unknown command %q", req.Command)
+
+		return
+	}
+
+	logs.Debugf("Received command %s %v from control socket", req.Command, req.Args)
+	data, err := handler(req.Args)
+	if err != nil {
+		resp.Error = err.Error()
+
+		return
+	}
+	if data != nil {
+		if resp.Data, err = json.Marshal(data); err != nil {
+			resp.Error = fmt.Sprintf("Could not encode response: %s", err.Error())
+		}
+	}
+
+	return
+}
+
+// Send sends 'req' to the server listening at 'path' and returns the data in the response
+var Send = func(path string, req Request) (json.RawMessage, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not connect to control socket %s: %w", path, err)
+	}
+	defer conn.Close()
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("Could not encode request: %w", err)
+	}
+	if _, err = conn.Write(append(data, '\n')); err != nil {
+		return nil, fmt.Errorf("Could not send request: %w", err)
+	}
+
+	var resp Response
+	if err = json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("Could not read response: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	return resp.Data, nil
+}
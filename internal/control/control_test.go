@@ -0,0 +1,164 @@
+package control
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var errExpected = errors.New("Expected error for test")
+
+func TestServer(t *testing.T) {
+	var tests = []struct {
+		testname, command, data, errStr string
+		args                            []string
+	}{
+		{"OK_DATA", "echo", `["a","b"]`, "", []string{"a", "b"}},
+		{"OK_NO_DATA", "nothing", "", "", nil},
+		{"FAIL_HANDLER", "fail", "", errExpected.Error(), nil},
+		{"FAIL_UNKNOWN", "unknown", "", `Unknown command "unknown"`, nil},
+	}
+
+	handlers := map[string]Handler{
+		"echo":    func(args []string) (any, error) { return args, nil },
+		"nothing": func(_ []string) (any, error) { return nil, nil },
+		"fail":    func(_ []string) (any, error) { return nil, errExpected },
+	}
+
+	path := filepath.Join(t.TempDir(), "ctl.sock")
+	server, err := Listen(path, handlers)
+	if err != nil {
+		t.Fatalf("Listen returned unexpected error: %s", err.Error())
+	}
+	defer server.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Socket was not created: %s", err.Error())
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Socket has incorrect permissions %v", info.Mode().Perm())
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			data, err := Send(path, Request{Command: tt.command, Args: tt.args})
+			switch {
+			case tt.errStr != "":
+				if err == nil {
+					t.Errorf("Function should have returned error")
+				} else if err.Error() != tt.errStr {
+					t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errStr, err.Error())
+				}
+			case err != nil:
+				t.Errorf("Function returned unexpected error: %s", err.Error())
+			case string(data) != tt.data:
+				t.Errorf("Incorrect data. Expected=%s, received=%s", tt.data, data)
+			}
+		})
+	}
+}
+
+func TestServer_InvalidRequest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctl.sock")
+	server, err := Listen(path, nil)
+	if err != nil {
+		t.Fatalf("Listen returned unexpected error: %s", err.Error())
+	}
+	defer server.Close()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Could not connect to socket: %s", err.Error())
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write([]byte("update\n")); err != nil {
+		t.Fatalf("Could not write request: %s", err.Error())
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Could not read response: %s", err.Error())
+	}
+	if expected := `{"error":"Invalid request"}`; strings.TrimSpace(line) != expected {
+		t.Errorf("Incorrect response. Expected=%s, received=%s", expected, line)
+	}
+}
+
+func TestListen_StaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctl.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Could not create socket: %s", err.Error())
+	}
+	// Leave the socket file behind like a process that has crashed
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+
+	server, err := Listen(path, map[string]Handler{"ping": func(_ []string) (any, error) { return "pong", nil }})
+	if err != nil {
+		t.Fatalf("Listen returned unexpected error: %s", err.Error())
+	}
+	defer server.Close()
+
+	if data, err := Send(path, Request{Command: "ping"}); err != nil {
+		t.Errorf("Send returned unexpected error: %s", err.Error())
+	} else if string(data) != `"pong"` {
+		t.Errorf("Incorrect data. Expected=\"pong\", received=%s", data)
+	}
+}
+
+func TestListen_Fail(t *testing.T) {
+	dir := t.TempDir()
+
+	inUse := filepath.Join(dir, "ctl.sock")
+	server, err := Listen(inUse, nil)
+	if err != nil {
+		t.Fatalf("Listen returned unexpected error: %s", err.Error())
+	}
+	defer server.Close()
+
+	notSocket := filepath.Join(dir, "file")
+	if err = os.WriteFile(notSocket, nil, 0600); err != nil {
+		t.Fatalf("Could not create file: %s", err.Error())
+	}
+
+	var tests = []struct {
+		testname, path, errStr string
+	}{
+		{"IN_USE", inUse, "Socket " + inUse + " is already in use"},
+		{"NOT_SOCKET", notSocket, notSocket + " exists and is not a socket"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			_, err := Listen(tt.path, nil)
+			if err == nil {
+				t.Errorf("Function should have returned error")
+			} else if err.Error() != tt.errStr {
+				t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errStr, err.Error())
+			}
+		})
+	}
+}
+
+func TestServer_Close(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctl.sock")
+	server, err := Listen(path, nil)
+	if err != nil {
+		t.Fatalf("Listen returned unexpected error: %s", err.Error())
+	}
+	if err = server.Close(); err != nil {
+		t.Errorf("Close returned unexpected error: %s", err.Error())
+	}
+	if _, err = os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Socket should have been removed")
+	}
+	if _, err = Send(path, Request{Command: "update"}); err == nil {
+		t.Errorf("Send should have failed after server was closed")
+	}
+}
@@ -0,0 +1,47 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+)
+
+// ListenUnix creates a Unix socket at 'path' that only the current user can connect to.
+// A socket left behind by a process that is no longer running is replaced.
+func ListenUnix(path string) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	listener, err := listenUnix(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create socket %s: %w", path, err)
+	}
+
+	return listener, nil
+}
+
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Could not check socket %s: %w", path, err)
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+
+		return fmt.Errorf("Socket %s is already in use", path)
+	}
+	if err = os.Remove(path); err != nil {
+		return fmt.Errorf("Could not remove old socket %s: %w", path, err)
+	}
+
+	return nil
+}
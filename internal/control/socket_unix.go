@@ -0,0 +1,17 @@
+//go:build linux || darwin
+
+package control
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenUnix creates the socket at 'path' so that only the current user can connect to it. The socket
+// is created with a restrictive umask, so that it is never accessible to others, not even briefly.
+func listenUnix(path string) (net.Listener, error) {
+	umask := syscall.Umask(0177)
+	defer syscall.Umask(umask)
+
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,10 @@
+package control
+
+import (
+	"net"
+)
+
+// listenUnix creates the socket at 'path'. Access to the socket is determined by the permissions of its directory.
+func listenUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,194 @@
+package daemon
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"sda-filesystem/internal/logs"
+)
+
+// childEnv is set in the environment of the background process started by Start
+const childEnv = "SDA_FILESYSTEM_DAEMON"
+
+// readyFd is the file descriptor of the pipe through which the background process tells it is ready
+const readyFd = 3
+
+// secretFd is the file descriptor of the pipe through which the background process receives the secret given to Start
+const secretFd = 4
+
+// IsChild tells whether this process is the background process started by Start
+func IsChild() bool {
+	return os.Getenv(childEnv) != ""
+}
+
+// messageOutput is where the process that starts a background process writes the messages it receives
+var messageOutput io.Writer = os.Stdout
+
+// readyPipe returns the pipe to the process that started this process in the background, if there is one.
+// The pipe is not passed on to the processes this process starts, e.g. fusermount, since the parent process
+// reads from the pipe until it is told that this process is ready.
+var readyPipe = sync.OnceValue(func() io.WriteCloser {
+	if !IsChild() {
+		return nil
+	}
+	closeOnExec(readyFd)
+
+	return os.NewFile(readyFd, "ready")
+})
+
+// secretPipe returns the pipe from which this process reads the secret given to Start, if there is one
+var secretPipe = func() io.ReadCloser {
+	if !IsChild() {
+		return nil
+	}
+	closeOnExec(secretFd)
+
+	return os.NewFile(secretFd, "secret")
+}
+
+// ParentOutput returns a writer whose lines are written to the standard output of the process that started
+// this process in the background, or nil if there is no such process. Lines need to be written before NotifyReady.
+func ParentOutput() io.Writer {
+	if pipe := readyPipe(); pipe != nil {
+		return pipe
+	}
+
+	return nil
+}
+
+// Secret returns the secret that was given to Start when this process was started in the background,
+// or nil if there is none. The secret can be read only once.
+func Secret() ([]byte, error) {
+	pipe := secretPipe()
+	if pipe == nil {
+		return nil, nil
+	}
+	defer pipe.Close()
+
+	secret, err := io.ReadAll(pipe)
+	if err != nil {
+		clear(secret)
+
+		return nil, fmt.Errorf("Could not read secret from parent process: %w", err)
+	}
+	if len(secret) == 0 {
+		return nil, nil
+	}
+
+	return secret, nil
+}
+
+// Start runs executable 'exe' with arguments 'args' and environment 'env' as a background process whose output
+// is written to 'logPath'. 'secret' is passed to the process through a pipe, which unlike the environment
+// cannot be read by other processes, and the process can read it with Secret.
+// Lines that the process writes to ParentOutput are written to standard output.
+// Returns the PID of the process once it has called NotifyReady.
+func Start(exe string, args, env []string, secret []byte, logPath string) (int, error) {
+	if err := os.MkdirAll(filepath.Dir(logPath), 0700); err != nil {
+		return 0, fmt.Errorf("Could not create directory for log file %s: %w", logPath, err)
+	}
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("Could not open log file %s: %w", logPath, err)
+	}
+	defer logFile.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, fmt.Errorf("Could not create pipe: %w", err)
+	}
+	defer r.Close()
+
+	secretR, secretW, err := os.Pipe()
+	if err != nil {
+		w.Close()
+
+		return 0, fmt.Errorf("Could not create pipe: %w", err)
+	}
+
+	process, err := startProcess(exe, args, append(env, childEnv+"=1"), logFile, w, secretR)
+	w.Close()
+	secretR.Close()
+	if err != nil {
+		return 0, fmt.Errorf("Could not start background process: %w", err)
+	}
+	defer process.Release()
+
+	// Secret is small enough to fit in the pipe buffer, so writing does not wait for the process to read it.
+	// Writing fails only if the process has already exited, which is reported below.
+	_, _ = secretW.Write(secret)
+	secretW.Close()
+
+	// The pipe is closed without the status line if the process fails before it is ready. The pipe is not
+	// read until it is closed, since processes started by the background process may keep it open.
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if scanner.Text() == "READY=1" {
+			return process.Pid, nil
+		}
+		fmt.Fprintln(messageOutput, scanner.Text())
+	}
+
+	return 0, fmt.Errorf("Background process failed to start, see %s", logPath)
+}
+
+// NotifyReady tells the service manager, or the process that started this process in the background,
+// that Data Gateway is ready to be used
+func NotifyReady() {
+	if err := Notify("READY=1"); err != nil {
+		logs.Warningf("Could not notify service manager: %w", err)
+	}
+
+	if pipe := readyPipe(); pipe != nil {
+		if _, err := pipe.Write([]byte("READY=1\n")); err != nil {
+			logs.Warningf("Could not notify parent process: %w", err)
+		}
+		pipe.Close()
+	}
+}
+
+// Notify sends 'state' to the service manager if the process was started by systemd with Type=notify.
+// Does nothing if NOTIFY_SOCKET is not set.
+var Notify = func(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// Abstract socket
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("Could not connect to %s: %w", os.Getenv("NOTIFY_SOCKET"), err)
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("Could not send %s: %w", state, err)
+	}
+
+	return nil
+}
+
+// WritePidfile writes the PID of this process to file 'path'
+func WritePidfile(path string) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return fmt.Errorf("Could not write pidfile %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+
+		return fmt.Errorf("Could not write pidfile %s: %w", path, err)
+	}
+
+	return nil
+}
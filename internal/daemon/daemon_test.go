@@ -0,0 +1,201 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHelperProcess is run as the background process in TestStart
+func TestHelperProcess(t *testing.T) {
+	if !IsChild() {
+		return
+	}
+	secret, err := Secret()
+	if err != nil {
+		os.Exit(1)
+	}
+	// Output is written to the log file
+	os.Stdout.Write(secret)
+	if os.Getenv("HELPER_READY") != "" {
+		// Pipe stays open in a process started by this process
+		if err = exec.Command("sleep", "5").Start(); err != nil {
+			os.Exit(1)
+		}
+		fmt.Fprintln(ParentOutput(), "message")
+		NotifyReady()
+	}
+	os.Exit(0)
+}
+
+func TestStart(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Background processes are not supported on Windows")
+	}
+
+	var tests = []struct {
+		testname string
+		ready    bool
+	}{
+		{"OK", true},
+		{"FAIL_NOT_READY", false},
+	}
+
+	origMessageOutput := messageOutput
+	defer func() { messageOutput = origMessageOutput }()
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("Could not find test executable: %s", err.Error())
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			logPath := filepath.Join(t.TempDir(), "logs", "test.log")
+			env := os.Environ()
+			if tt.ready {
+				env = append(env, "HELPER_READY=1")
+			}
+
+			out := &strings.Builder{}
+			messageOutput = out
+			start := time.Now()
+			pid, err := Start(exe, []string{"-test.run=^TestHelperProcess$"}, env, []byte("secret"), logPath)
+			switch {
+			case !tt.ready:
+				expected := "Background process failed to start, see " + logPath
+				if err == nil {
+					t.Errorf("Function should have returned error")
+				} else if err.Error() != expected {
+					t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", expected, err.Error())
+				}
+			case err != nil:
+				t.Errorf("Function returned unexpected error: %s", err.Error())
+			case pid <= 0:
+				t.Errorf("Function returned invalid PID %d", pid)
+			case out.String() != "message\n":
+				t.Errorf("Incorrect messages. Expected=%q, received=%q", "message\n", out.String())
+			case time.Since(start) > 4*time.Second:
+				t.Errorf("Function should have returned once the process was ready")
+			}
+
+			if data, err := os.ReadFile(logPath); err != nil {
+				t.Errorf("Log file was not created: %s", err.Error())
+			} else if tt.ready && !strings.HasPrefix(string(data), "secret") {
+				t.Errorf("Background process did not receive secret, logs contain %q", data)
+			}
+		})
+	}
+}
+
+func TestNotify(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Datagram sockets are not supported on Windows")
+	}
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Could not create socket: %s", err.Error())
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+	if err = Notify("READY=1"); err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Could not read from socket: %s", err.Error())
+	}
+	if string(buf[:n]) != "READY=1" {
+		t.Errorf("Incorrect message. Expected=READY=1, received=%s", buf[:n])
+	}
+}
+
+func TestNotify_NoSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := Notify("READY=1"); err != nil {
+		t.Errorf("Function returned unexpected error: %s", err.Error())
+	}
+
+	t.Setenv("NOTIFY_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+	if err := Notify("READY=1"); err == nil {
+		t.Errorf("Function should have returned error")
+	}
+}
+
+type mockPipe struct {
+	strings.Builder
+	closed bool
+}
+
+func (p *mockPipe) Close() error {
+	p.closed = true
+
+	return nil
+}
+
+func TestNotifyReady(t *testing.T) {
+	origNotify := Notify
+	origReadyPipe := readyPipe
+	defer func() {
+		Notify = origNotify
+		readyPipe = origReadyPipe
+	}()
+
+	state := ""
+	Notify = func(s string) error {
+		state = s
+
+		return errors.New("Not expected to matter")
+	}
+	pipe := &mockPipe{}
+	readyPipe = func() io.WriteCloser { return pipe }
+
+	NotifyReady()
+
+	if state != "READY=1" {
+		t.Errorf("Service manager was not notified. Expected=READY=1, received=%s", state)
+	}
+	if pipe.String() != "READY=1\n" || !pipe.closed {
+		t.Errorf("Parent process was not notified correctly, received %q", pipe.String())
+	}
+}
+
+func TestWritePidfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "go-fuse.pid")
+	if err := os.WriteFile(path, []byte("1\n"), 0644); err != nil {
+		t.Fatalf("Could not create old pidfile: %s", err.Error())
+	}
+
+	if err := WritePidfile(path); err != nil {
+		t.Fatalf("Function returned unexpected error: %s", err.Error())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Could not read pidfile: %s", err.Error())
+	}
+	if expected := strconv.Itoa(os.Getpid()) + "\n"; string(data) != expected {
+		t.Errorf("Incorrect pidfile content. Expected=%q, received=%q", expected, data)
+	}
+}
+
+func TestWritePidfile_Error(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "go-fuse.pid")
+	if err := WritePidfile(path); err == nil {
+		t.Errorf("Function should have returned error")
+	}
+}
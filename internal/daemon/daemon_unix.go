@@ -0,0 +1,28 @@
+//go:build linux || darwin
+
+package daemon
+
+import (
+	"os"
+	"syscall"
+)
+
+// startProcess starts a process in a new session so that it is not affected by the terminal closing
+func startProcess(exe string, args, env []string, output, ready, secret *os.File) (*os.Process, error) {
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		return nil, err
+	}
+	defer devNull.Close()
+
+	return os.StartProcess(exe, append([]string{exe}, args...), &os.ProcAttr{
+		Env:   env,
+		Files: []*os.File{devNull, output, output, ready, secret},
+		Sys:   &syscall.SysProcAttr{Setsid: true},
+	})
+}
+
+// closeOnExec keeps file descriptor 'fd' from being inherited by the processes this process starts
+func closeOnExec(fd int) {
+	syscall.CloseOnExec(fd)
+}
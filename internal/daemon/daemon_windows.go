@@ -0,0 +1,12 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+)
+
+func startProcess(_ string, _, _ []string, _, _, _ *os.File) (*os.Process, error) {
+	return nil, errors.New("Running in the background is not supported on Windows")
+}
+
+func closeOnExec(_ int) {}
@@ -6,6 +6,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -15,42 +16,100 @@ import (
 	"github.com/billziss-gh/cgofuse/fuse"
 )
 
+// xattrPrefix is the namespace of the extended attributes of the filesystem
+const xattrPrefix = "user.sd."
+
+// sequentialReads is the number of consecutive reads after which a file is considered to be read sequentially
+const sequentialReads = 2
+
 // Open opens a file.
 func (fs *Fuse) Open(path string, _ int) (errc int, fh uint64) {
-	defer fs.synchronize()()
 	logs.Debug("Opening file ", filepath.FromSlash(path))
 
 	if !isValidOpen() {
 		return -fuse.ECANCELED, ^uint64(0)
 	}
 
-	errc, fh = fs.openNode(path, false)
+	return fs.openFile(path)
+}
+
+// openFile opens the file in 'path' and requests its encryption status if it is not yet known
+func (fs *Fuse) openFile(path string) (int, uint64) {
+	fs.listContainer(path, false)
+	fs.lock.Lock()
+	errc, fh := fs.openNode(path, false)
 	if errc != 0 {
-		return
+		fs.lock.Unlock()
+
+		return errc, fh
 	}
+	n := fs.openmap[fh]
+	fs.lock.Unlock()
 
-	if n := fs.openmap[fh]; n.path[0] == api.SDConnect && !n.node.decryptionChecked {
-		newSize := n.node.stat.Size
-		if err := api.UpdateAttributes(n.path, path, &newSize); err != nil {
-			var re *api.RequestError
-			if errors.As(err, &re) && re.StatusCode == 451 {
-				logs.Errorf("You do not have permission to access file %s: %w", path, err)
-				n.node.denied = true
-				n.node.decryptionChecked = true
+	if errc = fs.checkDecryption(n, path); errc != 0 {
+		fs.lock.Lock()
+		fs.closeNode(fh)
+		fs.lock.Unlock()
 
-				return -fuse.EACCES, ^uint64(0)
-			}
-			logs.Errorf("Encryption status and segmented object size of object %s could not be determined: %w", path, err)
+		return errc, ^uint64(0)
+	}
+
+	return 0, fh
+}
+
+// checkDecryption requests the encryption status and the real size of an SD Connect object if they are not yet known
+func (fs *Fuse) checkDecryption(n nodeAndPath, path string) int {
+	fs.lock.RLock()
+	checked := n.path[0] != api.SDConnect || n.node.decryptionChecked
+	attrs := api.ObjectAttributes{Size: n.node.stat.Size}
+	fs.lock.RUnlock()
+
+	if checked {
+		return 0
+	}
+
+	// Filesystem is not locked during the request so that other operations do not need to wait for it
+	err := api.UpdateAttributes(fs.ctx, n.path, path, &attrs)
+
+	defer fs.synchronize()()
+	if err != nil {
+		var re *api.RequestError
+		if errors.As(err, &re) && re.StatusCode == 451 {
+			logs.Errorf("You do not have permission to access file %s: %w", path, err)
+			n.node.denied = true
+			n.node.decryptionChecked = true
+
+			return -fuse.EACCES
+		}
+		logs.Errorf("Encryption status and segmented object size of object %s could not be determined: %w", path, err)
 
-			return -fuse.EIO, ^uint64(0)
+		return -fuse.EIO
+	}
 
-		} else if n.node.stat.Size != newSize {
-			fs.updateNodeSizesAlongPath(path, newSize-n.node.stat.Size, fuse.Now())
+	// Another call may have checked the file while the request was in progress
+	if !n.node.decryptionChecked {
+		if n.node.stat.Size != attrs.Size {
+			fs.updateNodeSizesAlongPath(path, attrs.Size-n.node.stat.Size, fuse.Now())
 		}
+		n.node.decrypted = attrs.Decrypted
 		n.node.decryptionChecked = true
 	}
 
-	return
+	return 0
+}
+
+// Init is called once the filesystem has been mounted
+func (fs *Fuse) Init() {
+	logs.Debug("Data Gateway mounted")
+	if readyNotifier != nil {
+		readyNotifier()
+	}
+}
+
+// Destroy is called when the filesystem is unmounted. Cancels all ongoing requests.
+func (fs *Fuse) Destroy() {
+	logs.Debug("Destroying Data Gateway")
+	fs.cancel()
 }
 
 var isValidOpen = func() bool {
@@ -89,6 +148,7 @@ var isValidOpen = func() bool {
 
 // Opendir opens a directory.
 func (fs *Fuse) Opendir(path string) (errc int, fh uint64) {
+	fs.listContainer(path, true)
 	defer fs.synchronize()()
 	logs.Debug("Opening directory ", filepath.FromSlash(path))
 
@@ -113,7 +173,8 @@ func (fs *Fuse) Releasedir(path string, fh uint64) (errc int) {
 
 // Getattr returns file properties in stat structure.
 func (fs *Fuse) Getattr(path string, stat *fuse.Stat_t, fh uint64) (errc int) {
-	defer fs.synchronize()()
+	fs.listContainer(path, false)
+	defer fs.synchronizeRead()()
 	node := fs.getNode(path, fh).node
 	if node == nil {
 		return -fuse.ENOENT
@@ -125,39 +186,59 @@ func (fs *Fuse) Getattr(path string, stat *fuse.Stat_t, fh uint64) (errc int) {
 
 // Read returns bytes from a file
 func (fs *Fuse) Read(path string, buff []byte, ofst int64, fh uint64) int {
-	defer fs.synchronize()()
 	logs.Debug("Reading ", filepath.FromSlash(path))
 
+	fs.lock.RLock()
 	n := fs.getNode(path, fh)
 	if n.node == nil {
+		fs.lock.RUnlock()
 		logs.Errorf("File %s not found", path)
 
 		return -fuse.ENOENT
 	}
+	denied, size := n.node.denied, n.node.stat.Size
+	fs.lock.RUnlock()
 
-	if n.node.denied {
+	if denied {
 		return -fuse.EACCES
 	}
 
 	// Get file end coordinate
 	endofst := ofst + int64(len(buff))
-	if endofst > n.node.stat.Size {
-		endofst = n.node.stat.Size
+	if endofst > size {
+		endofst = size
 	}
 	if endofst <= ofst {
 		return 0
 	}
 
-	// Download data from file
-	data, err := api.DownloadData(n.path, path, ofst, endofst, n.node.stat.Size)
+	// Download data from file. Filesystem is not locked so that other operations can proceed meanwhile
+	data, err := api.DownloadData(fs.ctx, n.path, path, ofst, endofst, size)
 	if err != nil {
 		logs.Error(err)
 
 		return -fuse.EIO
 	}
 
+	// Prefetch following chunks when file is being read sequentially
+	if st := n.reads; st != nil {
+		st.lock.Lock()
+		if ofst == st.next {
+			st.streak++
+		} else {
+			st.streak, st.ahead = 1, 0
+		}
+		st.next = ofst + int64(len(data))
+		if st.streak >= sequentialReads {
+			st.ahead = api.PrefetchData(st.ctx, n.path, path, ofst, st.ahead, size)
+		}
+		st.lock.Unlock()
+	}
+
 	// Update file accession timestamp
+	fs.lock.Lock()
 	n.node.stat.Atim = fuse.Now()
+	fs.lock.Unlock()
 
 	return copy(buff, data)
 }
@@ -165,7 +246,8 @@ func (fs *Fuse) Read(path string, buff []byte, ofst int64, fh uint64) int {
 // Readdir reads the contents of a directory.
 func (fs *Fuse) Readdir(path string, fill func(name string, stat *fuse.Stat_t, ofst int64) bool,
 	_ int64, fh uint64) (errc int) {
-	defer fs.synchronize()()
+	fs.listContainer(path, true)
+	defer fs.synchronizeRead()()
 	node := fs.getNode(path, fh).node
 	if node == nil {
 		return -fuse.ENOENT
@@ -180,3 +262,72 @@ func (fs *Fuse) Readdir(path string, fill func(name string, stat *fuse.Stat_t, o
 
 	return 0
 }
+
+// Getxattr returns the value of a read-only extended attribute
+func (fs *Fuse) Getxattr(path string, name string) (int, []byte) {
+	attr, ok := strings.CutPrefix(name, xattrPrefix)
+	if !ok {
+		return -fuse.ENOATTR, nil
+	}
+
+	fs.listContainer(path, false)
+	fs.lock.RLock()
+	n := fs.getNode(path, ^uint64(0))
+	fs.lock.RUnlock()
+	if n.node == nil {
+		return -fuse.ENOENT, nil
+	}
+
+	// Encryption status of an object is requested only when it is needed
+	if attr == "decrypted" && hasDecryptionStatus(n) {
+		if errc := fs.checkDecryption(n, path); errc != 0 {
+			return errc, nil
+		}
+	}
+
+	defer fs.synchronizeRead()()
+	value, ok := xattrs(n)[attr]
+	if !ok {
+		return -fuse.ENOATTR, nil
+	}
+
+	return 0, []byte(value)
+}
+
+// Listxattr lists the names of the extended attributes of a file or directory
+func (fs *Fuse) Listxattr(path string, fill func(name string) bool) int {
+	fs.listContainer(path, false)
+	defer fs.synchronizeRead()()
+	n := fs.getNode(path, ^uint64(0))
+	if n.node == nil {
+		return -fuse.ENOENT
+	}
+
+	attrs := xattrs(n)
+	if hasDecryptionStatus(n) && !n.node.denied {
+		attrs["decrypted"] = ""
+	}
+
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !fill(xattrPrefix + name) {
+			return -fuse.ERANGE
+		}
+	}
+
+	return 0
+}
+
+// Setxattr is not permitted as the filesystem is read-only
+func (fs *Fuse) Setxattr(_ string, _ string, _ []byte, _ int) int {
+	return -fuse.EROFS
+}
+
+// Removexattr is not permitted as the filesystem is read-only
+func (fs *Fuse) Removexattr(_ string, _ string) int {
+	return -fuse.EROFS
+}
@@ -2,12 +2,16 @@ package filesystem
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
 	"sda-filesystem/internal/api"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/billziss-gh/cgofuse/fuse"
 )
@@ -34,7 +38,7 @@ func TestOpen(t *testing.T) {
 	}()
 
 	isValidOpen = func() bool { return true }
-	api.UpdateAttributes = func(nodes []string, fsPath string, attr any) error {
+	api.UpdateAttributes = func(ctx context.Context, nodes []string, fsPath string, attr any) error {
 		return &api.RequestError{StatusCode: 404}
 	}
 
@@ -45,11 +49,9 @@ func TestOpen(t *testing.T) {
 			case errc != tt.errc:
 				t.Errorf("Error code incorrect. Expected %d, received %d", tt.errc, errc)
 			case tt.node != nil:
-				if fh != tt.node.stat.Ino {
-					t.Errorf("File handle incorrect. Expected %d, received %d", tt.node.stat.Ino, fh)
-				} else if fs.openmap[tt.node.stat.Ino].node != tt.node {
+				if fs.openmap[fh].node != tt.node {
 					t.Errorf("Filesystem's openmap has incorrect value for file handle %d. Expected address %p, received %p",
-						fh, tt.node, fs.openmap[tt.node.stat.Ino].node)
+						fh, tt.node, fs.openmap[fh].node)
 				}
 			case fh != ^uint64(0):
 				t.Errorf("File handle incorrect. Expected %d, received %d", ^uint64(0), fh)
@@ -58,6 +60,41 @@ func TestOpen(t *testing.T) {
 	}
 }
 
+func TestOpen_Handles(t *testing.T) {
+	fs := getTestFuse(t, false, 5)
+
+	origIsValidOpen := isValidOpen
+	defer func() { isValidOpen = origIsValidOpen }()
+
+	isValidOpen = func() bool { return true }
+
+	path := rep2 + "/example.com/tiedosto"
+	errc1, fh1 := fs.Open(path, 0)
+	errc2, fh2 := fs.Open(path, 0)
+	switch {
+	case errc1 != 0 || errc2 != 0:
+		t.Fatalf("Opening file failed with error codes %d and %d", errc1, errc2)
+	case fh1 == fh2:
+		t.Fatalf("Each open should have its own file handle, received %d twice", fh1)
+	case fs.openmap[fh1].reads == fs.openmap[fh2].reads:
+		t.Errorf("Each file handle should have its own read state")
+	}
+	if files := fs.OpenFiles(); len(files) != 1 {
+		t.Errorf("File open through two handles should be listed once, received %v", files)
+	}
+
+	ctx1, ctx2 := fs.openmap[fh1].reads.ctx, fs.openmap[fh2].reads.ctx
+	fs.Release(path, fh1)
+	switch {
+	case fs.openmap[fh2].node == nil:
+		t.Errorf("Closing one handle should not close the other")
+	case ctx1.Err() == nil:
+		t.Errorf("Closing a handle should cancel its prefetches")
+	case ctx2.Err() != nil:
+		t.Errorf("Closing one handle should not cancel the prefetches of the other")
+	}
+}
+
 func TestOpen_Cancel(t *testing.T) {
 	fs := getTestFuse(t, false, 5)
 
@@ -107,12 +144,12 @@ func TestOpen_Decryption_Check(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.testname, func(t *testing.T) {
-			api.UpdateAttributes = func(nodes []string, fsPath string, attr any) error {
-				size, ok := attr.(*int64)
+			api.UpdateAttributes = func(ctx context.Context, nodes []string, fsPath string, attr any) error {
+				attrs, ok := attr.(*api.ObjectAttributes)
 				if !ok {
-					return fmt.Errorf("updateAttributes() was called with incorrect attribute. Expected type *int64, got %v", reflect.TypeOf(attr))
+					return fmt.Errorf("updateAttributes() was called with incorrect attribute. Expected type *api.ObjectAttributes, got %v", reflect.TypeOf(attr))
 				}
-				*size = tt.sizes[len(tt.sizes)-1]
+				attrs.Size = tt.sizes[len(tt.sizes)-1]
 
 				return nil
 			}
@@ -126,8 +163,8 @@ func TestOpen_Decryption_Check(t *testing.T) {
 			switch {
 			case errc != 0:
 				t.Errorf("Error code incorrect for path %s. Expected 0, received %d", path, errc)
-			case fh != tt.fh:
-				t.Errorf("File handle incorrect for path %s. Expected %d, received %d", path, tt.fh, fh)
+			case fs.openmap[fh].node.stat.Ino != tt.fh:
+				t.Errorf("Handle opened incorrect node for path %s. Expected inode %d, received %d", path, tt.fh, fs.openmap[fh].node.stat.Ino)
 			case !fs.openmap[fh].node.decryptionChecked:
 				t.Errorf("Field 'decyptionChecked' is not true for node %s", path)
 			default:
@@ -174,7 +211,7 @@ func TestOpen_Decryption_Check_Error(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.testname, func(t *testing.T) {
-			api.UpdateAttributes = func(nodes []string, fsPath string, attr any) error {
+			api.UpdateAttributes = func(ctx context.Context, nodes []string, fsPath string, attr any) error {
 				return &api.RequestError{StatusCode: tt.httpStatus}
 			}
 
@@ -222,7 +259,7 @@ func TestOpendir(t *testing.T) {
 	origUpdateAttributes := api.UpdateAttributes
 	defer func() { api.UpdateAttributes = origUpdateAttributes }()
 
-	api.UpdateAttributes = func(nodes []string, fsPath string, attr any) error {
+	api.UpdateAttributes = func(ctx context.Context, nodes []string, fsPath string, attr any) error {
 		return nil
 	}
 
@@ -234,11 +271,9 @@ func TestOpendir(t *testing.T) {
 			case errc != tt.errc:
 				t.Errorf("Error code incorrect. Expected %d, received %d", tt.errc, errc)
 			case tt.node != nil:
-				if fh != tt.node.stat.Ino {
-					t.Errorf("File handle incorrect. Expected %d, received %d", tt.node.stat.Ino, fh)
-				} else if fs.openmap[tt.node.stat.Ino].node != tt.node {
+				if fs.openmap[fh].node != tt.node {
 					t.Errorf("Filesystem's openmap has incorrect value for file handle %d. Expected address %p, received %p",
-						fh, tt.node, fs.openmap[tt.node.stat.Ino].node)
+						fh, tt.node, fs.openmap[fh].node)
 				}
 			case fh != ^uint64(0):
 				t.Errorf("File handle incorrect. Expected %d, received %d", ^uint64(0), fh)
@@ -250,64 +285,72 @@ func TestOpendir(t *testing.T) {
 func TestRelease(t *testing.T) {
 	fs := getTestFuse(t, false, 5)
 
+	// Node is open through two handles
 	node := fs.root.chld[rep2].chld["example.com"].chld["tiedosto"]
-	fs.openmap[node.stat.Ino] = nodeAndPath{node: node}
+	fs.openmap[1] = nodeAndPath{node: node}
+	fs.openmap[2] = nodeAndPath{node: node}
 	node.opencnt = 2
-	ret := fs.Release(rep2+"/example.com/tiedosto", node.stat.Ino)
+	ret := fs.Release(rep2+"/example.com/tiedosto", 1)
 	switch {
 	case ret != 0:
 		t.Errorf("Return value incorrect. Expected=0, received=%d", ret)
 	case node.opencnt != 1:
 		t.Errorf("Node that was closed should have opencnt=1, received=%d", node.opencnt)
-	case fs.openmap[node.stat.Ino].node == nil:
-		t.Errorf("Node should not have been removed from openmap")
+	case fs.openmap[1].node != nil:
+		t.Errorf("Closed handle should have been removed from openmap")
+	case fs.openmap[2].node == nil:
+		t.Errorf("Handle that is still open should not have been removed from openmap")
 	}
 
-	ret = fs.Release(rep2+"/example.com/tiedosto", node.stat.Ino)
+	ret = fs.Release(rep2+"/example.com/tiedosto", 2)
 
 	switch {
 	case ret != 0:
 		t.Errorf("Return value incorrect. Expected=0, received=%d", ret)
 	case node.opencnt != 0:
 		t.Errorf("Node that was closed should have opencnt=0, received=%d", node.opencnt)
-	case fs.openmap[node.stat.Ino].node != nil:
+	case len(fs.openmap) != 0:
 		t.Errorf("Node should have been removed from openmap")
 	}
 
-	if ret := fs.Release(rep2+"/example.com/tiedosto", node.stat.Ino); ret != -fuse.ENOENT {
-		t.Errorf("Return value incorrect. Expected=0, received=%d", ret)
+	if ret := fs.Release(rep2+"/example.com/tiedosto", 2); ret != -fuse.ENOENT {
+		t.Errorf("Return value incorrect. Expected=%d, received=%d", -fuse.ENOENT, ret)
 	}
 }
 
 func TestReleaseDir(t *testing.T) {
 	fs := getTestFuse(t, false, 5)
 
+	// Node is open through two handles
 	node := fs.root.chld[rep1].chld["child_1"].chld["kansio"]
-	fs.openmap[node.stat.Ino] = nodeAndPath{node: node}
+	fs.openmap[1] = nodeAndPath{node: node}
+	fs.openmap[2] = nodeAndPath{node: node}
 	node.opencnt = 2
-	ret := fs.Releasedir(rep1+"/child_1/kansio", node.stat.Ino)
+	ret := fs.Releasedir(rep1+"/child_1/kansio", 1)
 	switch {
 	case ret != 0:
 		t.Errorf("Return value incorrect. Expected=0, received=%d", ret)
 	case node.opencnt != 1:
 		t.Errorf("Node that was closed should have opencnt=1, received=%d", node.opencnt)
-	case fs.openmap[node.stat.Ino].node == nil:
-		t.Errorf("Node should not have been removed from openmap")
+	case fs.openmap[1].node != nil:
+		t.Errorf("Closed handle should have been removed from openmap")
+	case fs.openmap[2].node == nil:
+		t.Errorf("Handle that is still open should not have been removed from openmap")
 	}
 
-	ret = fs.Releasedir(rep1+"/child_1/kansio", node.stat.Ino)
+	ret = fs.Releasedir(rep1+"/child_1/kansio", 2)
 
 	switch {
 	case ret != 0:
 		t.Errorf("Return value incorrect. Expected=0, received=%d", ret)
 	case node.opencnt != 0:
 		t.Errorf("Node that was closed should have opencnt=0, received=%d", node.opencnt)
-	case fs.openmap[node.stat.Ino].node != nil:
+	case len(fs.openmap) != 0:
 		t.Errorf("Node should have been removed from openmap")
 	}
 
-	if ret := fs.Releasedir(rep1+"/child_1/kansio", node.stat.Ino); ret != -fuse.ENOENT {
-		t.Errorf("Return value incorrect. Expected=0, received=%d", ret)
+	if ret := fs.Releasedir(rep1+"/child_1/kansio", 2); ret != -fuse.ENOENT {
+		t.Errorf("Return value incorrect. Expected=%d, received=%d", -fuse.ENOENT, ret)
 	}
 }
 
@@ -337,6 +380,96 @@ func TestGetattr(t *testing.T) {
 	}
 }
 
+func TestGetxattr(t *testing.T) {
+	var tests = []struct {
+		testname, path, name, value string
+		errc                        int
+	}{
+		{"OK_CHECKSUM", rep2 + "/example.com/tiedosto", "user.sd.checksum", "abc123", 0},
+		{"OK_REPOSITORY", rep2 + "/example.com/tiedosto", "user.sd.repository", api.SDSubmit, 0},
+		{"OK_ORIGINAL_NAME", api.SDConnect + "/child_1/kansio/file_3", "user.sd.original_name", "file_3", 0},
+		{"OK_DECRYPTED", api.SDConnect + "/child_2/_folder/test", "user.sd.decrypted", "true", 0},
+		{"FAIL_DECRYPTED_SD_APPLY", rep2 + "/example.com/tiedosto", "user.sd.decrypted", "", -fuse.ENOATTR},
+		{"FAIL_DECRYPTED_DIR", api.SDConnect + "/child_2/_folder", "user.sd.decrypted", "", -fuse.ENOATTR},
+		{"FAIL_DECRYPTED_DENIED", api.SDConnect + "/child_1/kansio/file_2", "user.sd.decrypted", "", -fuse.EACCES},
+		{"FAIL_UNKNOWN", rep2 + "/example.com/tiedosto", "user.sd.unknown", "", -fuse.ENOATTR},
+		{"FAIL_NAMESPACE", rep2 + "/example.com/tiedosto", "security.checksum", "", -fuse.ENOATTR},
+		{"FAIL_ROOT", "", "user.sd.repository", "", -fuse.ENOATTR},
+		{"FAIL_NOT_FOUND", rep2 + "/example.com/file", "user.sd.checksum", "", -fuse.ENOENT},
+	}
+
+	origUpdateAttributes := api.UpdateAttributes
+	defer func() { api.UpdateAttributes = origUpdateAttributes }()
+
+	api.UpdateAttributes = func(_ context.Context, nodes []string, _ string, attr any) error {
+		if nodes[len(nodes)-1] == "file_2" {
+			return &api.RequestError{StatusCode: 451}
+		}
+		attr.(*api.ObjectAttributes).Decrypted = true
+
+		return nil
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			fs := getTestFuse(t, false, 5)
+			fs.root.chld[api.SDConnect] = fs.root.chld[rep1]
+			fs.root.chld[api.SDConnect].originalName = api.SDConnect
+			fs.root.chld[rep2].chld["example.com"].chld["tiedosto"].xattrs = map[string]string{"checksum": "abc123"}
+
+			errc, value := fs.Getxattr(tt.path, tt.name)
+			switch {
+			case errc != tt.errc:
+				t.Errorf("Return value incorrect. Expected=%d, received=%d", tt.errc, errc)
+			case string(value) != tt.value:
+				t.Errorf("Attribute value incorrect. Expected=%q, received=%q", tt.value, value)
+			}
+		})
+	}
+}
+
+func TestListxattr(t *testing.T) {
+	var tests = []struct {
+		testname, path string
+		names          []string
+		errc           int
+	}{
+		{
+			"OK_SD_APPLY", rep2 + "/example.com/tiedosto",
+			[]string{"user.sd.checksum", "user.sd.file_id", "user.sd.original_name", "user.sd.repository"}, 0,
+		},
+		{
+			"OK_SD_CONNECT", api.SDConnect + "/child_1/kansio/file_3",
+			[]string{"user.sd.decrypted", "user.sd.original_name", "user.sd.repository"}, 0,
+		},
+		{"OK_DIR", api.SDConnect + "/child_1/kansio", []string{"user.sd.original_name", "user.sd.repository"}, 0},
+		{"OK_ROOT", "", []string{}, 0},
+		{"FAIL_NOT_FOUND", rep2 + "/example.com/file", []string{}, -fuse.ENOENT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			fs := getTestFuse(t, false, 5)
+			fs.root.chld[api.SDConnect] = fs.root.chld[rep1]
+			fs.root.chld[api.SDConnect].originalName = api.SDConnect
+			fs.root.chld[rep2].chld["example.com"].chld["tiedosto"].xattrs = map[string]string{"checksum": "abc123", "file_id": "file1"}
+
+			names := []string{}
+			errc := fs.Listxattr(tt.path, func(name string) bool {
+				names = append(names, name)
+
+				return true
+			})
+			switch {
+			case errc != tt.errc:
+				t.Errorf("Return value incorrect. Expected=%d, received=%d", tt.errc, errc)
+			case !reflect.DeepEqual(names, tt.names):
+				t.Errorf("Attribute names incorrect\nExpected=%v\nReceived=%v", tt.names, names)
+			}
+		})
+	}
+}
+
 func TestRead(t *testing.T) {
 	fs := getTestFuse(t, false, 5)
 
@@ -373,7 +506,7 @@ func TestRead(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.testname, func(t *testing.T) {
-			api.DownloadData = func(nodes []string, path string, start, end, maxEnd int64) ([]byte, error) {
+			api.DownloadData = func(ctx context.Context, nodes []string, path string, start, end, maxEnd int64) ([]byte, error) {
 				return []byte(tt.data)[start:end], nil
 			}
 
@@ -419,7 +552,7 @@ func TestRead_Error(t *testing.T) {
 	origDownloadData := api.DownloadData
 	defer func() { api.DownloadData = origDownloadData }()
 
-	api.DownloadData = func(nodes []string, path string, start, end, maxEnd int64) ([]byte, error) {
+	api.DownloadData = func(ctx context.Context, nodes []string, path string, start, end, maxEnd int64) ([]byte, error) {
 		return nil, errors.New("Error occurred")
 	}
 
@@ -441,6 +574,196 @@ func TestRead_Error(t *testing.T) {
 	}
 }
 
+func TestRead_Prefetch(t *testing.T) {
+	fs := getTestFuse(t, false, 5)
+
+	node := fs.root.chld[rep2].chld["example.com"].chld["tiedosto"]
+	node.stat.Size = 100
+	fh := node.stat.Ino
+	fs.openmap[fh] = nodeAndPath{node: node, path: []string{}, reads: &readState{}}
+
+	origDownloadData := api.DownloadData
+	origPrefetchData := api.PrefetchData
+	defer func() {
+		api.DownloadData = origDownloadData
+		api.PrefetchData = origPrefetchData
+	}()
+
+	api.DownloadData = func(ctx context.Context, nodes []string, path string, start, end, maxEnd int64) ([]byte, error) {
+		return make([]byte, end-start), nil
+	}
+
+	var calls []int64
+	api.PrefetchData = func(ctx context.Context, nodes []string, path string, ofst, from, maxEnd int64) int64 {
+		calls = append(calls, from)
+
+		return ofst + 50
+	}
+
+	// The third read is not sequential so it resets the streak
+	for _, ofst := range []int64{0, 10, 70, 80, 90} {
+		fs.Read(rep2+"/example.com/tiedosto", make([]byte, 10), ofst, fh)
+	}
+
+	expected := []int64{0, 0, 130}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("Prefetch called incorrectly\nExpected=%v\nReceived=%v", expected, calls)
+	}
+	if ahead := fs.openmap[fh].reads.ahead; ahead != 140 {
+		t.Errorf("Incorrect prefetch offset. Expected 140, received %d", ahead)
+	}
+}
+
+func TestRead_Concurrent(t *testing.T) {
+	fs := getTestFuse(t, false, 5)
+
+	var fileSize int64 = 1000
+	var files []string
+	var collect func(n *node, path string)
+	collect = func(n *node, path string) {
+		for name, chld := range n.chld {
+			if chld.stat.Mode&fuse.S_IFMT == fuse.S_IFREG {
+				chld.stat.Size = fileSize
+				files = append(files, path+"/"+name)
+			} else {
+				collect(chld, path+"/"+name)
+			}
+		}
+	}
+	collect(fs.root, "")
+
+	// Content of each file depends on its path so that mixed up reads are detected
+	content := func(path string, start, end int64) []byte {
+		data := make([]byte, end-start)
+		for i := range data {
+			data[i] = byte((start + int64(i) + int64(len(path))) % 251)
+		}
+
+		return data
+	}
+
+	origDownloadData := api.DownloadData
+	origPrefetchData := api.PrefetchData
+	defer func() {
+		api.DownloadData = origDownloadData
+		api.PrefetchData = origPrefetchData
+	}()
+
+	var active, maxActive atomic.Int32
+	api.DownloadData = func(ctx context.Context, nodes []string, path string, start, end, maxEnd int64) ([]byte, error) {
+		current := active.Add(1)
+		defer active.Add(-1)
+		for {
+			prev := maxActive.Load()
+			if current <= prev || maxActive.CompareAndSwap(prev, current) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+
+		return content(path, start, end), nil
+	}
+	api.PrefetchData = func(ctx context.Context, nodes []string, path string, ofst, from, maxEnd int64) int64 {
+		return from
+	}
+
+	readers, reads := 16, 50
+	var wg sync.WaitGroup
+	errc := make(chan error, readers*reads)
+
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := 0; i < reads; i++ {
+				path := files[(r+i)%len(files)]
+				ofst := int64((r*reads + i*37) % int(fileSize))
+				buff := make([]byte, 100)
+
+				ret := fs.Read(path, buff, ofst, ^uint64(0))
+				expected := content(path, ofst, min(ofst+100, fileSize))
+				if ret != len(expected) || !bytes.Equal(buff[:ret], expected) {
+					errc <- fmt.Errorf("Read of file %s at offset %d returned incorrect data", path, ofst)
+				}
+			}
+		}(r)
+	}
+
+	// Metadata operations run at the same time as the reads
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < reads; i++ {
+				stat := &fuse.Stat_t{}
+				if ret := fs.Getattr(files[i%len(files)], stat, ^uint64(0)); ret != 0 {
+					errc <- fmt.Errorf("Getattr returned %d", ret)
+				}
+				if ret := fs.Readdir("/"+rep1, func(string, *fuse.Stat_t, int64) bool { return true }, 0, ^uint64(0)); ret != 0 {
+					errc <- fmt.Errorf("Readdir returned %d", ret)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		t.Error(err)
+	}
+	if maxActive.Load() < 2 {
+		t.Errorf("Reads did not download data in parallel")
+	}
+}
+
+func TestRead_DoesNotBlock(t *testing.T) {
+	fs := getTestFuse(t, false, 5)
+
+	slowPath := rep2 + "/example.com/tiedosto"
+	fastPath := rep1 + "/child_2/_folder/test"
+	fs.root.chld[rep2].chld["example.com"].chld["tiedosto"].stat.Size = 100
+	fs.root.chld[rep1].chld["child_2"].chld["_folder"].chld["test"].stat.Size = 100
+
+	origDownloadData := api.DownloadData
+	defer func() { api.DownloadData = origDownloadData }()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	api.DownloadData = func(ctx context.Context, nodes []string, path string, start, end, maxEnd int64) ([]byte, error) {
+		if path == slowPath {
+			close(started)
+			<-release
+		}
+
+		return make([]byte, end-start), nil
+	}
+
+	done := make(chan int)
+	go func() {
+		done <- fs.Read(slowPath, make([]byte, 10), 0, ^uint64(0))
+	}()
+	<-started
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		fs.Getattr(slowPath, &fuse.Stat_t{}, ^uint64(0))
+		fs.Readdir("/"+rep1, func(string, *fuse.Stat_t, int64) bool { return true }, 0, ^uint64(0))
+		fs.Read(fastPath, make([]byte, 10), 0, ^uint64(0))
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Error("Operations were blocked by an ongoing read")
+	}
+
+	close(release)
+	if ret := <-done; ret != 10 {
+		t.Errorf("Slow read returned %d, expected 10", ret)
+	}
+}
+
 func TestReaddir(t *testing.T) {
 	fs := getTestFuse(t, false, 5)
 
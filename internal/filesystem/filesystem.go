@@ -1,8 +1,11 @@
 package filesystem
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
+	"maps"
+	"math/rand/v2"
 	"net/url"
 	"os"
 	"os/exec"
@@ -10,9 +13,12 @@ import (
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"sda-filesystem/internal/api"
 	"sda-filesystem/internal/logs"
@@ -24,17 +30,38 @@ const sRDONLY = 00444
 const numRoutines = 4
 
 var signalBridge func()
+var readyNotifier func()
 var host *fuse.FileSystemHost
 
+// lazy means that the contents of containers are listed only when they are first accessed.
+// Listings older than listingTTL are listed again, zero means that they never expire.
+var lazy = false
+var listingTTL time.Duration
+
 // Fuse stores the filesystem structure
 type Fuse struct {
 	fuse.FileSystemBase
-	lock    sync.Mutex
+	lock    sync.RWMutex // protects the nodes and openmap, never held during network requests
 	inoLock sync.RWMutex
 	ino     uint64
+	refresh sync.Mutex // only one refresh runs at a time
 	root    *node
-	openmap map[uint64]nodeAndPath
+	openmap map[uint64]nodeAndPath // open files and directories by file handle
+	fh      uint64                 // previous file handle given out. Protected by lock
 	mount   string
+	ctx     context.Context // cancelled when filesystem is destroyed, cancels ongoing requests
+	cancel  context.CancelFunc
+}
+
+// RefreshSummary tells how many files were added, removed or changed when the filesystem was refreshed
+type RefreshSummary struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+	Changed int `json:"changed"`
+}
+
+func (s RefreshSummary) String() string {
+	return fmt.Sprintf("%d files added, %d removed, %d changed", s.Added, s.Removed, s.Changed)
 }
 
 // node represents one file or directory
@@ -43,18 +70,41 @@ type node struct {
 	chld              map[string]*node
 	opencnt           int
 	originalName      string // so that api calls work
+	listedSize        int64  // size reported when the parent was listed, stat.Size may be replaced by the real size
 	decryptionChecked bool
+	decrypted         bool // whether API decrypts the object, known only when decryptionChecked is true
 	denied            bool
+	modified          time.Time // modification time reported by the repository, zero if unknown
+	xattrs            map[string]string
+	lazy              *listing // non-nil for a container whose contents are listed on demand
+}
+
+// listing keeps track of the contents of a lazily populated container
+type listing struct {
+	lock   sync.Mutex // ensures that the container is listed only once at a time
+	listed time.Time  // when the contents were listed, zero if not listed. Protected by fs.lock
 }
 
 // nodeAndPath contains the node itself and a list of names which are the original path to the node. Yes, a very original name
 type nodeAndPath struct {
-	node *node
-	path []string
+	node  *node
+	path  []string
+	reads *readState
+}
+
+// readState keeps track of how an open file is being read so that sequential reads can be prefetched
+type readState struct {
+	ctx    context.Context // cancelled when the file is closed, stops prefetching
+	cancel context.CancelFunc
+	lock   sync.Mutex
+	next   int64 // offset where the next read begins if reading is sequential
+	ahead  int64 // offset up to which data has already been prefetched
+	streak int   // number of consecutive sequential reads
 }
 
 // containerInfo is a packet of information sent through a channel to createObjects()
 type containerInfo struct {
+	ctx           context.Context
 	containerPath string
 	timestamp     fuse.Timespec
 	fs            *Fuse
@@ -70,6 +120,11 @@ func SetSignalBridge(fn func()) {
 	signalBridge = fn
 }
 
+// SetReadyNotifier sets a function that is called once the filesystem has been mounted
+func SetReadyNotifier(fn func()) {
+	readyNotifier = fn
+}
+
 // CheckPanic recovers from panic if one occured. Used for GUI
 var CheckPanic = func() {
 	if signalBridge != nil {
@@ -82,11 +137,20 @@ var CheckPanic = func() {
 	}
 }
 
-// InitializeFileSystem initializes the in-memory filesystem database
-var InitializeFilesystem = func(send func(Project)) *Fuse {
+// SetLazyPopulation makes the filesystem list the contents of containers only when they are accessed.
+// Listings are refreshed after 'ttl', or never if 'ttl' is zero.
+var SetLazyPopulation = func(ttl time.Duration) {
+	lazy = true
+	listingTTL = ttl
+}
+
+// InitializeFileSystem initializes the in-memory filesystem database.
+// Requests made by the filesystem are cancelled when 'ctx' is cancelled.
+var InitializeFilesystem = func(ctx context.Context, send func(Project)) *Fuse {
 	logs.Info("Initializing in-memory Data Gateway database")
 	timestamp := fuse.Now()
 	fs := Fuse{}
+	fs.ctx, fs.cancel = context.WithCancel(ctx)
 	fs.ino++
 	fs.openmap = map[uint64]nodeAndPath{}
 	fs.root = newNode(fs.ino, fuse.S_IFDIR|sRDONLY, 0, 0, timestamp)
@@ -100,16 +164,9 @@ var InitializeFilesystem = func(send func(Project)) *Fuse {
 		fs.makeNode(fs.root, md, enabled, fuse.S_IFDIR|sRDONLY, timestamp)
 
 		// These are the folders displayed in GUI
-		projects, _ := api.GetNthLevel(enabled, enabled)
+		projects, _ := api.GetNthLevel(ctx, enabled, enabled)
 		for _, project := range projects {
-			projectSafe := project.Name
-
-			// This is mainly here because of SD Submit
-			if u, err := url.ParseRequestURI(projectSafe); err == nil {
-				projectSafe = strings.TrimLeft(strings.TrimPrefix(projectSafe, u.Scheme), ":/")
-			}
-
-			projectSafe = removeInvalidChars(projectSafe)
+			projectSafe := ProjectName(project.Name)
 			projectPath := enabled + "/" + projectSafe
 
 			// Create a project/dataset directory
@@ -150,24 +207,227 @@ func MountFilesystem(fs *Fuse, mount string) {
 	host.Mount(mount, options)
 }
 
-// UnmountFilesystem unmounts filesystem if host is defined
+// UnmountFilesystem unmounts filesystem if host is defined, or stops serving it over WebDAV or HTTP
 func UnmountFilesystem() {
 	if host != nil {
 		host.Unmount()
 	}
+	if s := server.Load(); s != nil {
+		if err := s.Close(); err != nil {
+			logs.Warningf("Could not stop server: %w", err)
+		}
+	}
 }
 
-// RefreshFilesystem clears cache and creates a new fileystem that will reflect any changes
-// that have occurred in the repositories. Does not unmount fuse at any point.
-func (fs *Fuse) RefreshFilesystem(initFunc func(Project), populateFunc func(string, string, int)) {
+// RefreshFilesystem lists the repositories again and updates the filesystem to reflect any changes
+// that have occurred in them. Unchanged files keep their inode numbers and open files can still be read,
+// only changed and removed files are evicted from cache. Does not unmount fuse at any point.
+func (fs *Fuse) RefreshFilesystem(initFunc func(Project), populateFunc func(string, string, int)) (summary RefreshSummary) {
+	fs.refresh.Lock()
+	defer fs.refresh.Unlock()
+
 	logs.Info("Updating Data Gateway")
-	api.ClearCache()
 
-	newFs := InitializeFilesystem(initFunc)
-	newFs.PopulateFilesystem(populateFunc)
-	fs.ino = newFs.ino
-	fs.root = newFs.root
-	fs.openmap = newFs.openmap
+	newFs := InitializeFilesystem(fs.ctx, initFunc)
+	defer newFs.cancel()
+	newFs.PopulateFilesystem(fs.ctx, populateFunc)
+
+	// An incomplete listing would remove files that still exist
+	if fs.ctx.Err() != nil {
+		logs.Warningf("Update of Data Gateway was cancelled")
+
+		return
+	}
+
+	defer fs.synchronize()()
+	fs.mergeNode(fs.root, newFs.root, nil, true, &summary)
+	calculateSizes(fs.root)
+	calculateFinalTimes(fs.root)
+	logs.Infof("Data Gateway updated: %s", summary)
+
+	return
+}
+
+// AutoRefresh refreshes the filesystem periodically until the filesystem is destroyed. The time between
+// refreshes varies randomly around 'interval' so that many instances do not query the APIs at the same time.
+// Projects are refreshed one at a time, see refreshProjects(). 'initFunc' is called for each project found,
+// and 'notify' is called with the changes after each refresh, if they are not nil.
+func (fs *Fuse) AutoRefresh(interval time.Duration, initFunc func(Project), notify func(RefreshSummary)) {
+	logs.Infof("Data Gateway is updated automatically every %v", interval)
+	for {
+		timer := time.NewTimer(refreshDelay(interval))
+		select {
+		case <-fs.ctx.Done():
+			timer.Stop()
+
+			return
+		case <-timer.C:
+		}
+
+		summary := fs.refreshProjects(initFunc)
+		if notify != nil && fs.ctx.Err() == nil {
+			notify(summary)
+		}
+	}
+}
+
+// refreshProjects is like RefreshFilesystem, but the projects are listed and merged into the filesystem one
+// at a time, so that the filesystem is locked only while the changes of one project are applied.
+// Repositories and projects that were added or removed are merged once all projects have been listed.
+func (fs *Fuse) refreshProjects(initFunc func(Project)) (summary RefreshSummary) {
+	fs.refresh.Lock()
+	defer fs.refresh.Unlock()
+
+	logs.Info("Updating Data Gateway")
+
+	newFs := InitializeFilesystem(fs.ctx, initFunc)
+	defer newFs.cancel()
+
+	for rep, repNode := range newFs.root.chld {
+		for pr, prNode := range repNode.chld {
+			// Filesystem which only contains the project
+			projectFs := &Fuse{ctx: newFs.ctx, openmap: map[uint64]nodeAndPath{}}
+			projectFs.root = newNode(0, fuse.S_IFDIR|sRDONLY, 0, 0, fuse.Now())
+			projectFs.root.stat.Size = -1
+			projectRep := newNode(0, fuse.S_IFDIR|sRDONLY, 0, 0, fuse.Now())
+			projectRep.originalName = repNode.originalName
+			projectRep.stat.Size = -1
+			projectRep.chld[pr] = prNode
+			projectFs.root.chld[rep] = projectRep
+			projectFs.PopulateFilesystem(fs.ctx, nil)
+
+			// An incomplete listing would remove files that still exist
+			if fs.ctx.Err() != nil {
+				logs.Warningf("Update of Data Gateway was cancelled")
+
+				return
+			}
+
+			if merged := fs.mergeProject(rep, pr, prNode, &summary); merged != nil {
+				// Project does not need to be merged again with the rest of the filesystem
+				repNode.chld[pr] = merged
+			}
+		}
+	}
+
+	defer fs.synchronize()()
+	fs.mergeNode(fs.root, newFs.root, nil, true, &summary)
+	calculateSizes(fs.root)
+	calculateFinalTimes(fs.root)
+	logs.Infof("Data Gateway updated: %s", summary)
+
+	return
+}
+
+// mergeProject merges project 'src' into project 'pr' of repository 'rep' if the filesystem already has the project,
+// and updates the size of the project and its ancestors. Returns the project in the filesystem, or nil if it was not found.
+func (fs *Fuse) mergeProject(rep, pr string, src *node, summary *RefreshSummary) *node {
+	defer fs.synchronize()()
+
+	repNode := fs.root.chld[rep]
+	if repNode == nil {
+		return nil
+	}
+	dst := repNode.chld[pr]
+	if dst == nil || !isDir(dst) || dst.originalName != src.originalName {
+		return nil
+	}
+
+	fs.mergeNode(dst, src, []string{repNode.originalName, dst.originalName}, true, summary)
+	fs.resize(dst, rep+"/"+pr, fuse.Now())
+	calculateFinalTimes(dst)
+
+	return dst
+}
+
+// refreshDelay returns a random duration within 20 percent of 'interval'
+var refreshDelay = func(interval time.Duration) time.Duration {
+	return interval - interval/5 + rand.N(2*interval/5+1)
+}
+
+// mergeNode updates the children of directory 'dst' to match the children of directory 'src'. Nodes that have not
+// changed are kept as they are, so that their inode numbers and open handles remain valid. Changed and removed files
+// are evicted from cache. Nodes added from 'src' get new inode numbers if 'renumber' is true. The numbers of
+// added, removed and changed files are accumulated in 'summary'. Caller must hold fs.lock.
+func (fs *Fuse) mergeNode(dst, src *node, origPath []string, renumber bool, summary *RefreshSummary) {
+	timestamp := fuse.Now()
+	for name, old := range dst.chld {
+		if n, ok := src.chld[name]; !ok || isDir(n) != isDir(old) || n.originalName != old.originalName {
+			logs.Debugf("Removing %s", filepath.FromSlash(path.Join(path.Join(origPath...), old.originalName)))
+			clearNode(nodeAndPath{node: old, path: append(slices.Clip(origPath), old.originalName)}, nil, timestamp)
+			delete(dst.chld, name)
+			summary.Removed += countFiles(old)
+		}
+	}
+
+	for name, n := range src.chld {
+		old, ok := dst.chld[name]
+		if old == n {
+			// Node has already been merged
+			continue
+		}
+		if !ok {
+			if renumber {
+				fs.renumber(n)
+			}
+			dst.chld[name] = n
+			summary.Added += countFiles(n)
+
+			continue
+		}
+
+		chldPath := append(slices.Clip(origPath), old.originalName)
+		switch {
+		case old.lazy != nil && n.lazy != nil && len(n.chld) == 0:
+			// Contents of a lazy container are listed again when it is next accessed
+			old.lazy.listed = time.Time{}
+			if len(old.chld) == 0 {
+				old.stat.Size = n.stat.Size
+				old.stat.Mtim, old.stat.Ctim, old.stat.Birthtim = n.stat.Mtim, n.stat.Ctim, n.stat.Birthtim
+			}
+		case isDir(n):
+			fs.mergeNode(old, n, chldPath, renumber, summary)
+		case old.listedSize != n.listedSize || !old.modified.Equal(n.modified) || !maps.Equal(old.xattrs, n.xattrs):
+			logs.Debugf("File %s has changed", filepath.FromSlash(path.Join(chldPath...)))
+			api.DeleteFileFromCache(chldPath, old.stat.Size)
+			old.stat.Size = n.stat.Size
+			old.listedSize = n.listedSize
+			old.stat.Mtim, old.stat.Ctim, old.stat.Birthtim = n.stat.Mtim, n.stat.Ctim, n.stat.Birthtim
+			old.modified = n.modified
+			old.xattrs = n.xattrs
+			old.decryptionChecked, old.decrypted, old.denied = false, false, false
+			summary.Changed++
+		}
+	}
+}
+
+// renumber gives node 'n' and all its descendants new inode numbers
+func (fs *Fuse) renumber(n *node) {
+	fs.inoLock.Lock()
+	fs.ino++
+	n.stat.Ino = fs.ino
+	fs.inoLock.Unlock()
+
+	for _, chld := range n.chld {
+		fs.renumber(chld)
+	}
+}
+
+func isDir(n *node) bool {
+	return n.stat.Mode&fuse.S_IFMT == fuse.S_IFDIR
+}
+
+// countFiles returns the number of regular files in the tree under 'n'
+func countFiles(n *node) int {
+	if !isDir(n) {
+		return 1
+	}
+	count := 0
+	for _, chld := range n.chld {
+		count += countFiles(chld)
+	}
+
+	return count
 }
 
 // FilesOpen checks if any of the files are being used by the user
@@ -198,6 +458,7 @@ func (fs *Fuse) FilesOpen() bool {
 
 		return strings.Contains(string(output), volume)
 	default:
+		defer fs.synchronizeRead()()
 		for _, n := range fs.openmap {
 			if n.node.stat.Mode&fuse.S_IFMT == fuse.S_IFREG {
 				return true
@@ -208,11 +469,30 @@ func (fs *Fuse) FilesOpen() bool {
 	return false
 }
 
+// OpenFiles returns the sorted paths of the files that are currently open in the filesystem
+func (fs *Fuse) OpenFiles() []string {
+	defer fs.synchronizeRead()()
+	files := []string{}
+	for _, n := range fs.openmap {
+		if n.node.stat.Mode&fuse.S_IFMT == fuse.S_IFREG {
+			files = append(files, path.Join(n.path...))
+		}
+	}
+	// A file that is open through several handles is listed once
+	sort.Strings(files)
+	files = slices.Compact(files)
+
+	return files
+}
+
 // ClearPath is desined for situations where a file is edited in the repository and the user wants to read this new data.
 // Function clears cache for `path` and updates all its file sizes.
 func (fs *Fuse) ClearPath(path string) error {
 	logs.Infof("Clearing path %s", path)
+	fs.listContainer(path, false)
+	fs.lock.RLock()
 	n := fs.getNode(path, ^uint64(0))
+	fs.lock.RUnlock()
 	if n.node == nil {
 		return fmt.Errorf("Path %s is invalid", path)
 	}
@@ -226,16 +506,19 @@ func (fs *Fuse) ClearPath(path string) error {
 	}
 
 	containerPath := strings.Join(strings.Split(path, string(os.PathSeparator))[:3], "/")
-	objects, err := api.GetNthLevel(n.path[0], containerPath, n.path[1], n.path[2])
+	objects, err := api.GetNthLevel(fs.ctx, n.path[0], containerPath, n.path[1], n.path[2])
 	if err != nil {
 		return fmt.Errorf("Cache not cleared since new file sizes could not be obtained: %w", err)
 	}
 
-	objMap := map[string]int64{}
+	objMap := map[string]api.Metadata{}
 	for _, obj := range objects {
-		objMap[obj.Name] = obj.Bytes
+		objMap[obj.Name] = obj
 	}
 
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
 	oldSize := n.node.stat.Size
 	timestamp := fuse.Now()
 	clearNode(n, objMap, timestamp)
@@ -247,14 +530,18 @@ func (fs *Fuse) ClearPath(path string) error {
 	return nil
 }
 
-func clearNode(n nodeAndPath, meta map[string]int64, timestamp fuse.Timespec) {
+func clearNode(n nodeAndPath, meta map[string]api.Metadata, timestamp fuse.Timespec) {
 	if n.node.stat.Mode&fuse.S_IFMT == fuse.S_IFREG {
 		api.DeleteFileFromCache(n.path, n.node.stat.Size)
-		size, ok := meta[strings.Join(n.path[3:], "/")]
+		obj, ok := meta[strings.Join(n.path[3:], "/")]
 		if ok {
-			n.node.stat.Size = size
+			n.node.stat.Size = obj.Bytes
 			n.node.decryptionChecked = false
 			n.node.stat.Ctim = timestamp
+			if !obj.LastModified.IsZero() {
+				n.node.stat.Mtim = fuse.NewTimespec(obj.LastModified)
+			}
+			n.node.modified = obj.LastModified
 		}
 
 		return
@@ -265,12 +552,13 @@ func clearNode(n nodeAndPath, meta map[string]int64, timestamp fuse.Timespec) {
 	}
 
 	for _, chld := range n.node.chld {
-		clearNode(nodeAndPath{chld, append(n.path, chld.originalName)}, meta, timestamp)
+		clearNode(nodeAndPath{node: chld, path: append(n.path, chld.originalName)}, meta, timestamp)
 	}
 }
 
-// PopulateFilesystem creates the rest of the nodes (files and directories) of the filesystem
-func (fs *Fuse) PopulateFilesystem(send func(string, string, int)) {
+// PopulateFilesystem creates the rest of the nodes (files and directories) of the filesystem.
+// Remaining requests are skipped if 'ctx' is cancelled.
+func (fs *Fuse) PopulateFilesystem(ctx context.Context, send func(string, string, int)) {
 	timestamp := fuse.Now()
 
 	var wg sync.WaitGroup
@@ -301,7 +589,7 @@ func (fs *Fuse) PopulateFilesystem(send func(string, string, int)) {
 				} else {
 					logs.Debugf("Fetching data for %s", filepath.FromSlash(projectPath))
 					prntNode := fs.root.chld[repository].chld[project]
-					containers, err = api.GetNthLevel(repository, projectPath, prntNode.originalName)
+					containers, err = api.GetNthLevel(ctx, repository, projectPath, prntNode.originalName)
 
 					if err != nil {
 						logs.Error(err)
@@ -339,6 +627,19 @@ func (fs *Fuse) PopulateFilesystem(send func(string, string, int)) {
 		send("", "", 0) // So that progressbar knows when to start to show progress
 	}
 
+	if lazy {
+		// Contents of the containers are listed when they are first accessed
+		for _, value := range forChannel {
+			for i := range value {
+				if c := fs.getNode(value[i].Name, ^uint64(0)); c.node != nil {
+					c.node.lazy = &listing{}
+				}
+			}
+		}
+		numJobs = 0
+		forChannel = nil
+	}
+
 	jobs := make(chan containerInfo, numJobs)
 
 	for w := 1; w <= numRoutines; w++ {
@@ -348,7 +649,7 @@ func (fs *Fuse) PopulateFilesystem(send func(string, string, int)) {
 
 	for _, value := range forChannel {
 		for i := range value {
-			jobs <- containerInfo{containerPath: value[i].Name, timestamp: timestamp, fs: fs}
+			jobs <- containerInfo{ctx: ctx, containerPath: value[i].Name, timestamp: timestamp, fs: fs}
 		}
 	}
 	close(jobs)
@@ -357,6 +658,7 @@ func (fs *Fuse) PopulateFilesystem(send func(string, string, int)) {
 
 	// Calculate the size of higher level directories whose size currently is just -1.
 	calculateFinalSize(fs.root)
+	calculateFinalTimes(fs.root)
 	logs.Info("Data Gateway database completed")
 }
 
@@ -371,6 +673,35 @@ var removeInvalidChars = func(str string) string {
 	return r.Replace(str)
 }
 
+// SafeName returns 'name' without the characters that may interfere with filesystem structure
+func SafeName(name string) string {
+	return removeInvalidChars(name)
+}
+
+// ProjectName returns the name under which project or dataset 'name' is shown in the filesystem
+func ProjectName(name string) string {
+	// This is mainly here because of SD Submit
+	if u, err := url.ParseRequestURI(name); err == nil {
+		name = strings.TrimLeft(strings.TrimPrefix(name, u.Scheme), ":/")
+	}
+
+	return removeInvalidChars(name)
+}
+
+// calculateSizes recalculates the sizes of all directories from their children.
+// Size of a lazy container whose contents are not known is left as it is.
+func calculateSizes(n *node) int64 {
+	if !isDir(n) || (n.lazy != nil && len(n.chld) == 0) {
+		return n.stat.Size
+	}
+	n.stat.Size = 0
+	for _, chld := range n.chld {
+		n.stat.Size += calculateSizes(chld)
+	}
+
+	return n.stat.Size
+}
+
 func calculateFinalSize(n *node) int64 {
 	if n.stat.Size != -1 {
 		return n.stat.Size
@@ -383,6 +714,29 @@ func calculateFinalSize(n *node) int64 {
 	return n.stat.Size
 }
 
+// calculateFinalTimes sets the timestamps of directories according to their children,
+// so that a directory is as new as its newest file and as old as its oldest file
+func calculateFinalTimes(n *node) {
+	first := true
+	for _, chld := range n.chld {
+		calculateFinalTimes(chld)
+		if first || isLater(chld.stat.Mtim, n.stat.Mtim) {
+			n.stat.Mtim = chld.stat.Mtim
+		}
+		if first || isLater(chld.stat.Ctim, n.stat.Ctim) {
+			n.stat.Ctim = chld.stat.Ctim
+		}
+		if first || isLater(n.stat.Birthtim, chld.stat.Birthtim) {
+			n.stat.Birthtim = chld.stat.Birthtim
+		}
+		first = false
+	}
+}
+
+func isLater(a, b fuse.Timespec) bool {
+	return a.Sec > b.Sec || (a.Sec == b.Sec && a.Nsec > b.Nsec)
+}
+
 var createObjects = func(_ int, jobs <-chan containerInfo, wg *sync.WaitGroup, send func(string, string, int)) {
 	defer wg.Done()
 	defer CheckPanic()
@@ -392,6 +746,10 @@ var createObjects = func(_ int, jobs <-chan containerInfo, wg *sync.WaitGroup, s
 		fs := j.fs
 		timestamp := j.timestamp
 
+		if j.ctx.Err() != nil {
+			continue
+		}
+
 		logs.Debugf("Fetching data for %s", filepath.FromSlash(containerPath))
 
 		c := fs.getNode(containerPath, ^uint64(0))
@@ -401,7 +759,7 @@ var createObjects = func(_ int, jobs <-chan containerInfo, wg *sync.WaitGroup, s
 			continue
 		}
 
-		objects, err := api.GetNthLevel(c.path[0], containerPath, c.path[1:]...)
+		objects, err := api.GetNthLevel(j.ctx, c.path[0], containerPath, c.path[1:]...)
 		if err != nil {
 			logs.Error(err)
 
@@ -417,7 +775,16 @@ var createObjects = func(_ int, jobs <-chan containerInfo, wg *sync.WaitGroup, s
 	}
 }
 
+// createLevel creates the files and directories formed by 'objects' under directory 'prnt' in 'prntPath' recursively
 func (fs *Fuse) createLevel(prnt *node, objects []api.Metadata, prntPath string, tmsp fuse.Timespec) {
+	for name, children := range fs.createNodes(prnt, objects, prntPath, tmsp) {
+		fs.createLevel(prnt.chld[name], children, prntPath+"/"+name, tmsp)
+	}
+}
+
+// createNodes creates the files and directories formed by 'objects' directly under directory 'prnt' in 'prntPath'.
+// Returns the objects under each created directory by the name of the directory, with names relative to it.
+func (fs *Fuse) createNodes(prnt *node, objects []api.Metadata, prntPath string, tmsp fuse.Timespec) map[string][]api.Metadata {
 	dirSize := make(map[string]int64)
 	dirChildren := make(map[string][]api.Metadata)
 
@@ -441,18 +808,148 @@ func (fs *Fuse) createLevel(prnt *node, objects []api.Metadata, prntPath string,
 		}
 
 		dirSize[parts[0]] += obj.Bytes
-		dirChildren[parts[0]] = append(dirChildren[parts[0]], api.Metadata{Name: parts[1], Bytes: obj.Bytes})
+		obj.Name = parts[1]
+		dirChildren[parts[0]] = append(dirChildren[parts[0]], obj)
 	}
 
 	// Create all unique subdirectories at this level
+	created := make(map[string][]api.Metadata, len(dirSize))
 	for key, value := range dirSize {
 		md := api.Metadata{Bytes: value, Name: key}
 		dirSafe := removeInvalidChars(key)
 		p := prntPath + "/" + dirSafe
 		logs.Debugf("Creating directory %s", filepath.FromSlash(p))
-		n, dirSafe := fs.makeNode(prnt, md, p, fuse.S_IFDIR|sRDONLY, tmsp)
-		fs.createLevel(n, dirChildren[key], prntPath+"/"+dirSafe, tmsp)
+		_, dirSafe = fs.makeNode(prnt, md, p, fuse.S_IFDIR|sRDONLY, tmsp)
+		created[dirSafe] = dirChildren[key]
+	}
+
+	return created
+}
+
+// Entry is a file or directory directly under a directory of the filesystem
+type Entry struct {
+	Name         string // name shown in the filesystem
+	OriginalName string
+	Dir          bool
+	Size         int64
+	Modified     time.Time         // zero if unknown
+	Attributes   map[string]string // attributes of a file
+	Objects      []api.Metadata    // objects under a directory, with names relative to it
+}
+
+// ListObjects returns the files and directories formed by 'objects' directly under directory 'prntPath',
+// named the same way as in the filesystem. Directories are as new as their newest object.
+func ListObjects(prntPath string, objects []api.Metadata) []Entry {
+	fs := &Fuse{}
+	prnt := newNode(0, fuse.S_IFDIR|sRDONLY, 0, 0, fuse.Timespec{})
+	dirs := fs.createNodes(prnt, objects, prntPath, fuse.Timespec{})
+
+	entries := make([]Entry, 0, len(prnt.chld))
+	for name, n := range prnt.chld {
+		e := Entry{Name: name, OriginalName: n.originalName, Dir: isDir(n), Size: n.stat.Size, Modified: n.modified}
+		if e.Dir {
+			e.Objects = dirs[name]
+			for _, obj := range e.Objects {
+				if obj.LastModified.After(e.Modified) {
+					e.Modified = obj.LastModified
+				}
+			}
+		} else {
+			e.Attributes = n.xattrs
+		}
+		entries = append(entries, e)
+	}
+
+	return entries
+}
+
+// DirectoryNames returns the names under which directories 'dirs' are shown in directory 'prntPath',
+// in the same order. 'safeName' removes the characters that cannot be used in the names.
+func DirectoryNames(prntPath string, dirs []api.Metadata, safeName func(string) string) []string {
+	fs := &Fuse{}
+	prnt := newNode(0, fuse.S_IFDIR|sRDONLY, 0, 0, fuse.Timespec{})
+	names := make([]string, len(dirs))
+	for i, dir := range dirs {
+		_, names[i] = fs.makeNode(prnt, dir, prntPath+"/"+safeName(dir.Name), fuse.S_IFDIR|sRDONLY, fuse.Timespec{})
 	}
+
+	return names
+}
+
+// listContainer lists the contents of the lazy container on 'path' if they have not been listed yet
+// or if the listing has expired. The container at the end of 'path' is listed only if 'self' is true.
+func (fs *Fuse) listContainer(path string, self bool) {
+	if !lazy {
+		return
+	}
+
+	fs.lock.RLock()
+	c, containerPath := fs.findUnlisted(path, self)
+	fs.lock.RUnlock()
+	if c.node == nil {
+		return
+	}
+
+	c.node.lazy.lock.Lock()
+	defer c.node.lazy.lock.Unlock()
+
+	// Another call may have listed the container while waiting
+	fs.lock.RLock()
+	expired := listingExpired(c.node)
+	fs.lock.RUnlock()
+	if !expired {
+		return
+	}
+
+	// Filesystem is not locked during the request so that other operations do not need to wait for it
+	logs.Debugf("Fetching data for %s", filepath.FromSlash(containerPath))
+	objects, err := api.GetNthLevel(fs.ctx, c.path[0], containerPath, c.path[1:]...)
+	if err != nil {
+		logs.Error(err)
+
+		return
+	}
+
+	timestamp := fuse.Now()
+	tmp := newNode(0, fuse.S_IFDIR|sRDONLY, 0, 0, c.node.stat.Mtim)
+	tmp.stat.Size = -1
+	fs.createLevel(tmp, objects, containerPath, timestamp)
+	calculateFinalSize(tmp)
+	calculateFinalTimes(tmp)
+
+	defer fs.synchronize()()
+	fs.mergeNode(c.node, tmp, c.path, false, &RefreshSummary{})
+
+	// Unchanged files keep the real sizes they may already have, so the size is calculated from the merged contents
+	fs.resize(c.node, containerPath, timestamp)
+	if len(tmp.chld) > 0 {
+		c.node.stat.Mtim, c.node.stat.Ctim, c.node.stat.Birthtim = tmp.stat.Mtim, tmp.stat.Ctim, tmp.stat.Birthtim
+	}
+	c.node.lazy.listed = time.Now()
+}
+
+// findUnlisted returns the lazy container on 'path' whose contents need to be listed, and the path to the container.
+// Caller must hold fs.lock.
+func (fs *Fuse) findUnlisted(path string, self bool) (nodeAndPath, string) {
+	n := nodeAndPath{node: fs.root}
+	parts := slices.DeleteFunc(split(path), func(part string) bool { return part == "" })
+	for i := range parts {
+		n.node = n.node.chld[parts[i]]
+		if n.node == nil {
+			break
+		}
+		n.path = append(n.path, n.node.originalName)
+		if n.node.lazy != nil && (self || i < len(parts)-1) && listingExpired(n.node) {
+			return n, strings.Join(parts[:i+1], "/")
+		}
+	}
+
+	return nodeAndPath{}, ""
+}
+
+// listingExpired tells whether the contents of a lazy container need to be listed
+func listingExpired(n *node) bool {
+	return n.lazy.listed.IsZero() || (listingTTL > 0 && time.Since(n.lazy.listed) > listingTTL)
 }
 
 // split deconstructs a filepath string into an array of strings
@@ -463,7 +960,7 @@ func split(path string) []string {
 // newNode initializes a node struct
 var newNode = func(ino uint64, mode uint32, uid uint32, gid uint32, tmsp fuse.Timespec) *node {
 	self := node{
-		fuse.Stat_t{
+		stat: fuse.Stat_t{
 			Dev:      0,
 			Ino:      ino,
 			Mode:     mode,
@@ -476,11 +973,7 @@ var newNode = func(ino uint64, mode uint32, uid uint32, gid uint32, tmsp fuse.Ti
 			Birthtim: tmsp,
 			Flags:    0,
 		},
-		nil,
-		0,
-		"",
-		false,
-		false}
+	}
 	// Initialize map of children if node is a directory
 	if fuse.S_IFDIR == self.stat.Mode&fuse.S_IFMT {
 		self.chld = map[string]*node{}
@@ -548,14 +1041,47 @@ func (fs *Fuse) makeNode(prnt *node, meta api.Metadata, nodePath string, mode ui
 	fs.inoLock.Unlock()
 
 	n.stat.Size = meta.Bytes
+	n.listedSize = meta.Bytes
 	n.originalName = meta.Name
+	n.xattrs = meta.Attributes
+	n.modified = meta.LastModified
+	if !meta.LastModified.IsZero() {
+		n.stat.Mtim = fuse.NewTimespec(meta.LastModified)
+		n.stat.Ctim = n.stat.Mtim
+		n.stat.Birthtim = n.stat.Mtim
+	}
+	if !meta.Created.IsZero() {
+		n.stat.Birthtim = fuse.NewTimespec(meta.Created)
+	}
 	prnt.chld[name] = n
-	prnt.stat.Ctim = n.stat.Ctim
-	prnt.stat.Mtim = n.stat.Ctim
 
 	return n, name
 }
 
+// xattrs returns the extended attributes of a node without the namespace prefix. Caller must hold fs.lock.
+func xattrs(n nodeAndPath) map[string]string {
+	attrs := maps.Clone(n.node.xattrs)
+	if attrs == nil {
+		attrs = make(map[string]string)
+	}
+	if len(n.path) == 0 {
+		return attrs
+	}
+
+	attrs["repository"] = n.path[0]
+	attrs["original_name"] = n.node.originalName
+	if hasDecryptionStatus(n) && n.node.decryptionChecked && !n.node.denied {
+		attrs["decrypted"] = strconv.FormatBool(n.node.decrypted)
+	}
+
+	return attrs
+}
+
+// hasDecryptionStatus tells whether the node is an object which API may decrypt automatically
+func hasDecryptionStatus(n nodeAndPath) bool {
+	return len(n.path) > 0 && n.path[0] == api.SDConnect && n.node.stat.Mode&fuse.S_IFMT == fuse.S_IFREG
+}
+
 // lookupNode finds the node at the end of path
 var lookupNode = func(root *node, path string) (node *node, origPath []string) {
 	node = root
@@ -592,6 +1118,18 @@ func (fs *Fuse) updateNodeSizesAlongPath(path string, diff int64, timestamp fuse
 	}
 }
 
+// resize calculates the size of directory 'n' on 'path' from its children and updates the sizes of its ancestors.
+// Caller must hold fs.lock.
+func (fs *Fuse) resize(n *node, path string, timestamp fuse.Timespec) {
+	var size int64
+	for _, chld := range n.chld {
+		size += calculateSizes(chld)
+	}
+	if diff := size - n.stat.Size; diff != 0 {
+		fs.updateNodeSizesAlongPath(path, diff, timestamp)
+	}
+}
+
 func (fs *Fuse) openNode(path string, dir bool) (int, uint64) {
 	n, origPath := lookupNode(fs.root, path)
 	if n == nil {
@@ -604,11 +1142,16 @@ func (fs *Fuse) openNode(path string, dir bool) (int, uint64) {
 		return -fuse.ENOTDIR, ^uint64(0)
 	}
 	n.opencnt++
-	if n.opencnt == 1 {
-		fs.openmap[n.stat.Ino] = nodeAndPath{node: n, path: origPath}
+
+	// Every open gets its own handle so that reads through different handles are tracked separately
+	fs.fh++
+	if fs.fh == ^uint64(0) {
+		fs.fh = 0
 	}
+	ctx, cancel := context.WithCancel(fs.ctx)
+	fs.openmap[fs.fh] = nodeAndPath{node: n, path: origPath, reads: &readState{ctx: ctx, cancel: cancel}}
 
-	return 0, n.stat.Ino
+	return 0, fs.fh
 }
 
 func (fs *Fuse) closeNode(fh uint64) int {
@@ -616,10 +1159,11 @@ func (fs *Fuse) closeNode(fh uint64) int {
 	if node == nil {
 		return -fuse.ENOENT
 	}
-	node.opencnt--
-	if node.opencnt == 0 {
-		delete(fs.openmap, node.stat.Ino)
+	if st := fs.openmap[fh].reads; st != nil && st.cancel != nil {
+		st.cancel()
 	}
+	node.opencnt--
+	delete(fs.openmap, fh)
 
 	return 0
 }
@@ -635,6 +1179,7 @@ func (fs *Fuse) getNode(path string, fh uint64) nodeAndPath {
 }
 
 func (fs *Fuse) GetNodeChildren(path string) []string {
+	defer fs.synchronizeRead()()
 	n := fs.getNode(path, ^uint64(0))
 	if n.node == nil {
 		return nil
@@ -651,6 +1196,7 @@ func (fs *Fuse) GetNodeChildren(path string) []string {
 	return chld
 }
 
+// synchronize locks the filesystem for modification
 func (fs *Fuse) synchronize() func() {
 	fs.lock.Lock()
 
@@ -658,3 +1204,12 @@ func (fs *Fuse) synchronize() func() {
 		fs.lock.Unlock()
 	}
 }
+
+// synchronizeRead locks the filesystem for reading, other readers may hold the lock at the same time
+func (fs *Fuse) synchronizeRead() func() {
+	fs.lock.RLock()
+
+	return func() {
+		fs.lock.RUnlock()
+	}
+}
@@ -1,6 +1,7 @@
 package filesystem
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -239,11 +241,13 @@ func getTestFuse(t *testing.T, sizeUnfinished bool, maxLevel int) (fs *Fuse) {
 	}
 
 	fs = &Fuse{}
+	fs.ctx, fs.cancel = context.WithCancel(context.Background())
+	t.Cleanup(fs.cancel)
 	fs.root = &node{}
 	fs.root.stat.Mode = fuse.S_IFDIR | sRDONLY
 	fs.root.chld = map[string]*node{}
 	fs.root.stat.Ino = 1
-	fs.openmap = map[uint64]nodeAndPath{1: {fs.root, []string{"path"}}}
+	fs.openmap = map[uint64]nodeAndPath{1: {node: fs.root, path: []string{"path"}}}
 
 	switch {
 	case sizeUnfinished && nodes.Size < 0:
@@ -282,6 +286,7 @@ func assignChildren(n *node, template *[]jsonNode, sizeUnfinished bool, maxLevel
 			}
 		} else {
 			n.chld[child.NameSafe].stat.Mode = fuse.S_IFREG | sRDONLY
+			n.chld[child.NameSafe].listedSize = n.chld[child.NameSafe].stat.Size
 		}
 
 		ino++
@@ -380,7 +385,7 @@ func TestInitializeFilesystem(t *testing.T) {
 	api.GetEnabledRepositories = func() []string {
 		return []string{rep1, rep2}
 	}
-	api.GetNthLevel = func(rep, fsPath string, nodes ...string) ([]api.Metadata, error) {
+	api.GetNthLevel = func(ctx context.Context, rep, fsPath string, nodes ...string) ([]api.Metadata, error) {
 		if len(nodes) > 0 {
 			return nil, fmt.Errorf("Third parameter of api.GetNthLevel() should have been empty, received %v", nodes)
 		}
@@ -396,7 +401,7 @@ func TestInitializeFilesystem(t *testing.T) {
 		return strings.ReplaceAll(str, "+", "_")
 	}
 
-	ret := InitializeFilesystem(nil)
+	ret := InitializeFilesystem(context.Background(), nil)
 	if ret == nil || ret.root == nil {
 		t.Fatal("Filesystem or root is nil")
 	}
@@ -406,32 +411,300 @@ func TestInitializeFilesystem(t *testing.T) {
 }
 
 func TestRefreshFilesystem(t *testing.T) {
-	fs := getTestFuse(t, false, 1)
+	fs := getTestFuse(t, false, 5)
 	newFs := getTestFuse(t, false, 5)
+	fs.ino = maxIno(fs.root)
+	root, openmap := fs.root, fs.openmap
+
+	kansio := newFs.root.chld[rep1].chld["child_1"].chld["kansio"]
+	kansio.chld["file_1"].stat.Size += 10
+	kansio.chld["file_1"].listedSize += 10
+	delete(kansio.chld, "file_2")
+	newFs.root.chld[rep1].chld["child_2"].chld["dir"].chld["new_file"] = &node{
+		stat:         fuse.Stat_t{Mode: fuse.S_IFREG | sRDONLY, Size: 7},
+		originalName: "new_file",
+	}
+	calculateSizes(newFs.root)
+
+	unchanged := fs.root.chld[rep1].chld["child_1"].chld["kansio"].chld["file_3"]
+	unchangedIno := unchanged.stat.Ino
+	changed := fs.root.chld[rep1].chld["child_1"].chld["kansio"].chld["file_1"]
+	changed.decryptionChecked = true
 
 	origClearCache := api.ClearCache
+	origDeleteFileFromCache := api.DeleteFileFromCache
 	origInitializeFilesystem := InitializeFilesystem
+	origNthLevel := api.GetNthLevel
+	origCreateObjects := createObjects
 
 	defer func() {
 		api.ClearCache = origClearCache
+		api.DeleteFileFromCache = origDeleteFileFromCache
+		InitializeFilesystem = origInitializeFilesystem
+		api.GetNthLevel = origNthLevel
+		createObjects = origCreateObjects
+	}()
+
+	api.ClearCache = func() {
+		t.Error("Cache should not have been cleared")
+	}
+	var deleted []string
+	api.DeleteFileFromCache = func(nodes []string, _ int64) {
+		deleted = append(deleted, strings.Join(nodes, "/"))
+	}
+	InitializeFilesystem = func(ctx context.Context, send func(Project)) *Fuse {
+		return newFs
+	}
+	api.GetNthLevel = func(_ context.Context, _, _ string, _ ...string) ([]api.Metadata, error) {
+		return nil, errExpected
+	}
+	createObjects = func(_ int, jobs <-chan containerInfo, wg *sync.WaitGroup, _ func(string, string, int)) {
+		defer wg.Done()
+		for range jobs {
+		}
+	}
+
+	summary := fs.RefreshFilesystem(nil, nil)
+
+	if expected := (RefreshSummary{Added: 1, Removed: 1, Changed: 1}); summary != expected {
+		t.Errorf("Incorrect summary. Expected=%+v, received=%+v", expected, summary)
+	}
+	if fs.root != root {
+		t.Errorf("Root should not have been replaced")
+	}
+	if reflect.ValueOf(fs.openmap).Pointer() != reflect.ValueOf(openmap).Pointer() {
+		t.Errorf("Openmap should not have been replaced")
+	}
+	if err := isSameFuse(newFs.root, fs.root, "/"); err != nil {
+		t.Errorf("Filesystem was not updated correctly: %s", err.Error())
+	}
+
+	kansio = fs.root.chld[rep1].chld["child_1"].chld["kansio"]
+	if kansio.chld["file_3"] != unchanged || unchanged.stat.Ino != unchangedIno {
+		t.Errorf("Unchanged file should have kept its node and inode number")
+	}
+	if kansio.chld["file_1"] != changed {
+		t.Errorf("Changed file should have kept its node")
+	}
+	if changed.decryptionChecked {
+		t.Errorf("Decryption status of changed file should have been reset")
+	}
+	added := fs.root.chld[rep1].chld["child_2"].chld["dir"].chld["new_file"]
+	if added == nil || added.stat.Ino != fs.ino || added.stat.Ino <= unchangedIno {
+		t.Errorf("Added file should have received a new inode number")
+	}
+
+	sort.Strings(deleted)
+	expectedDeleted := []string{rep1 + "/child+1/kansio/file_1", rep1 + "/child+1/kansio/file_2"}
+	if !reflect.DeepEqual(deleted, expectedDeleted) {
+		t.Errorf("Incorrect files evicted from cache\nExpected=%v\nReceived=%v", expectedDeleted, deleted)
+	}
+}
+
+func TestRefreshFilesystem_Cancelled(t *testing.T) {
+	fs := getTestFuse(t, false, 5)
+	newFs := getTestFuse(t, false, 5)
+	delete(newFs.root.chld, rep1)
+
+	origInitializeFilesystem := InitializeFilesystem
+	origCreateObjects := createObjects
+	defer func() {
 		InitializeFilesystem = origInitializeFilesystem
+		createObjects = origCreateObjects
 	}()
 
-	api.ClearCache = func() {}
-	InitializeFilesystem = func(send func(Project)) *Fuse {
+	InitializeFilesystem = func(ctx context.Context, send func(Project)) *Fuse {
 		return newFs
 	}
+	createObjects = func(_ int, jobs <-chan containerInfo, wg *sync.WaitGroup, _ func(string, string, int)) {
+		defer wg.Done()
+		for range jobs {
+		}
+	}
 
+	fs.cancel()
 	fs.RefreshFilesystem(nil, nil)
 
-	if fs.ino != newFs.ino {
-		t.Errorf("Ino was not correct. Expected=%d, received=%d", newFs.ino, fs.ino)
+	if _, ok := fs.root.chld[rep1]; !ok {
+		t.Errorf("Filesystem should not have been updated after cancellation")
 	}
-	if fs.root != newFs.root {
-		t.Errorf("Root was not correct\nExpected=%v\nReceived=%v", *newFs.root, *fs.root)
+}
+
+func TestRefreshProjects(t *testing.T) {
+	fs := getTestFuse(t, false, 5)
+	newFs := getTestFuse(t, false, 5)
+	fs.ino = maxIno(fs.root)
+
+	kansio := newFs.root.chld[rep1].chld["child_1"].chld["kansio"]
+	kansio.chld["file_1"].stat.Size += 10
+	kansio.chld["file_1"].listedSize += 10
+	removed := countFiles(newFs.root.chld[rep1].chld["child_2"])
+	delete(newFs.root.chld[rep1].chld, "child_2")
+	newFs.root.chld[rep1].chld["child_3"] = &node{
+		stat:         fuse.Stat_t{Mode: fuse.S_IFDIR | sRDONLY},
+		originalName: "child_3",
+		chld: map[string]*node{"new_file": {
+			stat:         fuse.Stat_t{Mode: fuse.S_IFREG | sRDONLY, Size: 7},
+			originalName: "new_file",
+		}},
 	}
-	if reflect.ValueOf(fs.openmap).Pointer() != reflect.ValueOf(newFs.openmap).Pointer() {
-		t.Errorf("Openmap was not correct\nExpected=%v\nReceived=%v", newFs.openmap, fs.openmap)
+	calculateSizes(newFs.root)
+
+	project := fs.root.chld[rep1].chld["child_1"]
+	changed := project.chld["kansio"].chld["file_1"]
+
+	origDeleteFileFromCache := api.DeleteFileFromCache
+	origInitializeFilesystem := InitializeFilesystem
+	origNthLevel := api.GetNthLevel
+	origCreateObjects := createObjects
+	defer func() {
+		api.DeleteFileFromCache = origDeleteFileFromCache
+		InitializeFilesystem = origInitializeFilesystem
+		api.GetNthLevel = origNthLevel
+		createObjects = origCreateObjects
+	}()
+
+	api.DeleteFileFromCache = func(_ []string, _ int64) {}
+	InitializeFilesystem = func(ctx context.Context, send func(Project)) *Fuse {
+		return newFs
+	}
+	api.GetNthLevel = func(_ context.Context, _, _ string, _ ...string) ([]api.Metadata, error) {
+		return nil, errExpected
+	}
+	createObjects = func(_ int, jobs <-chan containerInfo, wg *sync.WaitGroup, _ func(string, string, int)) {
+		defer wg.Done()
+		for range jobs {
+		}
+	}
+
+	summary := fs.refreshProjects(nil)
+
+	if expected := (RefreshSummary{Added: 1, Removed: removed, Changed: 1}); summary != expected {
+		t.Errorf("Incorrect summary. Expected=%+v, received=%+v", expected, summary)
+	}
+	if err := isSameFuse(newFs.root, fs.root, "/"); err != nil {
+		t.Errorf("Filesystem was not updated correctly: %s", err.Error())
+	}
+	if fs.root.chld[rep1].chld["child_1"] != project || project.chld["kansio"].chld["file_1"] != changed {
+		t.Errorf("Existing project and its files should have kept their nodes")
+	}
+	if changed.stat.Size != kansio.chld["file_1"].stat.Size {
+		t.Errorf("Changed file has incorrect size %d", changed.stat.Size)
+	}
+}
+
+func TestAutoRefresh(t *testing.T) {
+	fs := getTestFuse(t, false, 5)
+	fs.ino = maxIno(fs.root)
+
+	origInitializeFilesystem := InitializeFilesystem
+	origCreateObjects := createObjects
+	origNthLevel := api.GetNthLevel
+	origRefreshDelay := refreshDelay
+	origDeleteFileFromCache := api.DeleteFileFromCache
+	defer func() {
+		api.DeleteFileFromCache = origDeleteFileFromCache
+		InitializeFilesystem = origInitializeFilesystem
+		createObjects = origCreateObjects
+		api.GetNthLevel = origNthLevel
+		refreshDelay = origRefreshDelay
+	}()
+
+	var refreshes atomic.Int32
+	api.DeleteFileFromCache = func(_ []string, _ int64) {}
+	InitializeFilesystem = func(ctx context.Context, send func(Project)) *Fuse {
+		newFs := getTestFuse(t, false, 5)
+		name := fmt.Sprintf("file_%d", refreshes.Add(1))
+		newFs.root.chld[rep1].chld["child_2"].chld["dir"].chld[name] = &node{
+			stat:         fuse.Stat_t{Mode: fuse.S_IFREG | sRDONLY, Size: 1},
+			originalName: name,
+		}
+
+		return newFs
+	}
+	api.GetNthLevel = func(_ context.Context, _, _ string, _ ...string) ([]api.Metadata, error) {
+		return nil, errExpected
+	}
+	createObjects = func(_ int, jobs <-chan containerInfo, wg *sync.WaitGroup, _ func(string, string, int)) {
+		defer wg.Done()
+		for range jobs {
+		}
+	}
+	var delays []time.Duration
+	refreshDelay = func(interval time.Duration) time.Duration {
+		delays = append(delays, interval)
+
+		return time.Millisecond
+	}
+
+	summaries := make(chan RefreshSummary)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fs.AutoRefresh(time.Hour, nil, func(s RefreshSummary) { summaries <- s })
+	}()
+
+	// Each refresh replaces the file added in the previous one
+	expected := []RefreshSummary{{Added: 1}, {Added: 1, Removed: 1}}
+	for i := range expected {
+		select {
+		case s := <-summaries:
+			if s != expected[i] {
+				t.Errorf("Incorrect summary for refresh %d. Expected=%+v, received=%+v", i+1, expected[i], s)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Filesystem was not refreshed")
+		}
+	}
+
+	fs.cancel()
+	select {
+	case <-summaries:
+	case <-done:
+	}
+	<-done
+
+	for _, d := range delays {
+		if d != time.Hour {
+			t.Errorf("Incorrect refresh interval. Expected=%v, received=%v", time.Hour, d)
+		}
+	}
+}
+
+func TestRefreshDelay(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if d := refreshDelay(time.Hour); d < 48*time.Minute || d > 72*time.Minute {
+			t.Fatalf("Refresh delay %v not within 20 percent of %v", d, time.Hour)
+		}
+	}
+	if d := refreshDelay(0); d != 0 {
+		t.Errorf("Refresh delay should be zero for zero interval, received %v", d)
+	}
+}
+
+// maxIno returns the largest inode number in the tree under 'n'
+func maxIno(n *node) uint64 {
+	ino := n.stat.Ino
+	for _, chld := range n.chld {
+		ino = max(ino, maxIno(chld))
+	}
+
+	return ino
+}
+
+func TestOpenFiles(t *testing.T) {
+	fs := getTestFuse(t, false, 5)
+	kansio := fs.root.chld[rep1].chld["child_1"].chld["kansio"]
+	fs.openmap[kansio.stat.Ino] = nodeAndPath{node: kansio, path: []string{rep1, "child+1", "kansio"}}
+	for _, name := range []string{"file_3", "file_1"} {
+		fs.openmap[kansio.chld[name].stat.Ino] = nodeAndPath{
+			node: kansio.chld[name], path: []string{rep1, "child+1", "kansio", name},
+		}
+	}
+
+	expected := []string{rep1 + "/child+1/kansio/file_1", rep1 + "/child+1/kansio/file_3"}
+	if files := fs.OpenFiles(); !reflect.DeepEqual(files, expected) {
+		t.Errorf("Incorrect open files\nExpected=%v\nReceived=%v", expected, files)
 	}
 }
 
@@ -442,7 +715,7 @@ func TestClearPath_Fail(t *testing.T) {
 
 	origNthLevel := api.GetNthLevel
 	defer func() { api.GetNthLevel = origNthLevel }()
-	api.GetNthLevel = func(rep, fsPath string, nodes ...string) ([]api.Metadata, error) {
+	api.GetNthLevel = func(ctx context.Context, rep, fsPath string, nodes ...string) ([]api.Metadata, error) {
 		return nil, errExpected
 	}
 
@@ -496,7 +769,7 @@ func TestClearPath_Connect(t *testing.T) {
 	api.DeleteFileFromCache = func(nodes []string, size int64) {
 		delete(traverse, strings.Join(nodes, "/"))
 	}
-	api.GetNthLevel = func(rep, fsPath string, nodes ...string) ([]api.Metadata, error) {
+	api.GetNthLevel = func(ctx context.Context, rep, fsPath string, nodes ...string) ([]api.Metadata, error) {
 		return []api.Metadata{{Bytes: 45, Name: "file_1"}, {Bytes: 6, Name: "file_2"}, {Bytes: 142, Name: "file_3"}}, nil
 	}
 
@@ -549,7 +822,7 @@ func TestPopulateFilesystem(t *testing.T) {
 		return n
 	}
 	CheckPanic = func() {}
-	api.GetNthLevel = func(rep, fsPath string, nodes ...string) ([]api.Metadata, error) {
+	api.GetNthLevel = func(ctx context.Context, rep, fsPath string, nodes ...string) ([]api.Metadata, error) {
 		if len(nodes) != 1 {
 			return nil, fmt.Errorf("Third parameter of api.GetNthLevel() should have had length 1, received %v that has length %d", nodes, len(nodes))
 		}
@@ -623,12 +896,160 @@ func TestPopulateFilesystem(t *testing.T) {
 		}
 	}
 
-	fs.PopulateFilesystem(nil)
+	fs.PopulateFilesystem(context.Background(), nil)
 	if err := isSameFuse(origFs.root, fs.root, "/"); err != nil {
 		t.Fatalf("FUSE was not created correctly: %s", err.Error())
 	}
 }
 
+// getLazyTestFuse creates a filesystem with one project that has container "bucket" whose contents are not listed
+func getLazyTestFuse(t *testing.T) *Fuse {
+	fs := &Fuse{openmap: map[uint64]nodeAndPath{}}
+	fs.ctx, fs.cancel = context.WithCancel(context.Background())
+	t.Cleanup(fs.cancel)
+
+	timestamp := fuse.Now()
+	fs.root = newNode(1, fuse.S_IFDIR|sRDONLY, 0, 0, timestamp)
+	fs.root.stat.Size = -1
+	fs.ino = 1
+	rep, _ := fs.makeNode(fs.root, api.Metadata{Name: rep1, Bytes: -1}, rep1, fuse.S_IFDIR|sRDONLY, timestamp)
+	pr, _ := fs.makeNode(rep, api.Metadata{Name: "project", Bytes: -1}, rep1+"/project", fuse.S_IFDIR|sRDONLY, timestamp)
+	bucket, _ := fs.makeNode(pr, api.Metadata{Name: "bucket", Bytes: 10}, rep1+"/project/bucket", fuse.S_IFDIR|sRDONLY, timestamp)
+	bucket.lazy = &listing{}
+	calculateFinalSize(fs.root)
+
+	return fs
+}
+
+func TestPopulateFilesystem_Lazy(t *testing.T) {
+	origLazy := lazy
+	origNthLevel := api.GetNthLevel
+	origCreateObjects := createObjects
+	defer func() {
+		lazy = origLazy
+		api.GetNthLevel = origNthLevel
+		createObjects = origCreateObjects
+	}()
+
+	lazy = true
+	fs := getLazyTestFuse(t)
+	delete(fs.root.chld[rep1].chld["project"].chld, "bucket")
+	fs.root.stat.Size, fs.root.chld[rep1].stat.Size, fs.root.chld[rep1].chld["project"].stat.Size = -1, -1, -1
+
+	api.GetNthLevel = func(_ context.Context, _, _ string, nodes ...string) ([]api.Metadata, error) {
+		if len(nodes) != 1 {
+			return nil, fmt.Errorf("Objects of container %v should not have been requested", nodes)
+		}
+
+		return []api.Metadata{{Bytes: 10, Name: "bucket1"}, {Bytes: 5, Name: "bucket2"}}, nil
+	}
+	createObjects = func(_ int, jobs <-chan containerInfo, wg *sync.WaitGroup, _ func(string, string, int)) {
+		defer wg.Done()
+		for j := range jobs {
+			t.Errorf("Container %s should not have been populated", j.containerPath)
+		}
+	}
+
+	fs.PopulateFilesystem(context.Background(), nil)
+
+	pr := fs.root.chld[rep1].chld["project"]
+	for _, name := range []string{"bucket1", "bucket2"} {
+		switch {
+		case pr.chld[name] == nil:
+			t.Errorf("Container %s was not created", name)
+		case pr.chld[name].lazy == nil:
+			t.Errorf("Container %s should be listed lazily", name)
+		}
+	}
+	if fs.root.stat.Size != 15 {
+		t.Errorf("Incorrect filesystem size. Expected=15, received=%d", fs.root.stat.Size)
+	}
+}
+
+func TestListContainer(t *testing.T) {
+	origLazy, origTTL := lazy, listingTTL
+	origNthLevel := api.GetNthLevel
+	defer func() {
+		lazy, listingTTL = origLazy, origTTL
+		api.GetNthLevel = origNthLevel
+	}()
+
+	lazy, listingTTL = true, time.Hour
+	fs := getLazyTestFuse(t)
+	bucket := fs.root.chld[rep1].chld["project"].chld["bucket"]
+
+	var calls atomic.Int32
+	api.GetNthLevel = func(_ context.Context, rep, _ string, nodes ...string) ([]api.Metadata, error) {
+		if rep != rep1 || !reflect.DeepEqual(nodes, []string{"project", "bucket"}) {
+			return nil, fmt.Errorf("api.GetNthLevel() received incorrect path %s/%v", rep, nodes)
+		}
+		calls.Add(1)
+
+		return []api.Metadata{{Bytes: 4, Name: "dir/a"}, {Bytes: 8, Name: "b"}}, nil
+	}
+
+	var stat fuse.Stat_t
+	if errc := fs.Getattr(rep1+"/project/bucket", &stat, ^uint64(0)); errc != 0 || calls.Load() != 0 {
+		t.Fatalf("Getattr of container should not list it, received errc=%d and %d requests", errc, calls.Load())
+	}
+
+	if errc := fs.Getattr(rep1+"/project/bucket/dir/a", &stat, ^uint64(0)); errc != 0 {
+		t.Fatalf("Getattr of listed file returned %d", errc)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Container should have been listed once, was listed %d times", calls.Load())
+	}
+	if stat.Size != 4 {
+		t.Errorf("Incorrect file size. Expected=4, received=%d", stat.Size)
+	}
+	if pr := fs.root.chld[rep1].chld["project"]; pr.stat.Size != 12 || bucket.stat.Size != 12 {
+		t.Errorf("Sizes were not updated. Expected=12, received %d and %d", pr.stat.Size, bucket.stat.Size)
+	}
+
+	// Listing is reused until it expires
+	fs.Readdir(rep1+"/project/bucket", func(string, *fuse.Stat_t, int64) bool { return true }, 0, ^uint64(0))
+	if calls.Load() != 1 {
+		t.Errorf("Container should not have been listed again before listing expired")
+	}
+
+	// File whose real size is known keeps it when the container is listed again
+	b := bucket.chld["b"]
+	b.decryptionChecked = true
+	fs.updateNodeSizesAlongPath(rep1+"/project/bucket/b", -2, fuse.Now())
+	bucket.lazy.listed = time.Now().Add(-2 * time.Hour)
+	if errc, _ := fs.Opendir(rep1 + "/project/bucket"); errc != 0 {
+		t.Errorf("Opendir returned %d", errc)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expired container should have been listed again")
+	}
+	if b.stat.Size != 6 || !b.decryptionChecked {
+		t.Errorf("Unchanged file should have kept its real size 6, received %d", b.stat.Size)
+	}
+	if pr := fs.root.chld[rep1].chld["project"]; pr.stat.Size != 10 || bucket.stat.Size != 10 || fs.root.stat.Size != 10 {
+		t.Errorf("Sizes were not calculated from merged contents. Expected=10, received %d, %d and %d",
+			fs.root.stat.Size, pr.stat.Size, bucket.stat.Size)
+	}
+
+	// Concurrent accesses list container only once
+	bucket.lazy.listed = time.Time{}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var stat fuse.Stat_t
+			if errc := fs.Getattr(rep1+"/project/bucket/b", &stat, ^uint64(0)); errc != 0 {
+				t.Errorf("Getattr returned %d", errc)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls.Load() != 3 {
+		t.Errorf("Container should have been listed once by concurrent calls, was listed %d times", calls.Load()-2)
+	}
+}
+
 func TestCreateObjects(t *testing.T) {
 	origFs := getTestFuse(t, false, 5)
 	fs := getTestFuse(t, false, 5)
@@ -658,7 +1079,7 @@ func TestCreateObjects(t *testing.T) {
 		return n
 	}
 	CheckPanic = func() {}
-	api.GetNthLevel = func(repository, fsPath string, nodes ...string) ([]api.Metadata, error) {
+	api.GetNthLevel = func(ctx context.Context, repository, fsPath string, nodes ...string) ([]api.Metadata, error) {
 		if repository != rep {
 			return nil, fmt.Errorf("GetNthLevel() received incorrect repository %s, expected %s", repository, rep)
 		}
@@ -689,7 +1110,7 @@ func TestCreateObjects(t *testing.T) {
 	jobs := make(chan containerInfo, 1)
 	wg.Add(1)
 	go createObjects(0, jobs, &wg, nil)
-	jobs <- containerInfo{containerPath: rep + "/" + pr + "/" + cont, timestamp: fuse.Timespec{}, fs: fs}
+	jobs <- containerInfo{ctx: context.Background(), containerPath: rep + "/" + pr + "/" + cont, timestamp: fuse.Timespec{}, fs: fs}
 	close(jobs)
 	wg.Wait()
 
@@ -717,7 +1138,7 @@ func TestCreateObjects_Get_Node_Fail(t *testing.T) {
 	}()
 
 	CheckPanic = func() {}
-	api.GetNthLevel = func(rep, fsPath string, nodes ...string) ([]api.Metadata, error) {
+	api.GetNthLevel = func(ctx context.Context, rep, fsPath string, nodes ...string) ([]api.Metadata, error) {
 		return nil, nil
 	}
 
@@ -725,7 +1146,42 @@ func TestCreateObjects_Get_Node_Fail(t *testing.T) {
 	jobs := make(chan containerInfo, 1)
 	wg.Add(1)
 	go createObjects(0, jobs, &wg, nil)
-	jobs <- containerInfo{containerPath: "Rep3/child_2/dir", timestamp: fuse.Timespec{}, fs: fs}
+	jobs <- containerInfo{ctx: context.Background(), containerPath: "Rep3/child_2/dir", timestamp: fuse.Timespec{}, fs: fs}
+	close(jobs)
+	wg.Wait()
+
+	if err := isSameFuse(origFs.root, fs.root, ""); err != nil {
+		t.Errorf("Fuse should not have been modified: %s", err.Error())
+	}
+}
+
+func TestCreateObjects_Cancelled(t *testing.T) {
+	origFs := getTestFuse(t, false, 5)
+	fs := getTestFuse(t, false, 5)
+
+	origCheckPanic := CheckPanic
+	origNthLevel := api.GetNthLevel
+
+	defer func() {
+		CheckPanic = origCheckPanic
+		api.GetNthLevel = origNthLevel
+	}()
+
+	CheckPanic = func() {}
+	api.GetNthLevel = func(ctx context.Context, rep, fsPath string, nodes ...string) ([]api.Metadata, error) {
+		t.Errorf("GetNthLevel() should not have been called for path %s", fsPath)
+
+		return []api.Metadata{{Bytes: 10, Name: "file"}}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var wg sync.WaitGroup
+	jobs := make(chan containerInfo, 1)
+	wg.Add(1)
+	go createObjects(0, jobs, &wg, nil)
+	jobs <- containerInfo{ctx: ctx, containerPath: rep1 + "/child_2/dir", timestamp: fuse.Timespec{}, fs: fs}
 	close(jobs)
 	wg.Wait()
 
@@ -747,7 +1203,7 @@ func TestCreateObjects_Nth_Level_Fail(t *testing.T) {
 	}()
 
 	CheckPanic = func() {}
-	api.GetNthLevel = func(rep, fsPath string, nodes ...string) ([]api.Metadata, error) {
+	api.GetNthLevel = func(ctx context.Context, rep, fsPath string, nodes ...string) ([]api.Metadata, error) {
 		return nil, errors.New("Error occurred")
 	}
 
@@ -755,7 +1211,7 @@ func TestCreateObjects_Nth_Level_Fail(t *testing.T) {
 	jobs := make(chan containerInfo, 1)
 	wg.Add(1)
 	go createObjects(0, jobs, &wg, nil)
-	jobs <- containerInfo{containerPath: rep1 + "/child_2/dir", timestamp: fuse.Timespec{}, fs: fs}
+	jobs <- containerInfo{ctx: context.Background(), containerPath: rep1 + "/child_2/dir", timestamp: fuse.Timespec{}, fs: fs}
 	close(jobs)
 	wg.Wait()
 
@@ -784,6 +1240,26 @@ func TestRemoveInvalidChars(t *testing.T) {
 	}
 }
 
+func TestProjectName(t *testing.T) {
+	var tests = []struct {
+		original, modified string
+	}{
+		{"project", "project"},
+		{"https://example.com/dataset", "example.com_dataset"},
+		{"urn:nbn:fi:dataset", "nbn_fi_dataset"},
+	}
+
+	for i, tt := range tests {
+		testname := fmt.Sprintf("PROJECT_%d", i+1)
+		t.Run(testname, func(t *testing.T) {
+			ret := ProjectName(tt.original)
+			if ret != tt.modified {
+				t.Errorf("Project %s should have become %s, got %s", tt.original, tt.modified, ret)
+			}
+		})
+	}
+}
+
 func TestNewNode(t *testing.T) {
 	var tests = []struct {
 		dir  bool
@@ -832,6 +1308,51 @@ func TestNewNode(t *testing.T) {
 	}
 }
 
+func TestCreateLevel_Timestamps(t *testing.T) {
+	fs := &Fuse{}
+	prnt := newNode(1, fuse.S_IFDIR|sRDONLY, 0, 0, fuse.Timespec{})
+	mountTime := fuse.NewTimespec(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	created := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	modified1 := time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC)
+	modified2 := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+
+	objects := []api.Metadata{
+		{Bytes: 5, Name: "dir/file1", LastModified: modified1, Created: created},
+		{Bytes: 5, Name: "dir/file2", LastModified: modified2},
+		{Bytes: 5, Name: "file3"},
+	}
+	fs.createLevel(prnt, objects, "container", mountTime)
+	calculateFinalTimes(prnt)
+
+	dir := prnt.chld["dir"]
+	var tests = []struct {
+		testname             string
+		n                    *node
+		mtim, ctim, birthtim time.Time
+	}{
+		{"FILE_CREATED", dir.chld["file1"], modified1, modified1, created},
+		{"FILE_MODIFIED", dir.chld["file2"], modified2, modified2, modified2},
+		{"FILE_UNKNOWN", prnt.chld["file3"], mountTime.Time(), mountTime.Time(), mountTime.Time()},
+		{"DIR", dir, modified2, modified2, created},
+		{"PARENT", prnt, mountTime.Time(), mountTime.Time(), created},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			switch {
+			case tt.n == nil:
+				t.Fatal("Node was not created")
+			case !tt.n.stat.Mtim.Time().Equal(tt.mtim):
+				t.Errorf("Mtim field incorrect. Expected %q, got %q", tt.mtim, tt.n.stat.Mtim.Time())
+			case !tt.n.stat.Ctim.Time().Equal(tt.ctim):
+				t.Errorf("Ctim field incorrect. Expected %q, got %q", tt.ctim, tt.n.stat.Ctim.Time())
+			case !tt.n.stat.Birthtim.Time().Equal(tt.birthtim):
+				t.Errorf("Birthtim field incorrect. Expected %q, got %q", tt.birthtim, tt.n.stat.Birthtim.Time())
+			}
+		})
+	}
+}
+
 func TestLookupNode(t *testing.T) {
 	fs := getTestFuse(t, false, 5)
 
@@ -906,3 +1427,14 @@ func TestGetNodeChildren(t *testing.T) {
 		})
 	}
 }
+
+func TestDirectoryNames(t *testing.T) {
+	dirs := []api.Metadata{{Name: "a+b"}, {Name: "a_b"}, {Name: "https://example.com/c"}}
+	names := DirectoryNames("SD-Connect/project", dirs, ProjectName)
+
+	// Second directory gets a suffix from the hash of its original name
+	expected := []string{"a_b", "a_b(648fa9)", "example.com_c"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Incorrect names\nExpected=%v\nReceived=%v", expected, names)
+	}
+}
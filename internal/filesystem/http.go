@@ -0,0 +1,245 @@
+package filesystem
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"sda-filesystem/internal/control"
+	"sda-filesystem/internal/logs"
+)
+
+// unixPrefix marks an HTTP address that is the path of a Unix socket
+const unixPrefix = "unix:"
+
+// server is the HTTP server if the filesystem is served over WebDAV or HTTP instead of being mounted
+var server atomic.Pointer[http.Server]
+
+// TreeEntry is a file or directory in the listings of the HTTP server
+type TreeEntry struct {
+	Name         string `json:"name"`
+	Size         int64  `json:"size"`
+	Mode         string `json:"mode"`
+	OriginalName string `json:"original_name"`
+	Repository   string `json:"repository"`
+}
+
+// credentialsOutput is where the credentials of a server are written when it starts. They are not logged,
+// so that they do not end up in log files.
+var credentialsOutput io.Writer = os.Stdout
+
+// SetCredentialsOutput sets where the credentials of a server are written when it starts
+func SetCredentialsOutput(w io.Writer) {
+	credentialsOutput = w
+}
+
+// newToken generates the token with which requests to the HTTP server are authorized
+var newToken = func() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Could not generate token: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// checkLoopback checks that 'addr' is an address on the loopback interface,
+// so that the filesystem is not exposed to other machines
+func checkLoopback(service, addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("Invalid %s address %s: %w", service, addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("%s can only be served on the loopback interface, received address %s", service, addr)
+	}
+
+	return nil
+}
+
+// CheckHTTPAddress checks that 'addr' is either an address on the loopback interface
+// or the path of a Unix socket prefixed with 'unix:'
+func CheckHTTPAddress(addr string) error {
+	if socket, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		if socket == "" {
+			return fmt.Errorf("Invalid HTTP address %s: socket path is missing", addr)
+		}
+
+		return nil
+	}
+
+	return checkLoopback("HTTP", addr)
+}
+
+// ServeHTTP serves filesystem 'fs' read-only over HTTP at address 'addr' instead of mounting it.
+// Requests need to include the random token that is written to standard output when the server starts.
+// Returns once the server has been stopped with UnmountFilesystem.
+func ServeHTTP(fs *Fuse, addr string) error {
+	if err := CheckHTTPAddress(addr); err != nil {
+		return err
+	}
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	var listener net.Listener
+	if socket, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		listener, err = control.ListenUnix(socket)
+	} else {
+		listener, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("Could not serve HTTP: %w", err)
+	}
+
+	url := "http://" + listener.Addr().String()
+	if strings.HasPrefix(addr, unixPrefix) {
+		url = addr
+	}
+	logs.Infof("Serving Data Gateway over HTTP at %s", url)
+	fmt.Fprintf(credentialsOutput, "HTTP token: %s\n", token)
+
+	return serve(fs, listener, fs.HTTPHandler(token))
+}
+
+// serve serves 'handler' on 'listener' until the server is stopped with UnmountFilesystem
+func serve(fs *Fuse, listener net.Listener, handler http.Handler) error {
+	s := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	server.Store(s)
+	defer server.Store(nil)
+
+	if readyNotifier != nil {
+		readyNotifier()
+	}
+	err := s.Serve(listener)
+	fs.Destroy()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("Server failed: %w", err)
+	}
+
+	return nil
+}
+
+// HTTPHandler returns an HTTP handler that serves JSON listings of directories under /tree/
+// and the contents of files under /files/. Requests are authorized with 'token',
+// given either as a bearer token or with query parameter 'token'.
+func (fs *Fuse) HTTPHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tree/{path...}", fs.serveTree)
+	mux.HandleFunc("GET /files/{path...}", fs.serveFile)
+
+	return authorize(token, "Bearer", mux)
+}
+
+// authorize passes requests to 'next' if they include 'token' as a bearer token, as the password of basic
+// authentication with any user name, or in query parameter 'token'. Other requests are answered with
+// status 401 and 'challenge' in header WWW-Authenticate.
+func authorize(token, challenge string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received := r.URL.Query().Get("token")
+		if auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			received = auth
+		} else if _, password, ok := r.BasicAuth(); ok {
+			received = password
+		}
+		if subtle.ConstantTimeCompare([]byte(received), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", challenge)
+			http.Error(w, "Invalid or missing token", http.StatusUnauthorized)
+
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveTree responds with the contents of a directory, or with the file itself if the path is a file
+func (fs *Fuse) serveTree(w http.ResponseWriter, r *http.Request) {
+	p := "/" + strings.Trim(r.PathValue("path"), "/")
+	fs.listContainer(p, true)
+
+	fs.lock.RLock()
+	n := fs.getNode(p, ^uint64(0))
+	if n.node == nil {
+		fs.lock.RUnlock()
+		http.Error(w, p+" does not exist", http.StatusNotFound)
+
+		return
+	}
+	var entries []TreeEntry
+	if isDir(n.node) {
+		entries = make([]TreeEntry, 0, len(n.node.chld))
+		for name, c := range n.node.chld {
+			entries = append(entries, treeEntry(name, c, append(slices.Clip(n.path), c.originalName)))
+		}
+	} else {
+		entries = []TreeEntry{treeEntry(path.Base(p), n.node, n.path)}
+	}
+	fs.lock.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		logs.Debugf("Could not send listing of %s: %s", p, err.Error())
+	}
+}
+
+// treeEntry describes node 'n' whose original path is 'origPath'. Caller must hold fs.lock.
+func treeEntry(name string, n *node, origPath []string) TreeEntry {
+	mode := os.FileMode(n.stat.Mode & 0777)
+	if isDir(n) {
+		mode |= os.ModeDir
+	}
+
+	return TreeEntry{
+		Name:         name,
+		Size:         max(n.stat.Size, 0),
+		Mode:         mode.String(),
+		OriginalName: n.originalName,
+		Repository:   origPath[0],
+	}
+}
+
+// serveFile responds with the contents of a file. Files are read in the same way as over WebDAV,
+// so that ranges are downloaded through the cache.
+func (fs *Fuse) serveFile(w http.ResponseWriter, r *http.Request) {
+	p := "/" + strings.Trim(r.PathValue("path"), "/")
+	f, err := (&davFS{fs: fs}).OpenFile(r.Context(), p, os.O_RDONLY, 0)
+	if err != nil {
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			http.Error(w, p+" does not exist", http.StatusNotFound)
+		case errors.Is(err, os.ErrPermission):
+			http.Error(w, "You do not have permission to access file "+p, http.StatusForbidden)
+		default:
+			http.Error(w, "Could not open file "+p, http.StatusInternalServerError)
+		}
+
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	switch {
+	case err != nil:
+		http.Error(w, p+" does not exist", http.StatusNotFound)
+	case info.IsDir():
+		http.Error(w, p+" is a directory", http.StatusBadRequest)
+	default:
+		w.Header().Set("Content-Type", contentType(p))
+		http.ServeContent(w, r, "", info.ModTime(), f)
+	}
+}
@@ -0,0 +1,201 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sda-filesystem/internal/api"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	data := "All work and no play makes Jack a dull boy..."
+	token := "secret"
+
+	origDownloadData := api.DownloadData
+	origPrefetchData := api.PrefetchData
+	defer func() {
+		api.DownloadData = origDownloadData
+		api.PrefetchData = origPrefetchData
+	}()
+
+	api.DownloadData = func(_ context.Context, nodes []string, _ string, start, end, maxEnd int64) ([]byte, error) {
+		if strings.Join(nodes, "/") != "Rep1/child+1/kansio/file_2" {
+			t.Errorf("Incorrect nodes %v", nodes)
+		}
+		if maxEnd != int64(len(data)) {
+			t.Errorf("Incorrect file size. Expected=%d, received=%d", len(data), maxEnd)
+		}
+
+		return []byte(data[start:end]), nil
+	}
+	api.PrefetchData = func(_ context.Context, _ []string, _ string, _, from, _ int64) int64 {
+		return from
+	}
+
+	fs := getTestFuse(t, false, 5)
+	fs.openmap = map[uint64]nodeAndPath{}
+	server := httptest.NewServer(fs.HTTPHandler(token))
+	defer server.Close()
+
+	var tests = []struct {
+		testname, path, auth, header, body string
+		status                             int
+	}{
+		{"TREE_ROOT", "/tree/", "Bearer secret", "", `[{"name":"Rep1","size":416,"mode":"dr--r--r--","original_name":"Rep1","repository":"Rep1"},` +
+			`{"name":"` + api.SDSubmit + `","size":5,"mode":"dr--r--r--","original_name":"` + api.SDSubmit + `","repository":"` + api.SDSubmit + `"}]`, http.StatusOK},
+		{"TREE_DIRECTORY", "/tree/Rep1/child_1/", "Bearer secret", "", `[{"name":"dir_","size":112,"mode":"dr--r--r--","original_name":"dir+","repository":"Rep1"},` +
+			`{"name":"kansio","size":88,"mode":"dr--r--r--","original_name":"kansio","repository":"Rep1"}]`, http.StatusOK},
+		{"TREE_FILE", "/tree/Rep1/child_1/kansio/file_2?token=secret", "", "", `[{"name":"file_2","size":45,"mode":"-r--r--r--","original_name":"file_2","repository":"Rep1"}]`, http.StatusOK},
+		{"TREE_NOT_FOUND", "/tree/Rep1/child_3", "Bearer secret", "", "/Rep1/child_3 does not exist", http.StatusNotFound},
+		{"FILE", "/files/Rep1/child_1/kansio/file_2", "Bearer secret", "", data, http.StatusOK},
+		{"FILE_BASIC", "/files/Rep1/child_1/kansio/file_2", "Basic dXNlcjpzZWNyZXQ=", "", data, http.StatusOK},
+		{"FILE_RANGE", "/files/Rep1/child_1/kansio/file_2?token=secret", "", "bytes=4-11", "work and", http.StatusPartialContent},
+		{"FILE_NOT_FOUND", "/files/Rep1/child_1/kansio/file_4", "Bearer secret", "", "/Rep1/child_1/kansio/file_4 does not exist", http.StatusNotFound},
+		{"FILE_DIRECTORY", "/files/Rep1/child_1", "Bearer secret", "", "/Rep1/child_1 is a directory", http.StatusBadRequest},
+		{"NO_TOKEN", "/tree/", "", "", "Invalid or missing token", http.StatusUnauthorized},
+		{"WRONG_TOKEN", "/files/Rep1/child_1/kansio/file_2?token=secret", "Bearer wrong", "", "Invalid or missing token", http.StatusUnauthorized},
+		{"UNKNOWN_PATH", "/other", "Bearer secret", "", "404 page not found", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			req, err := http.NewRequest("GET", server.URL+tt.path, nil)
+			if err != nil {
+				t.Fatalf("Could not create request: %s", err.Error())
+			}
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			if tt.header != "" {
+				req.Header.Set("Range", tt.header)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %s", err.Error())
+			}
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatalf("Could not read response: %s", err.Error())
+			}
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("Incorrect status. Expected=%d, received=%d", tt.status, resp.StatusCode)
+			} else if strings.TrimSpace(string(body)) != tt.body {
+				t.Errorf("Incorrect response\nExpected=%s\nReceived=%s", tt.body, body)
+			}
+			if len(fs.openmap) != 0 {
+				t.Errorf("Files were left open: %v", fs.openmap)
+			}
+		})
+	}
+}
+
+func TestCheckHTTPAddress(t *testing.T) {
+	var tests = []struct {
+		addr, errStr string
+	}{
+		{"localhost:8080", ""},
+		{"[::1]:0", ""},
+		{"unix:/tmp/gateway.sock", ""},
+		{"unix:", "Invalid HTTP address unix:: socket path is missing"},
+		{"192.168.1.1:8080", "HTTP can only be served on the loopback interface, received address 192.168.1.1:8080"},
+		{"localhost", "Invalid HTTP address localhost: address localhost: missing port in address"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			err := CheckHTTPAddress(tt.addr)
+			switch {
+			case tt.errStr == "" && err != nil:
+				t.Errorf("Function returned unexpected error: %s", err.Error())
+			case tt.errStr != "" && err == nil:
+				t.Errorf("Function should have returned error")
+			case tt.errStr != "" && err.Error() != tt.errStr:
+				t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errStr, err.Error())
+			}
+		})
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	fs := getTestFuse(t, false, 5)
+	socket := filepath.Join(t.TempDir(), "gateway.sock")
+
+	origReadyNotifier := readyNotifier
+	origNewToken := newToken
+	origCredentialsOutput := credentialsOutput
+	defer func() {
+		readyNotifier = origReadyNotifier
+		newToken = origNewToken
+		credentialsOutput = origCredentialsOutput
+	}()
+
+	ready := make(chan struct{})
+	readyNotifier = func() { close(ready) }
+	newToken = func() (string, error) {
+		return "secret", nil
+	}
+	var out bytes.Buffer
+	credentialsOutput = &out
+
+	// Socket left behind by a server that is no longer running
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Could not create socket: %s", err.Error())
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	errc := make(chan error)
+	go func() { errc <- ServeHTTP(fs, "unix:"+socket) }()
+	<-ready
+
+	if expected := "HTTP token: secret\n"; out.String() != expected {
+		t.Errorf("Incorrect output\nExpected=%q\nReceived=%q", expected, out.String())
+	}
+	if info, err := os.Stat(socket); err != nil {
+		t.Errorf("Could not stat socket: %s", err.Error())
+	} else if info.Mode().Perm()&0077 != 0 {
+		t.Errorf("Socket should only be accessible to its owner, permissions are %s", info.Mode().Perm())
+	}
+
+	client := http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	resp, err := client.Get("http://gateway/tree/" + api.SDSubmit + "?token=secret")
+	if err != nil {
+		t.Fatalf("Request failed: %s", err.Error())
+	}
+	var entries []TreeEntry
+	err = json.NewDecoder(resp.Body).Decode(&entries)
+	resp.Body.Close()
+	expected := []TreeEntry{{Name: "example.com", Size: 5, Mode: "dr--r--r--", OriginalName: "https://example.com", Repository: api.SDSubmit}}
+	switch {
+	case err != nil:
+		t.Errorf("Could not decode listing: %s", err.Error())
+	case !reflect.DeepEqual(entries, expected):
+		t.Errorf("Incorrect listing\nExpected=%v\nReceived=%v", expected, entries)
+	}
+
+	UnmountFilesystem()
+	if err = <-errc; err != nil {
+		t.Errorf("Function returned unexpected error: %s", err.Error())
+	}
+	if fs.ctx.Err() == nil {
+		t.Errorf("Requests of the filesystem should have been cancelled")
+	}
+}
@@ -0,0 +1,280 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"sda-filesystem/internal/logs"
+
+	"github.com/billziss-gh/cgofuse/fuse"
+	"golang.org/x/net/webdav"
+)
+
+var errIO = errors.New("Input/output error")
+
+// CheckWebDAVAddress checks that 'addr' is an address on the loopback interface,
+// so that the filesystem is not exposed to other machines
+func CheckWebDAVAddress(addr string) error {
+	return checkLoopback("WebDAV", addr)
+}
+
+// ServeWebDAV serves filesystem 'fs' read-only over WebDAV at address 'addr' instead of mounting it.
+// Clients log in with any user name and the random password that is written to standard output
+// when the server starts. Returns once the server has been stopped with UnmountFilesystem.
+func ServeWebDAV(fs *Fuse, addr string) error {
+	if err := CheckWebDAVAddress(addr); err != nil {
+		return err
+	}
+	password, err := newToken()
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("Could not serve WebDAV: %w", err)
+	}
+	logs.Infof("Serving Data Gateway over WebDAV at http://%s", listener.Addr())
+	fmt.Fprintf(credentialsOutput, "WebDAV password, with any user name: %s\n", password)
+
+	return serve(fs, listener, fs.WebDAVHandler(password))
+}
+
+// WebDAVHandler returns an HTTP handler that serves the filesystem read-only over WebDAV.
+// Requests are authorized with basic authentication, with any user name and 'password'.
+func (fs *Fuse) WebDAVHandler(password string) http.Handler {
+	return authorize(password, `Basic realm="Data Gateway"`, &webdav.Handler{
+		FileSystem: &davFS{fs: fs},
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				logs.Debugf("WebDAV request %s %s failed: %s", r.Method, r.URL.Path, err.Error())
+			}
+		},
+	})
+}
+
+// davFS gives WebDAV read-only access to the filesystem (implements webdav.FileSystem)
+type davFS struct {
+	fs *Fuse
+}
+
+func (d *davFS) Mkdir(_ context.Context, _ string, _ os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (d *davFS) RemoveAll(_ context.Context, _ string) error {
+	return os.ErrPermission
+}
+
+func (d *davFS) Rename(_ context.Context, _, _ string) error {
+	return os.ErrPermission
+}
+
+func (d *davFS) Stat(_ context.Context, name string) (os.FileInfo, error) {
+	d.fs.listContainer(name, false)
+	defer d.fs.synchronizeRead()()
+	n := d.fs.getNode(name, ^uint64(0)).node
+	if n == nil {
+		return nil, os.ErrNotExist
+	}
+
+	return &davInfo{name: path.Base(name), stat: n.stat}, nil
+}
+
+func (d *davFS) OpenFile(ctx context.Context, name string, flag int, _ os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, os.ErrPermission
+	}
+
+	info, err := d.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		errc, fh := d.fs.Opendir(name)
+		if errc != 0 {
+			return nil, errnoError(errc)
+		}
+
+		return &davFile{fs: d.fs, path: name, fh: fh, dir: true}, nil
+	}
+
+	logs.Debug("Opening file ", name)
+	errc, fh := d.fs.openFile(name)
+	if errc != 0 {
+		return nil, errnoError(errc)
+	}
+
+	return &davFile{fs: d.fs, path: name, fh: fh}, nil
+}
+
+// davFile is an open file or directory (implements webdav.File)
+type davFile struct {
+	fs      *Fuse
+	path    string
+	fh      uint64
+	dir     bool
+	pos     int64         // read position of a file
+	listed  bool          // whether the contents of a directory have been read
+	entries []os.FileInfo // contents of a directory that have not yet been returned by Readdir
+}
+
+func (f *davFile) Close() error {
+	if f.dir {
+		return errnoError(f.fs.Releasedir(f.path, f.fh))
+	}
+
+	return errnoError(f.fs.Release(f.path, f.fh))
+}
+
+func (f *davFile) Read(p []byte) (int, error) {
+	if f.dir {
+		return 0, os.ErrInvalid
+	}
+
+	n := f.fs.Read(f.path, p, f.pos, f.fh)
+	if n < 0 {
+		return 0, errnoError(n)
+	}
+	if n == 0 && len(p) > 0 {
+		return 0, io.EOF
+	}
+	f.pos += int64(n)
+
+	return n, nil
+}
+
+func (f *davFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		info, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		offset += info.Size()
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	f.pos = offset
+
+	return offset, nil
+}
+
+func (f *davFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.listed {
+		errc := f.fs.Readdir(f.path, func(name string, stat *fuse.Stat_t, _ int64) bool {
+			if name != "." && name != ".." {
+				f.entries = append(f.entries, &davInfo{name: name, stat: *stat})
+			}
+
+			return true
+		}, 0, f.fh)
+		if errc != 0 {
+			return nil, errnoError(errc)
+		}
+		sort.Slice(f.entries, func(i, j int) bool { return f.entries[i].Name() < f.entries[j].Name() })
+		f.listed = true
+	}
+
+	if count <= 0 {
+		count = len(f.entries)
+	} else if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	count = min(count, len(f.entries))
+	entries := f.entries[:count]
+	f.entries = f.entries[count:]
+
+	return entries, nil
+}
+
+func (f *davFile) Stat() (os.FileInfo, error) {
+	defer f.fs.synchronizeRead()()
+	n := f.fs.getNode(f.path, f.fh).node
+	if n == nil {
+		return nil, os.ErrNotExist
+	}
+
+	return &davInfo{name: path.Base(f.path), stat: n.stat}, nil
+}
+
+func (f *davFile) Write(_ []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+// davInfo describes a file or directory (implements os.FileInfo and webdav.ContentTyper)
+type davInfo struct {
+	name string
+	stat fuse.Stat_t
+}
+
+func (i *davInfo) Name() string {
+	return i.name
+}
+
+func (i *davInfo) Size() int64 {
+	return max(i.stat.Size, 0)
+}
+
+func (i *davInfo) Mode() os.FileMode {
+	if i.IsDir() {
+		return os.ModeDir | 0555
+	}
+
+	return 0444
+}
+
+func (i *davInfo) ModTime() time.Time {
+	return i.stat.Mtim.Time()
+}
+
+func (i *davInfo) IsDir() bool {
+	return i.stat.Mode&fuse.S_IFMT == fuse.S_IFDIR
+}
+
+func (i *davInfo) Sys() any {
+	return nil
+}
+
+// ContentType determines the content type from the file extension, so that files do not need to be
+// downloaded when their properties are listed
+func (i *davInfo) ContentType(_ context.Context) (string, error) {
+	return contentType(i.name), nil
+}
+
+// contentType returns the content type of file 'name' based on its extension
+func contentType(name string) string {
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		return ct
+	}
+
+	return "application/octet-stream"
+}
+
+// errnoError converts a fuse error code to an error WebDAV understands
+func errnoError(errc int) error {
+	switch -errc {
+	case 0:
+		return nil
+	case fuse.ENOENT:
+		return os.ErrNotExist
+	case fuse.EACCES:
+		return os.ErrPermission
+	case fuse.EISDIR, fuse.ENOTDIR:
+		return os.ErrInvalid
+	}
+
+	return errIO
+}
@@ -0,0 +1,170 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sda-filesystem/internal/api"
+)
+
+func TestWebDAVHandler(t *testing.T) {
+	data := "All work and no play makes Jack a dull boy..."
+
+	origDownloadData := api.DownloadData
+	origPrefetchData := api.PrefetchData
+	defer func() {
+		api.DownloadData = origDownloadData
+		api.PrefetchData = origPrefetchData
+	}()
+
+	api.DownloadData = func(_ context.Context, nodes []string, _ string, start, end, maxEnd int64) ([]byte, error) {
+		if strings.Join(nodes, "/") != "Rep1/child+1/kansio/file_2" {
+			t.Errorf("Incorrect nodes %v", nodes)
+		}
+		if maxEnd != int64(len(data)) {
+			t.Errorf("Incorrect file size. Expected=%d, received=%d", len(data), maxEnd)
+		}
+
+		return []byte(data[start:end]), nil
+	}
+	api.PrefetchData = func(_ context.Context, _ []string, _ string, _, from, _ int64) int64 {
+		return from
+	}
+
+	fs := getTestFuse(t, false, 5)
+	fs.openmap = map[uint64]nodeAndPath{}
+	server := httptest.NewServer(fs.WebDAVHandler("secret"))
+	defer server.Close()
+
+	var tests = []struct {
+		testname, method, path, password, header, body string
+		status                                         int
+	}{
+		{"GET", "GET", "/Rep1/child_1/kansio/file_2", "secret", "", data, http.StatusOK},
+		{"GET_RANGE", "GET", "/Rep1/child_1/kansio/file_2", "secret", "bytes=4-11", "work and", http.StatusPartialContent},
+		{"GET_NOT_FOUND", "GET", "/Rep1/child_1/kansio/file_4", "secret", "", "", http.StatusNotFound},
+		{"GET_NO_PASSWORD", "GET", "/Rep1/child_1/kansio/file_2", "", "", "Invalid or missing token\n", http.StatusUnauthorized},
+		{"GET_WRONG_PASSWORD", "GET", "/Rep1/child_1/kansio/file_2", "wrong", "", "Invalid or missing token\n", http.StatusUnauthorized},
+		{"PROPFIND", "PROPFIND", "/Rep1/child_1/kansio/", "secret", "1", "<D:href>/Rep1/child_1/kansio/file_3</D:href>", http.StatusMultiStatus},
+		{"PROPFIND_NO_PASSWORD", "PROPFIND", "/Rep1/child_1/kansio/", "", "1", "Invalid or missing token", http.StatusUnauthorized},
+		{"PUT", "PUT", "/Rep1/child_1/kansio/file_2", "secret", "", "", http.StatusNotFound},
+		{"DELETE", "DELETE", "/Rep1/child_1/kansio/file_2", "secret", "", "", http.StatusMethodNotAllowed},
+		{"MKCOL", "MKCOL", "/Rep1/child_1/new", "secret", "", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testname, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(""))
+			if err != nil {
+				t.Fatalf("Could not create request: %s", err.Error())
+			}
+			if tt.password != "" {
+				req.SetBasicAuth("user", tt.password)
+			}
+			switch tt.method {
+			case "GET":
+				if tt.header != "" {
+					req.Header.Set("Range", tt.header)
+				}
+			case "PROPFIND":
+				req.Header.Set("Depth", tt.header)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %s", err.Error())
+			}
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatalf("Could not read response: %s", err.Error())
+			}
+
+			switch {
+			case resp.StatusCode != tt.status:
+				t.Errorf("Incorrect status. Expected=%d, received=%d", tt.status, resp.StatusCode)
+			case resp.StatusCode == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") != `Basic realm="Data Gateway"`:
+				t.Errorf("Incorrect authentication challenge %q", resp.Header.Get("WWW-Authenticate"))
+			case tt.method == "GET" && tt.body != "" && string(body) != tt.body:
+				t.Errorf("Incorrect response\nExpected=%q\nReceived=%q", tt.body, body)
+			case tt.method == "PROPFIND" && !strings.Contains(string(body), tt.body):
+				t.Errorf("Response should contain %s\nReceived=%s", tt.body, body)
+			}
+			if len(fs.openmap) != 0 {
+				t.Errorf("Files were left open: %v", fs.openmap)
+			}
+		})
+	}
+}
+
+func TestCheckWebDAVAddress(t *testing.T) {
+	var tests = []struct {
+		addr, errStr string
+	}{
+		{"localhost:8080", ""},
+		{"127.0.0.1:0", ""},
+		{"[::1]:8080", ""},
+		{"0.0.0.0:8080", "WebDAV can only be served on the loopback interface, received address 0.0.0.0:8080"},
+		{":8080", "WebDAV can only be served on the loopback interface, received address :8080"},
+		{"example.com:80", "WebDAV can only be served on the loopback interface, received address example.com:80"},
+		{"localhost", "Invalid WebDAV address localhost: address localhost: missing port in address"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			err := CheckWebDAVAddress(tt.addr)
+			switch {
+			case tt.errStr == "" && err != nil:
+				t.Errorf("Function returned unexpected error: %s", err.Error())
+			case tt.errStr != "" && err == nil:
+				t.Errorf("Function should have returned error")
+			case tt.errStr != "" && err.Error() != tt.errStr:
+				t.Errorf("Function returned incorrect error\nExpected=%s\nReceived=%s", tt.errStr, err.Error())
+			}
+		})
+	}
+}
+
+func TestServeWebDAV(t *testing.T) {
+	fs := getTestFuse(t, false, 5)
+
+	origReadyNotifier := readyNotifier
+	origNewToken := newToken
+	origCredentialsOutput := credentialsOutput
+	defer func() {
+		readyNotifier = origReadyNotifier
+		newToken = origNewToken
+		credentialsOutput = origCredentialsOutput
+	}()
+
+	ready := make(chan struct{})
+	readyNotifier = func() { close(ready) }
+	newToken = func() (string, error) {
+		return "secret", nil
+	}
+	var out bytes.Buffer
+	credentialsOutput = &out
+
+	errc := make(chan error)
+	go func() { errc <- ServeWebDAV(fs, "127.0.0.1:0") }()
+
+	<-ready
+	if expected := "WebDAV password, with any user name: secret\n"; out.String() != expected {
+		t.Errorf("Incorrect output\nExpected=%q\nReceived=%q", expected, out.String())
+	}
+	UnmountFilesystem()
+	if err := <-errc; err != nil {
+		t.Errorf("Function returned unexpected error: %s", err.Error())
+	}
+	if fs.ctx.Err() == nil {
+		t.Errorf("Requests of the filesystem should have been cancelled")
+	}
+	if server.Load() != nil {
+		t.Errorf("Server should have been cleared")
+	}
+}
@@ -3,6 +3,7 @@ package logs
 import (
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/sirupsen/logrus"
@@ -37,6 +38,18 @@ var SetLevel = func(level string) {
 	log.SetLevel(logrus.InfoLevel)
 }
 
+// SetOutput sets the writer to which the standard logger writes. Each log entry is written with one call.
+func SetOutput(w io.Writer) {
+	log.SetOutput(w)
+}
+
+// ValidLevel tells whether 'level' is a supported logging level
+func ValidLevel(level string) bool {
+	_, ok := levelMap[strings.ToLower(level)]
+
+	return ok
+}
+
 // Wrapper returns the outermost error in err as a string along with the wrapped error
 func Wrapper(err error) (string, error) {
 	unwrapped := errors.Unwrap(err)
@@ -82,6 +82,19 @@ func TestSetLevel(t *testing.T) {
 	}
 }
 
+func TestValidLevel(t *testing.T) {
+	for _, level := range []string{"error", "warning", "info", "debug", "DEBUG"} {
+		if !ValidLevel(level) {
+			t.Errorf("Level %s should be valid", level)
+		}
+	}
+	for _, level := range []string{"test", "warn", ""} {
+		if ValidLevel(level) {
+			t.Errorf("Level %s should not be valid", level)
+		}
+	}
+}
+
 func TestWrapper(t *testing.T) {
 	errs := []string{"Original problem", "Fix me", "Whaaat???", "Another error", "Error 1"}
 	fullError := fmt.Errorf("%s", errs[0])